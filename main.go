@@ -2,12 +2,27 @@ package main
 
 import (
 	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"log"
+	"net/http"
 	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/seanblong/readmerunner/readmerunner"
 )
@@ -31,12 +46,573 @@ func parseInputTags(tags string) []string {
 	return list
 }
 
+// isTerminal reports whether w is a character device such as an interactive
+// terminal.
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return fi.Mode()&os.ModeCharDevice != 0
+}
+
+// pagerCommand returns the pager to use, preferring $PAGER over "less -R".
+func pagerCommand() string {
+	if pager := strings.TrimSpace(os.Getenv("PAGER")); pager != "" {
+		return pager
+	}
+	return "less -R"
+}
+
+// runPager feeds content to the pager command through a shell so that pagers
+// with arguments, e.g. "less -R", work as expected.
+func runPager(pager, content string, stdout, stderr io.Writer) error {
+	cmd := exec.Command("sh", "-c", pager)
+	cmd.Stdin = strings.NewReader(content)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	return cmd.Run()
+}
+
+// clipboardCommand returns the command that copies its standard input to the
+// clipboard, preferring $README_RUNNER_CLIPBOARD over the platform tools, or
+// "" if there is none.
+func clipboardCommand() string {
+	if command := strings.TrimSpace(os.Getenv("README_RUNNER_CLIPBOARD")); command != "" {
+		return command
+	}
+	for _, command := range []string{"pbcopy", "wl-copy", "xclip -selection clipboard", "xsel --clipboard --input", "clip.exe"} {
+		if _, err := exec.LookPath(strings.Fields(command)[0]); err == nil {
+			return command
+		}
+	}
+	return ""
+}
+
+// runClipboard feeds text to the clipboard command through a shell, like
+// runPager.
+func runClipboard(command, text string, stderr io.Writer) error {
+	cmd := exec.Command("sh", "-c", command)
+	cmd.Stdin = strings.NewReader(text)
+	cmd.Stderr = stderr
+	return cmd.Run()
+}
+
+// runEditor opens code in editor, e.g. $EDITOR, and returns the edited code.
+func runEditor(editor, code string, stdout, stderr io.Writer) (string, error) {
+	f, err := os.CreateTemp("", "readme-runner-*.sh")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.WriteString(code); err != nil {
+		f.Close()
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		return "", err
+	}
+	// The editor may include arguments, e.g. "code --wait".
+	cmd := exec.Command("sh", "-c", editor+` "$1"`, "sh", f.Name())
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	if err := cmd.Run(); err != nil {
+		return "", err
+	}
+	edited, err := os.ReadFile(f.Name())
+	return string(edited), err
+}
+
+// handleInterrupts runs cleanup and then exits when the program is
+// interrupted.  An interrupt is first passed to interrupt, which reports
+// whether it stopped a running command instead, e.g. a long snippet, in which
+// case the program carries on.  A second interrupt exits immediately in case
+// cleanup hangs.  The returned function stops listening for interrupts.
+func handleInterrupts(interrupt func() bool, cleanup func(), exit func(int)) (stop func()) {
+	sigs := make(chan os.Signal, 2)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	done := make(chan struct{})
+	go func() {
+		for {
+			var sig os.Signal
+			select {
+			case sig = <-sigs:
+			case <-done:
+				return
+			}
+			if sig != os.Interrupt || !interrupt() {
+				break
+			}
+		}
+		go func() {
+			<-sigs
+			exit(130)
+		}()
+		cleanup()
+		exit(130)
+	}()
+	return func() {
+		signal.Stop(sigs)
+		close(done)
+	}
+}
+
+// openTTY opens the controlling terminal for reading answers when stdin is
+// used for something else.
+var openTTY = func() (io.ReadCloser, error) {
+	return os.Open("/dev/tty")
+}
+
+// parseAliases parses a comma-separated list of alias=language pairs.
+func parseAliases(aliases string) (map[string]string, error) {
+	parsed := map[string]string{}
+	for _, pair := range parseInputTags(aliases) {
+		alias, lang, ok := strings.Cut(pair, "=")
+		alias, lang = strings.TrimSpace(alias), strings.TrimSpace(lang)
+		if !ok || alias == "" || lang == "" {
+			return nil, fmt.Errorf("invalid alias %q, expected alias=language", pair)
+		}
+		parsed[alias] = lang
+	}
+	return parsed, nil
+}
+
+// selectSections prints a numbered table-of-contents to w and returns the
+// anchors of the headers picked with promptFunc.  An empty answer picks every
+// section.
+func selectSections(mdContent []byte, depth int, w io.Writer, promptFunc func(string) string) ([]string, error) {
+	opts := readmerunner.TOCOptions{Depth: depth, Numbered: true}
+	if err := readmerunner.PrintTOCWithOptions(w, mdContent, opts); err != nil {
+		return nil, err
+	}
+	entries := readmerunner.TOCEntries(mdContent, opts)
+	var anchors []string
+	for _, field := range parseInputTags(promptFunc("\n> Sections to run, e.g. 1,3 [default all]: ")) {
+		n, err := strconv.Atoi(field)
+		if err != nil || n < 1 || n > len(entries) {
+			return nil, fmt.Errorf("invalid section %q, expected a number from 1 to %d", field, len(entries))
+		}
+		anchors = append(anchors, entries[n-1].Anchor)
+	}
+	return anchors, nil
+}
+
+// selectStart prints a numbered table-of-contents to w and returns the anchor
+// of the header picked with promptFunc to start the run from.  An empty answer
+// starts at the top.
+func selectStart(mdContent []byte, depth int, w io.Writer, promptFunc func(string) string) (string, error) {
+	opts := readmerunner.TOCOptions{Depth: depth, Numbered: true}
+	if err := readmerunner.PrintTOCWithOptions(w, mdContent, opts); err != nil {
+		return "", err
+	}
+	entries := readmerunner.TOCEntries(mdContent, opts)
+	answer := strings.TrimSpace(promptFunc("\n> Enter a section number to start running from [default 1]: "))
+	if answer == "" {
+		return "", nil
+	}
+	n, err := strconv.Atoi(answer)
+	if err != nil || n < 1 || n > len(entries) {
+		return "", fmt.Errorf("invalid section %q, expected a number from 1 to %d", answer, len(entries))
+	}
+	return entries[n-1].Anchor, nil
+}
+
+// fetchTimeout limits how long fetching a remote README may take.
+const fetchTimeout = 30 * time.Second
+
+// isRemote reports whether path is an http(s) URL rather than a file.
+func isRemote(path string) bool {
+	return strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://")
+}
+
+// errNotModified is returned by fetchREADME when the cached copy of a remote
+// README is still current.
+var errNotModified = errors.New("not modified")
+
+// fetchREADME downloads a remote README and returns it with its ETag.  When
+// etag or modified is set, the request is conditional and errNotModified is
+// returned if the README hasn't changed since.
+func fetchREADME(url, etag string, modified time.Time) ([]byte, string, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	if !modified.IsZero() {
+		req.Header.Set("If-Modified-Since", modified.UTC().Format(http.TimeFormat))
+	}
+	client := &http.Client{Timeout: fetchTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotModified {
+		return nil, "", errNotModified
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("fetching %s: %s", url, resp.Status)
+	}
+	content, err := io.ReadAll(resp.Body)
+	return content, resp.Header.Get("ETag"), err
+}
+
+// cacheDir returns the directory remote READMEs are cached in.
+var cacheDir = func() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "readmerunner"), nil
+}
+
+// cachePath returns the file a remote README is cached in, keyed by a hash of
+// its URL.
+func cachePath(url string) (string, error) {
+	dir, err := cacheDir()
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(url))
+	return filepath.Join(dir, hex.EncodeToString(sum[:])+".md"), nil
+}
+
+// loadRemote fetches a remote README and caches it.  A cached copy is only
+// fetched again if the server reports that it has changed.  When offline, the
+// cached copy is used without asking and it is an error if there isn't one.
+// Failing to update the cache only writes a warning to stderr.
+func loadRemote(url string, offline bool, stderr io.Writer) ([]byte, error) {
+	path, err := cachePath(url)
+	if err != nil {
+		return nil, err
+	}
+	cached, cacheErr := os.ReadFile(path)
+	if offline {
+		if errors.Is(cacheErr, os.ErrNotExist) {
+			return nil, fmt.Errorf("%s is not cached, run it once without --offline", url)
+		}
+		return cached, cacheErr
+	}
+	var etag string
+	var modified time.Time
+	if cacheErr == nil {
+		if tag, err := os.ReadFile(path + ".etag"); err == nil {
+			etag = string(tag)
+		}
+		if info, err := os.Stat(path); err == nil {
+			modified = info.ModTime()
+		}
+	}
+	content, etag, err := fetchREADME(url, etag, modified)
+	if errors.Is(err, errNotModified) {
+		return cached, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := writeCache(path, content, etag); err != nil {
+		fmt.Fprintf(stderr, "Warning: could not cache %s: %v\n", url, err)
+	}
+	return content, nil
+}
+
+// writeCache stores a fetched README at path, with its ETag alongside when
+// the server sent one.
+func writeCache(path string, content []byte, etag string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, content, 0644); err != nil {
+		return err
+	}
+	if etag == "" {
+		if err := os.Remove(path + ".etag"); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+	return os.WriteFile(path+".etag", []byte(etag), 0644)
+}
+
+// expandPaths expands the glob patterns among the README arguments, e.g.
+// "docs/*.md", keeping the order they were given in.  URLs and "-" are kept
+// as they are.
+func expandPaths(args []string) ([]string, error) {
+	var paths []string
+	for _, arg := range args {
+		if arg == "-" || isRemote(arg) || !strings.ContainsAny(arg, "*?[") {
+			paths = append(paths, arg)
+			continue
+		}
+		matches, err := filepath.Glob(arg)
+		if err != nil {
+			return nil, err
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("no files match %s", arg)
+		}
+		paths = append(paths, matches...)
+	}
+	return paths, nil
+}
+
+// writeHTML writes the page of the runs reported so far to path.
+func writeHTML(path string, report *readmerunner.HTMLReport) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := report.WriteTo(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// loadREADME reads a README from a file, a URL, or stdin when path is "-".
+// Warnings about the cache of remote READMEs are written to stderr.
+func loadREADME(path string, stdin io.Reader, offline bool, stderr io.Writer) ([]byte, error) {
+	switch {
+	case path == "-":
+		return io.ReadAll(stdin)
+	case isRemote(path):
+		return loadRemote(path, offline, stderr)
+	default:
+		return os.ReadFile(path)
+	}
+}
+
+// hunkRe matches the header of a unified diff hunk, capturing the start and
+// length of the changed lines in the new file, e.g. "@@ -3,2 +4,5 @@".
+var hunkRe = regexp.MustCompile(`^@@ -\d+(?:,\d+)? \+(\d+)(?:,(\d+))? @@`)
+
+// parseDiffRanges returns the lines of the new file changed by a unified diff.
+// Deleted lines are reported as the line before the deletion so that the
+// section they were removed from still counts as changed.
+func parseDiffRanges(diff string) []readmerunner.LineRange {
+	var ranges []readmerunner.LineRange
+	for _, line := range strings.Split(diff, "\n") {
+		m := hunkRe.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		start, _ := strconv.Atoi(m[1])
+		length := 1
+		if m[2] != "" {
+			length, _ = strconv.Atoi(m[2])
+		}
+		if length == 0 {
+			ranges = append(ranges, readmerunner.LineRange{Start: max(start, 1), End: max(start, 1)})
+			continue
+		}
+		ranges = append(ranges, readmerunner.LineRange{Start: start, End: start + length - 1})
+	}
+	return ranges
+}
+
+// changedRanges returns the lines of the file at path that changed since the
+// git ref.
+func changedRanges(ref, path string) ([]readmerunner.LineRange, error) {
+	cmd := exec.Command("git", "diff", "--unified=0", ref, "--", filepath.Base(path))
+	cmd.Dir = filepath.Dir(path)
+	out, err := cmd.Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return nil, fmt.Errorf("git diff: %s", strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return nil, err
+	}
+	return parseDiffRanges(string(out)), nil
+}
+
+// localeLanguage returns the language code of the user's locale, e.g. "fr"
+// for LANG=fr_FR.UTF-8, or "" if no locale is set.
+func localeLanguage() string {
+	for _, name := range []string{"LC_ALL", "LC_MESSAGES", "LANG"} {
+		if locale := os.Getenv(name); locale != "" {
+			lang, _, _ := strings.Cut(locale, ".")
+			lang, _, _ = strings.Cut(lang, "_")
+			return strings.ToLower(lang)
+		}
+	}
+	return ""
+}
+
+// answerFlags collects repeated --answer key=value flags.
+type answerFlags map[string]string
+
+func (a answerFlags) String() string {
+	pairs := make([]string, 0, len(a))
+	for k, v := range a {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func (a answerFlags) Set(value string) error {
+	key, val, ok := strings.Cut(value, "=")
+	key = strings.TrimSpace(key)
+	if !ok || key == "" {
+		return fmt.Errorf("invalid answer %q, expected key=value", value)
+	}
+	a[key] = val
+	return nil
+}
+
+// preambleFlags collects repeated --preamble language=code flags.
+type preambleFlags map[string]string
+
+func (p preambleFlags) String() string {
+	pairs := make([]string, 0, len(p))
+	for k, v := range p {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func (p preambleFlags) Set(value string) error {
+	lang, code, ok := strings.Cut(value, "=")
+	lang = strings.TrimSpace(lang)
+	if !ok || lang == "" {
+		return fmt.Errorf("invalid preamble %q, expected language=code", value)
+	}
+	// Several preambles for a language run one after the other.
+	if p[lang] != "" {
+		code = p[lang] + "\n" + code
+	}
+	p[lang] = code
+	return nil
+}
+
+// transcriptEntry is a prompt shown during a run and the response given,
+// stored one JSON object per line by --transcript.
+type transcriptEntry struct {
+	Prompt   string `json:"prompt"`
+	Response string `json:"response"`
+}
+
+// recordPrompt wraps promptFunc so that every prompt and its response is
+// written to w.
+func recordPrompt(w io.Writer, promptFunc func(string) string) func(string) string {
+	enc := json.NewEncoder(w)
+	return func(msg string) string {
+		response := promptFunc(msg)
+		if err := enc.Encode(transcriptEntry{Prompt: msg, Response: response}); err != nil {
+			log.Println("Error writing transcript:", err)
+		}
+		return response
+	}
+}
+
+// loadTranscript reads the entries written by recordPrompt.
+func loadTranscript(path string) ([]transcriptEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var entries []transcriptEntry
+	dec := json.NewDecoder(f)
+	for {
+		var entry transcriptEntry
+		if err := dec.Decode(&entry); err == io.EOF {
+			return entries, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		entries = append(entries, entry)
+	}
+}
+
+// replayPrompt answers prompts with the recorded responses, in order, and
+// falls back to promptFunc once they run out.  A response recorded for a
+// different prompt is still used, with a warning, since the README may have
+// changed since the transcript was made.
+func replayPrompt(entries []transcriptEntry, w, stderr io.Writer, promptFunc func(string) string) func(string) string {
+	return func(msg string) string {
+		if len(entries) == 0 {
+			return promptFunc(msg)
+		}
+		entry := entries[0]
+		entries = entries[1:]
+		if entry.Prompt != msg {
+			fmt.Fprintf(stderr, "Warning: replaying a response recorded for the prompt %q\n", strings.TrimSpace(entry.Prompt))
+		}
+		fmt.Fprint(w, msg)
+		return entry.Response
+	}
+}
+
 func runMain(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
 	var (
-		tocFlag     bool
-		startAnchor string
-		logFile     string
-		tags        string
+		tocFlag      bool
+		startAnchor  string
+		logFile      string
+		tags         string
+		tagOrder     string
+		pagerFlag    bool
+		themeName    string
+		auto         bool
+		trustRemote  bool
+		aliases      string
+		stripPrompts bool
+		rootPrompts  bool
+		saveAnswers  string
+		loadAnswers  string
+		language     string
+		blockList    string
+		tocDepth     int
+		tocFormat    string
+		startLine    int
+		answers      = answerFlags{}
+		pickSections bool
+		sinceTOC     bool
+		timings      bool
+		bell         bool
+		bellAfter    time.Duration
+		envFile      string
+		cleanEnv     bool
+		listCode     bool
+		validate     bool
+		checkRunners bool
+		noComplete   bool
+		offline      bool
+		logFormat    string
+		printVars    bool
+		transcript   string
+		replay       string
+		numberHeads  bool
+		changedSince string
+		uiLang       string
+		autoVerify   bool
+		confirm      bool
+		exportScript string
+		htmlPath     string
+		keepGoing    bool
+		strictLangs  bool
+		plainHeads   bool
+		themeFile    string
+		background   string
+		preambles    = preambleFlags{}
+		summary      bool
+		firstOption  bool
+		useDefaults  bool
+		promptWait   time.Duration
+		autoAdvance  time.Duration
+		echoCmds     bool
+		maxSections  int
+		repeat       int
+		repeatFresh  bool
 	)
 
 	// Create a new flag set so tests can supply arguments.
@@ -45,24 +621,194 @@ func runMain(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
 	fs.SetOutput(stderr)
 
 	fs.BoolVar(&tocFlag, "toc", false, "Print table of contents")
+	fs.IntVar(&tocDepth, "toc-depth", 0, "Only include headers up to this level in the table of contents (0 for all)")
+	fs.StringVar(&tocFormat, "toc-format", "text", "Table of contents format: text or markdown")
+	fs.BoolVar(&numberHeads, "number-headings", false, "Number headers by their level, e.g. 1, 1.1, 1.2, 2, in the table of contents and run mode")
+	fs.BoolVar(&pickSections, "interactive-toc", false, "Pick the sections to run from a numbered table of contents")
+	fs.BoolVar(&sinceTOC, "since-toc", false, "Pick the section to start running from a numbered table of contents")
 	fs.StringVar(&startAnchor, "start", "", "Anchor text where to start in run mode")
+	fs.StringVar(&changedSince, "changed-since", "", "Only run the sections of a README in a git repository changed since this git ref")
+	fs.IntVar(&startLine, "start-line", 0, "Line number where to start in run mode")
+	fs.BoolVar(&checkRunners, "check-runners", false, "Report code blocks whose language has no runner on this machine, without running anything")
+	fs.BoolVar(&validate, "validate-anchors", false, "Report internal links to anchors that don't exist, without running anything")
+	fs.BoolVar(&summary, "summary", false, "Print the number of sections, code blocks, prompts and tags, without running anything")
+	fs.BoolVar(&listCode, "list-code", false, "List the runnable code blocks without running them")
 	fs.StringVar(&logFile, "log", "readme-runner.log", "Path to log file")
+	fs.StringVar(&logFormat, "log-format", "text", "Log file format: text (a copy of the output) or json (one event per line)")
 	fs.StringVar(&tags, "tags", "", "Tags to run (comma-separated)")
+	fs.StringVar(&tagOrder, "tag-order", "", "Run the sections of these tags first, in this order (comma-separated)")
+	fs.StringVar(&themeName, "theme", "markdown", "Header and prompt style: markdown, plain, boxed, or underlined")
+	fs.StringVar(&background, "background", "auto", "Terminal background the colors should suit: dark, light, or auto to detect it from $COLORFGBG")
+	fs.StringVar(&themeFile, "theme-file", "", "Load colors for headers, prompts, code and verify results from a file of key=color lines")
+	fs.BoolVar(&plainHeads, "plain-headers", false, "Show headers as underlined text without the leading #s, like --theme underlined")
+	fs.StringVar(&aliases, "alias", "", "Fence language aliases (comma-separated alias=language)")
+	fs.BoolVar(&confirm, "confirm", false, "Summarize the code blocks and variables of the run and ask before starting")
+	fs.BoolVar(&cleanEnv, "clean-env", false, "Start the shells with only PATH and a few essentials such as HOME from the environment")
+	fs.StringVar(&envFile, "env-file", "", "Export the KEY=VALUE pairs in a .env file to the code blocks")
+	fs.StringVar(&htmlPath, "html", "", "Write the run, with the output of each code block and the prompt answers, to an HTML page")
+	fs.StringVar(&exportScript, "export-script", "", "Write the shell code blocks that would run to an executable script instead of running them")
+	fs.StringVar(&uiLang, "lang-ui", "", "Language of the prompts and messages, e.g. en or fr (default from the locale)")
+	fs.StringVar(&language, "lang", "", "Only run code blocks of this language")
+	fs.StringVar(&blockList, "blocks", "", "Only run the code blocks with these numbers, as listed by --list-code, e.g. 1,3-5")
+	fs.BoolVar(&auto, "auto", false, "Run all code blocks and use prompt defaults without asking")
+	fs.DurationVar(&autoAdvance, "auto-advance", 0, "Continue by itself when nothing is typed at a continue prompt within this duration, e.g. 10s")
+	fs.BoolVar(&strictLangs, "strict-languages", false, "Stop with an error at a code block whose language has no runner and isn't display-only")
+	fs.BoolVar(&keepGoing, "keep-going", false, "With --auto, run the remaining code blocks after one fails and list the failures at the end")
+	fs.BoolVar(&autoVerify, "auto-verify", false, "Run verify blocks without asking when the code block before them ran")
+	fs.BoolVar(&echoCmds, "echo-commands", false, "Print each command of a shell block, prefixed with $, before its output")
+	fs.BoolVar(&stripPrompts, "strip-prompts", true, "Strip leading prompt markers ($, >) from shell sessions before running")
+	fs.BoolVar(&rootPrompts, "root-prompts", false, "Also strip \"# \" root prompts from shell blocks made only of # and > lines")
+	fs.BoolVar(&printVars, "print-vars", false, "Print the prompt answers at the end of the run, redacting secrets")
+	fs.StringVar(&saveAnswers, "save-answers", "", "Save prompt answers to a file (JSON if it ends in .json, otherwise KEY=VALUE)")
+	fs.Var(answers, "answer", "Answer a prompt without asking, as key=value (repeatable)")
+	fs.Var(preambles, "preamble", "Run code ahead of every code block of a language, as language=code (repeatable)")
+	fs.BoolVar(&useDefaults, "defaults", false, "Answer every prompt with its default without asking, failing before the run if a prompt has none")
+	fs.BoolVar(&firstOption, "first-option-default", false, "Use the first option of prompts that have options but no default when Enter is pressed")
+	fs.IntVar(&repeat, "repeat", 1, "Run the README this many times, e.g. to stress-test its setup steps")
+	fs.BoolVar(&repeatFresh, "repeat-fresh", false, "Start new shells for each --repeat iteration instead of keeping the shell state")
+	fs.IntVar(&maxSections, "max-sections", 0, "Stop after this many sections, counted after --start and --tags (0 for all)")
+	fs.DurationVar(&promptWait, "prompt-timeout", 0, "Use a prompt's default if it isn't answered within this duration, e.g. 30s")
+	fs.StringVar(&loadAnswers, "load-answers", "", "Use answers saved with --save-answers as prompt defaults")
+	fs.BoolVar(&bell, "bell", false, "Ring the terminal bell when a code block that ran for a while completes")
+	fs.DurationVar(&bellAfter, "bell-after", 5*time.Second, "With --bell, how long a code block must run for the bell to ring")
+	fs.BoolVar(&timings, "timings", false, "Print how long each code block took and a summary at the end")
+	fs.BoolVar(&noComplete, "no-complete-message", false, "Don't print \"README complete!\" at the end of the run")
+	fs.BoolVar(&offline, "offline", false, "Run remote READMEs from the cache instead of fetching them")
+	fs.BoolVar(&trustRemote, "trust-remote", false, "Run remote READMEs without asking first, as --auto requires")
+	fs.StringVar(&transcript, "transcript", "", "Record every prompt and the response given to a file for --replay")
+	fs.StringVar(&replay, "replay", "", "Answer prompts with the responses recorded by --transcript instead of asking")
+	fs.BoolVar(&pagerFlag, "pager", false, "Page long sections through $PAGER (default \"less -R\")")
 	if err := fs.Parse(args); err != nil {
 		fmt.Fprintln(stderr, "Error parsing flags:", err)
 		return 1
 	}
 
-	if fs.NArg() != 1 {
-		fmt.Fprintln(stderr, "Usage: readme-runner [options] <README.md>")
+	if plainHeads {
+		if themeName != string(readmerunner.ThemeMarkdown) {
+			fmt.Fprintln(stderr, "Error parsing flags: --plain-headers can't be combined with --theme")
+			return 1
+		}
+		themeName = string(readmerunner.ThemeUnderlined)
+	}
+	theme, err := readmerunner.ParseTheme(themeName)
+	if err != nil {
+		fmt.Fprintln(stderr, "Error parsing flags:", err)
+		return 1
+	}
+	if background == "auto" {
+		background = readmerunner.DetectBackground()
+	}
+	if background != "" {
+		colors, err := readmerunner.BackgroundColors(background)
+		if err != nil {
+			fmt.Fprintln(stderr, "Error parsing flags:", err)
+			return 1
+		}
+		// A theme file sets the colors itself.
+		if themeFile == "" {
+			readmerunner.SetColors(colors)
+			defer readmerunner.SetColors(readmerunner.DefaultColors)
+		}
+	}
+	if themeFile != "" {
+		colors, err := readmerunner.LoadColors(themeFile)
+		if err != nil {
+			fmt.Fprintln(stderr, "Error loading theme file:", err)
+			return 1
+		}
+		readmerunner.SetColors(colors)
+		defer readmerunner.SetColors(readmerunner.DefaultColors)
+	}
+	if cleanEnv {
+		readmerunner.SetCleanEnv(true)
+		defer readmerunner.SetCleanEnv(false)
+	}
+
+	blocks, err := readmerunner.ParseBlocks(blockList)
+	if err != nil {
+		fmt.Fprintln(stderr, "Error parsing flags:", err)
+		return 1
+	}
+
+	if tocFormat != string(readmerunner.TOCText) && tocFormat != string(readmerunner.TOCMarkdown) {
+		fmt.Fprintln(stderr, "Error parsing flags: unknown toc format", tocFormat)
+		return 1
+	}
+
+	if logFormat != "text" && logFormat != "json" {
+		fmt.Fprintln(stderr, "Error parsing flags: unknown log format", logFormat)
+		return 1
+	}
+
+	messages := readmerunner.DefaultMessages
+	if uiLang != "" {
+		var ok bool
+		if messages, ok = readmerunner.MessagesFor(uiLang); !ok {
+			fmt.Fprintln(stderr, "Error parsing flags: no translation for language", uiLang)
+			return 1
+		}
+	} else if m, ok := readmerunner.MessagesFor(localeLanguage()); ok {
+		messages = m
+	}
+
+	if pickSections && auto {
+		fmt.Fprintln(stderr, "Error parsing flags: --interactive-toc can't be used with --auto")
+		return 1
+	}
+	if sinceTOC && (auto || startAnchor != "") {
+		fmt.Fprintln(stderr, "Error parsing flags: --since-toc can't be used with --auto or --start")
+		return 1
+	}
+
+	aliasMap, err := parseAliases(aliases)
+	if err != nil {
+		fmt.Fprintln(stderr, "Error parsing flags:", err)
+		return 1
+	}
+	for alias, lang := range aliasMap {
+		defer readmerunner.SetLanguageAlias(alias, lang)()
+	}
+
+	if fs.NArg() == 0 {
+		fmt.Fprintln(stderr, "Usage: readme-runner [options] <README.md|URL|->...")
+		return 1
+	}
+	paths, err := expandPaths(fs.Args())
+	if err != nil {
+		fmt.Fprintln(stderr, "Error reading file:", err)
+		return 1
+	}
+	if len(paths) > 1 && slices.Contains(paths, "-") {
+		fmt.Fprintln(stderr, "Error parsing flags: - can't be combined with other READMEs")
 		return 1
 	}
-	readmePath := fs.Arg(0)
-	mdContent, err := os.ReadFile(readmePath)
+	readmePath := paths[0]
+	mdContent, err := loadREADME(readmePath, stdin, offline, stderr)
 	if err != nil {
 		fmt.Fprintln(stderr, "Error reading file:", err)
 		return 1
 	}
+	startAnchor, err = readmerunner.ResolveStartAnchor(mdContent, startAnchor)
+	if err != nil {
+		fmt.Fprintln(stderr, "Error parsing flags:", err)
+		return 1
+	}
+	// stdin is used up by the README, so interactive answers have to come
+	// from the terminal instead.
+	runMode := !tocFlag && !listCode && !validate && !checkRunners && !summary && exportScript == ""
+	if len(paths) > 1 && !runMode {
+		fmt.Fprintln(stderr, "Error parsing flags: only one README can be given without running it")
+		return 1
+	}
+	if readmePath == "-" && runMode && !auto {
+		tty, err := openTTY()
+		if err != nil {
+			fmt.Fprintln(stderr, "Error reading README from stdin: use --auto or run from a terminal:", err)
+			return 1
+		}
+		defer tty.Close()
+		stdin = tty
+	}
 
 	// Open the log file for appending. Create it if it doesn't exist.
 	logF, err := os.OpenFile(logFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
@@ -72,11 +818,74 @@ func runMain(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
 	}
 	defer logF.Close()
 
-	// Use a multiwriter to output to both stdout and the log file.
+	// Don't leave orphaned shells behind, whether the run finishes or is
+	// interrupted.
+	defer readmerunner.CloseRunners()
+	stop := handleInterrupts(readmerunner.InterruptRunning, func() {
+		readmerunner.CloseRunners()
+		logF.Sync()
+	}, os.Exit)
+	defer stop()
+
+	// Use a multiwriter to output to both stdout and the log file.  A JSON
+	// log gets events instead of a copy of the output.
 	multiOut := io.MultiWriter(stdout, logF)
+	if logFormat == "json" {
+		multiOut = stdout
+	}
 
-	if tocFlag {
-		err = readmerunner.PrintTOC(multiOut, mdContent)
+	if validate {
+		broken := readmerunner.CheckAnchors(mdContent)
+		for _, link := range broken {
+			fmt.Fprintf(multiOut, "%s:%d: link to missing anchor #%s\n", readmePath, link.Line, link.Anchor)
+		}
+		if len(broken) > 0 {
+			return 1
+		}
+	} else if checkRunners {
+		missing := readmerunner.CheckRunners(mdContent)
+		for _, block := range missing {
+			lang := block.Language
+			if lang == "" {
+				lang = "(no language)"
+			}
+			fmt.Fprintf(multiOut, "%s:%d: no runner for %s code block\n", readmePath, block.Line, lang)
+		}
+		if len(missing) > 0 {
+			return 1
+		}
+	} else if exportScript != "" {
+		var script bytes.Buffer
+		err := readmerunner.ExportScript(&script, mdContent, readmerunner.Options{
+			StartAnchor: startAnchor,
+			StartLine:   startLine,
+			Tags:        parseInputTags(tags),
+			TagOrder:    parseInputTags(tagOrder),
+			Language:    language,
+			KeepPrompts: !stripPrompts,
+			RootPrompts: rootPrompts,
+		})
+		if err == nil {
+			err = os.WriteFile(exportScript, script.Bytes(), 0755)
+		}
+		if err != nil {
+			fmt.Fprintln(stderr, "Error exporting script:", err)
+			return 1
+		}
+		fmt.Fprintf(multiOut, "> Wrote %s\n", exportScript)
+	} else if summary {
+		fmt.Fprintln(multiOut, readmerunner.SummarizeDocument(mdContent))
+	} else if listCode {
+		if err := readmerunner.PrintCodeBlocks(multiOut, mdContent, language); err != nil {
+			fmt.Fprintln(stderr, "Error listing code blocks:", err)
+			return 1
+		}
+	} else if tocFlag {
+		err = readmerunner.PrintTOCWithOptions(multiOut, mdContent, readmerunner.TOCOptions{
+			Depth:          tocDepth,
+			Format:         readmerunner.TOCFormat(tocFormat),
+			NumberHeadings: numberHeads,
+		})
 		if err != nil {
 			fmt.Fprintln(stderr, "Error printing TOC:", err)
 			return 1
@@ -86,9 +895,229 @@ func runMain(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
 		promptFunc := func(msg string) string {
 			return defaultPrompt(reader, stdout, msg)
 		}
-		err = readmerunner.RunMarkdown(mdContent, startAnchor, parseInputTags(tags), multiOut, promptFunc)
-		if err != nil {
-			log.Println("Error running markdown:", err)
+		if replay != "" {
+			entries, err := loadTranscript(replay)
+			if err != nil {
+				fmt.Fprintln(stderr, "Error loading transcript:", err)
+				return 1
+			}
+			promptFunc = replayPrompt(entries, stdout, stderr, promptFunc)
+		}
+		if transcript != "" {
+			f, err := os.Create(transcript)
+			if err != nil {
+				fmt.Fprintln(stderr, "Error creating transcript:", err)
+				return 1
+			}
+			defer f.Close()
+			promptFunc = recordPrompt(f, promptFunc)
+		}
+		// The bell only rings after a block that ran for a while.
+		var bellDelay time.Duration
+		if bell {
+			bellDelay = bellAfter
+		}
+		opts := readmerunner.Options{
+			StartAnchor:         startAnchor,
+			StartLine:           startLine,
+			Tags:                parseInputTags(tags),
+			TagOrder:            parseInputTags(tagOrder),
+			Theme:               theme,
+			NumberHeadings:      numberHeads,
+			MaxSections:         maxSections,
+			Repeat:              repeat,
+			FreshShells:         repeatFresh,
+			Messages:            messages,
+			Language:            language,
+			Blocks:              blocks,
+			Auto:                auto,
+			StopOnFailure:       !keepGoing,
+			StrictLanguages:     strictLangs,
+			AutoVerify:          autoVerify,
+			KeepPrompts:         !stripPrompts,
+			RootPrompts:         rootPrompts,
+			EchoCommands:        echoCmds,
+			Preambles:           preambles,
+			FirstOptionDefault:  firstOption,
+			UseDefaults:         useDefaults,
+			PromptTimeout:       promptWait,
+			AutoAdvance:         autoAdvance,
+			Answers:             map[string]string{},
+			CarriedAnswers:      map[string]string{},
+			Timings:             timings,
+			Bell:                bellDelay,
+			OmitCompleteMessage: noComplete,
+			PrintVars:           printVars,
+		}
+		for k, v := range answers {
+			opts.Answers[k] = v
+		}
+		if envFile != "" {
+			opts.Env, err = readmerunner.LoadEnvFile(envFile)
+			if err != nil {
+				fmt.Fprintln(stderr, "Error loading env file:", err)
+				return 1
+			}
+		}
+		if loadAnswers != "" {
+			opts.Defaults, err = readmerunner.LoadAnswers(loadAnswers)
+			if err != nil {
+				fmt.Fprintln(stderr, "Error loading answers:", err)
+				return 1
+			}
+		}
+		if editor := os.Getenv("EDITOR"); editor != "" {
+			opts.Editor = func(code string) (string, error) {
+				return runEditor(editor, code, stdout, stderr)
+			}
+		}
+		if clipboard := clipboardCommand(); clipboard != "" {
+			opts.Clipboard = func(text string) error {
+				return runClipboard(clipboard, text, stderr)
+			}
+		}
+		// Only page when a user is actually looking at the output.
+		if pagerFlag && isTerminal(stdout) {
+			pager := pagerCommand()
+			opts.Pager = func(content string) error {
+				if err := runPager(pager, content, stdout, stderr); err != nil {
+					return err
+				}
+				if logFormat == "json" {
+					return nil
+				}
+				_, err := fmt.Fprint(logF, content)
+				return err
+			}
+		}
+		if logFormat == "json" {
+			enc := json.NewEncoder(logF)
+			opts.OnEvent = func(e readmerunner.Event) {
+				if err := enc.Encode(e); err != nil {
+					log.Println("Error writing log:", err)
+				}
+			}
+		}
+		var report *readmerunner.HTMLReport
+		if htmlPath != "" {
+			report = &readmerunner.HTMLReport{}
+			logEvent := opts.OnEvent
+			opts.OnEvent = func(e readmerunner.Event) {
+				if logEvent != nil {
+					logEvent(e)
+				}
+				report.Record(e)
+			}
+			opts.OnSection = report.RecordSection
+		}
+
+		// Several READMEs run one after the other in the same shells, and a
+		// prompt answered in one isn't asked again in the next.
+		savedAnswers := map[string]string{}
+		failures := 0
+		if auto && !trustRemote {
+			for _, readmePath := range paths {
+				if isRemote(readmePath) {
+					fmt.Fprintf(stderr, "Error: %s is a remote README, --auto only runs remote code with --trust-remote\n", readmePath)
+					return 1
+				}
+			}
+		}
+		for i, readmePath := range paths {
+			if i > 0 {
+				if mdContent, err = loadREADME(readmePath, stdin, offline, stderr); err != nil {
+					fmt.Fprintln(stderr, "Error reading file:", err)
+					return 1
+				}
+				// --start and --start-line only apply to the first README.
+				opts.StartAnchor, opts.StartLine = "", 0
+				fmt.Fprintf(multiOut, "\n> Running %s\n\n", readmePath)
+			}
+			// Code from elsewhere shouldn't run without the user knowing.
+			if isRemote(readmePath) {
+				fmt.Fprintf(stderr, "Warning: %s is a remote README, its code blocks run on this machine\n", readmePath)
+				if !trustRemote && strings.ToLower(promptFunc("> Type 'yes' to continue: ")) != "yes" {
+					fmt.Fprintln(stderr, "Aborted")
+					return 1
+				}
+			}
+			if changedSince != "" {
+				if readmePath == "-" || isRemote(readmePath) {
+					fmt.Fprintln(stderr, "Error: --changed-since needs a README in a git repository")
+					return 1
+				}
+				opts.LineRanges, err = changedRanges(changedSince, readmePath)
+				if err != nil {
+					fmt.Fprintln(stderr, "Error finding changed sections:", err)
+					return 1
+				}
+				if len(opts.LineRanges) == 0 {
+					fmt.Fprintf(multiOut, "> No sections changed since %s\n", changedSince)
+					continue
+				}
+			}
+			if sinceTOC {
+				opts.StartAnchor, err = selectStart(mdContent, tocDepth, multiOut, promptFunc)
+				if err != nil {
+					fmt.Fprintln(stderr, "Error selecting start:", err)
+					return 1
+				}
+			}
+			if pickSections {
+				opts.Sections, err = selectSections(mdContent, tocDepth, multiOut, promptFunc)
+				if err != nil {
+					fmt.Fprintln(stderr, "Error selecting sections:", err)
+					return 1
+				}
+			}
+			if confirm {
+				fmt.Fprintln(multiOut, readmerunner.SummarizeRun(mdContent, opts))
+				if answer := strings.ToLower(promptFunc("> Proceed? (yes/no) [default no]: ")); answer != "y" && answer != "yes" {
+					fmt.Fprintln(stderr, "Aborted")
+					return 1
+				}
+			}
+			result, err := readmerunner.RunMarkdownWithOptions(mdContent, opts, multiOut, promptFunc)
+			// The page is rewritten after each README so that it's there
+			// even if the run stops early.
+			if report != nil {
+				report.AddRun(mdContent, result)
+				if err := writeHTML(htmlPath, report); err != nil {
+					fmt.Fprintln(stderr, "Error writing HTML:", err)
+					return 1
+				}
+			}
+			if errors.Is(err, readmerunner.ErrBlockFailed) {
+				fmt.Fprintf(stderr, "Stopped: %v (use --keep-going to run the remaining blocks)\n", err)
+				return 1
+			}
+			if errors.Is(err, readmerunner.ErrUnknownLanguage) || errors.Is(err, readmerunner.ErrNoDefault) ||
+				errors.Is(err, readmerunner.ErrUnknownBlock) {
+				fmt.Fprintln(stderr, "Error:", err)
+				return 1
+			}
+			if err != nil {
+				log.Println("Error running markdown:", err)
+				return 1
+			}
+			for k, v := range result.Answers {
+				opts.CarriedAnswers[k] = v
+				savedAnswers[k] = v
+			}
+			failures += len(result.Failures)
+			if result.ExitedEarly {
+				break
+			}
+		}
+		if saveAnswers != "" {
+			if err := readmerunner.SaveAnswers(saveAnswers, savedAnswers); err != nil {
+				fmt.Fprintln(stderr, "Error saving answers:", err)
+				return 1
+			}
+		}
+		// Failed blocks should fail unattended runs, e.g. in a pipeline.
+		if auto && failures > 0 {
+			fmt.Fprintf(stderr, "%d code block(s) failed\n", failures)
 			return 1
 		}
 	}
@@ -2,9 +2,20 @@ package main
 
 import (
 	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
+
+	"github.com/seanblong/readmerunner/readmerunner"
 )
 
 func TestRunMain_NoArgs(t *testing.T) {
@@ -139,3 +150,966 @@ func TestRunMain_StartAnchor(t *testing.T) {
 		t.Errorf("Expected output to not contain 'Section One', got: %s", stdout.String())
 	}
 }
+
+func TestRunMain_PagerNonTTY(t *testing.T) {
+	tmpFile, err := os.CreateTemp("", "README_pager_*.md")
+	if err != nil {
+		t.Fatalf("Error creating temp file: %v", err)
+	}
+	defer os.Remove(tmpFile.Name())
+	content := "# Intro\n\nWelcome to the README.\n"
+	if _, err := tmpFile.Write([]byte(content)); err != nil {
+		t.Fatalf("Error writing to temp file: %v", err)
+	}
+	tmpFile.Close()
+
+	// A pager that would swallow all output if it were ever invoked.
+	t.Setenv("PAGER", "cat > /dev/null")
+	stdout := new(bytes.Buffer)
+	stderr := new(bytes.Buffer)
+	exitCode := runMain([]string{"--pager", tmpFile.Name()}, strings.NewReader(""), stdout, stderr)
+	if exitCode != 0 {
+		t.Errorf("Expected exit code 0 with pager, got %d", exitCode)
+	}
+	// stdout is not a terminal, so the pager must be bypassed.
+	if !strings.Contains(stdout.String(), "Welcome to the README.") {
+		t.Errorf("Expected output to bypass the pager, got: %s", stdout.String())
+	}
+}
+
+func TestRunMain_AutoVerifyFailure(t *testing.T) {
+	tc := []struct {
+		name     string
+		verify   string
+		exitCode int
+	}{
+		{"passing verify", "exit 0", 0},
+		{"failing verify", "exit 1", 1},
+	}
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpFile, err := os.CreateTemp("", "README_auto_*.md")
+			if err != nil {
+				t.Fatalf("Error creating temp file: %v", err)
+			}
+			defer os.Remove(tmpFile.Name())
+			content := "# Intro\n\n```verify\n" + tt.verify + "\n```\n"
+			if _, err := tmpFile.Write([]byte(content)); err != nil {
+				t.Fatalf("Error writing to temp file: %v", err)
+			}
+			tmpFile.Close()
+
+			stdout := new(bytes.Buffer)
+			stderr := new(bytes.Buffer)
+			exitCode := runMain([]string{"--auto", tmpFile.Name()}, strings.NewReader(""), stdout, stderr)
+			if exitCode != tt.exitCode {
+				t.Errorf("Expected exit code %d, got %d", tt.exitCode, exitCode)
+			}
+		})
+	}
+}
+
+func TestParseAliases(t *testing.T) {
+	aliases, err := parseAliases("zsh=sh, py=python")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if aliases["zsh"] != "sh" || aliases["py"] != "python" || len(aliases) != 2 {
+		t.Errorf("Unexpected aliases: %v", aliases)
+	}
+	if _, err := parseAliases("zsh"); err == nil {
+		t.Errorf("Expected error for alias without a language")
+	}
+}
+
+func TestParseDiffRanges(t *testing.T) {
+	diff := `diff --git a/README.md b/README.md
+index 3b18e51..a9c1f2e 100644
+--- a/README.md
++++ b/README.md
+@@ -5 +5 @@ Paragraph one.
+-old line
++new line
+@@ -9,0 +10,3 @@ Paragraph three.
++added
++more
++lines
+@@ -20,2 +22,0 @@ Section Four
+-removed
+-lines
+`
+	ranges := parseDiffRanges(diff)
+	expected := []readmerunner.LineRange{{Start: 5, End: 5}, {Start: 10, End: 12}, {Start: 22, End: 22}}
+	if !reflect.DeepEqual(ranges, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, ranges)
+	}
+}
+
+func TestRunMain_SaveLoadAnswers(t *testing.T) {
+	tmpFile, err := os.CreateTemp("", "README_answers_*.md")
+	if err != nil {
+		t.Fatalf("Error creating temp file: %v", err)
+	}
+	defer os.Remove(tmpFile.Name())
+	content := "# Intro\n\n[prompt]:# (answer_color \"Favorite color?\")\n\n```bash\necho \"color is $answer_color\"\n```\n"
+	if _, err := tmpFile.Write([]byte(content)); err != nil {
+		t.Fatalf("Error writing to temp file: %v", err)
+	}
+	tmpFile.Close()
+	answers := filepath.Join(t.TempDir(), "answers.env")
+
+	// First run answers the prompt and skips the code block.
+	stdout := new(bytes.Buffer)
+	stderr := new(bytes.Buffer)
+	exitCode := runMain([]string{"--save-answers", answers, tmpFile.Name()}, strings.NewReader("blue\ns\n"), stdout, stderr)
+	if exitCode != 0 {
+		t.Fatalf("Expected exit code 0 when saving answers, got %d: %s", exitCode, stderr.String())
+	}
+
+	// Second run consumes no input and uses the saved answer.
+	stdout = new(bytes.Buffer)
+	stderr = new(bytes.Buffer)
+	exitCode = runMain([]string{"--auto", "--load-answers", answers, tmpFile.Name()}, strings.NewReader(""), stdout, stderr)
+	if exitCode != 0 {
+		t.Fatalf("Expected exit code 0 when loading answers, got %d: %s", exitCode, stderr.String())
+	}
+	if !strings.Contains(stdout.String(), "color is blue") {
+		t.Errorf("Expected loaded answer to be used, got: %s", stdout.String())
+	}
+}
+
+func TestRunMain_Answer(t *testing.T) {
+	tmpFile, err := os.CreateTemp("", "README_answer_*.md")
+	if err != nil {
+		t.Fatalf("Error creating temp file: %v", err)
+	}
+	defer os.Remove(tmpFile.Name())
+	content := "# Intro\n\n[prompt]:# (answer_size \"Size?\" [small large])\n\n```bash\necho \"size is $answer_size\"\n```\n"
+	if _, err := tmpFile.Write([]byte(content)); err != nil {
+		t.Fatalf("Error writing to temp file: %v", err)
+	}
+	tmpFile.Close()
+
+	// The only input runs the code block; the prompt must not consume it.
+	stdout := new(bytes.Buffer)
+	stderr := new(bytes.Buffer)
+	args := []string{"--answer", "answer_size=large", "--answer", "answer_typo=x", tmpFile.Name()}
+	exitCode := runMain(args, strings.NewReader("r\n"), stdout, stderr)
+	if exitCode != 0 {
+		t.Fatalf("Expected exit code 0, got %d: %s", exitCode, stderr.String())
+	}
+	if !strings.Contains(stdout.String(), "size is large") {
+		t.Errorf("Expected supplied answer to be used, got: %s", stdout.String())
+	}
+	if !strings.Contains(stdout.String(), `no prompt found for answer "answer_typo"`) {
+		t.Errorf("Expected warning for unknown answer, got: %s", stdout.String())
+	}
+
+	exitCode = runMain([]string{"--answer", "novalue", tmpFile.Name()}, strings.NewReader(""), new(bytes.Buffer), new(bytes.Buffer))
+	if exitCode != 1 {
+		t.Errorf("Expected exit code 1 for malformed answer, got %d", exitCode)
+	}
+}
+
+func TestRunMain_HTML(t *testing.T) {
+	dir := t.TempDir()
+	readme := filepath.Join(dir, "README.md")
+	if err := os.WriteFile(readme, []byte("# Report\nSome text.\n```bash\necho from-the-block\n```\n"), 0644); err != nil {
+		t.Fatalf("Error writing README: %v", err)
+	}
+	page := filepath.Join(dir, "run.html")
+
+	stderr := new(bytes.Buffer)
+	args := []string{"--auto", "--log", filepath.Join(dir, "run.log"), "--html", page, readme}
+	if exitCode := runMain(args, strings.NewReader(""), new(bytes.Buffer), stderr); exitCode != 0 {
+		t.Fatalf("Expected exit code 0, got %d: %s", exitCode, stderr.String())
+	}
+	data, err := os.ReadFile(page)
+	if err != nil {
+		t.Fatalf("Expected the HTML page to be written: %v", err)
+	}
+	for _, want := range []string{"<h1 id=\"report\">Report</h1>", "<pre><code class=\"language-bash\">echo from-the-block</code></pre>", "<pre class=\"output\">from-the-block</pre>"} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("Expected the page to contain %q, got %s", want, data)
+		}
+	}
+}
+
+func TestRunMain_Stdin(t *testing.T) {
+	content := "# Intro\n\n```bash\necho \"from stdin\"\n```\n"
+
+	stdout := new(bytes.Buffer)
+	stderr := new(bytes.Buffer)
+	exitCode := runMain([]string{"--auto", "-"}, strings.NewReader(content), stdout, stderr)
+	if exitCode != 0 {
+		t.Fatalf("Expected exit code 0, got %d: %s", exitCode, stderr.String())
+	}
+	if !strings.Contains(stdout.String(), "from stdin") {
+		t.Errorf("Expected README from stdin to run, got: %s", stdout.String())
+	}
+
+	// Without --auto the answers need a terminal.
+	orig := openTTY
+	defer func() { openTTY = orig }()
+	openTTY = func() (io.ReadCloser, error) { return nil, errors.New("no terminal") }
+	stderr = new(bytes.Buffer)
+	exitCode = runMain([]string{"-"}, strings.NewReader(content), new(bytes.Buffer), stderr)
+	if exitCode != 1 {
+		t.Errorf("Expected exit code 1 without a terminal, got %d", exitCode)
+	}
+	if !strings.Contains(stderr.String(), "--auto") {
+		t.Errorf("Expected hint to use --auto, got: %s", stderr.String())
+	}
+}
+
+func TestRunMain_InteractiveTOC(t *testing.T) {
+	tmpFile, err := os.CreateTemp("", "README_interactive_toc_*.md")
+	if err != nil {
+		t.Fatalf("Error creating temp file: %v", err)
+	}
+	defer os.Remove(tmpFile.Name())
+	content := "# One\n```bash\necho first\n```\n# Two\n```bash\necho second\n```\n# Three\n## Nested\n```bash\necho third\n```\n"
+	if _, err := tmpFile.Write([]byte(content)); err != nil {
+		t.Fatalf("Error writing to temp file: %v", err)
+	}
+	tmpFile.Close()
+
+	// Pick sections 1 and 3, then run each code block.
+	stdin := strings.NewReader("1,3\nr\n\n\nr\n\n")
+	stdout := new(bytes.Buffer)
+	stderr := new(bytes.Buffer)
+	exitCode := runMain([]string{"--interactive-toc", tmpFile.Name()}, stdin, stdout, stderr)
+	if exitCode != 0 {
+		t.Fatalf("Expected exit code 0, got %d: %s", exitCode, stderr.String())
+	}
+	got := stdout.String()
+	if !strings.Contains(got, "1. One (one)") || !strings.Contains(got, "3. Three (three)") {
+		t.Errorf("Expected numbered table of contents, got: %s", got)
+	}
+	if !strings.Contains(got, "Output: first") || !strings.Contains(got, "Output: third") {
+		t.Errorf("Expected selected sections to run, got: %s", got)
+	}
+	if strings.Contains(got, "echo second") {
+		t.Errorf("Expected unselected section to be skipped, got: %s", got)
+	}
+
+	exitCode = runMain([]string{"--interactive-toc", tmpFile.Name()}, strings.NewReader("9\n"), new(bytes.Buffer), new(bytes.Buffer))
+	if exitCode != 1 {
+		t.Errorf("Expected exit code 1 for an unknown section, got %d", exitCode)
+	}
+}
+
+func TestRunMain_SinceTOC(t *testing.T) {
+	tmpFile, err := os.CreateTemp("", "README_since_toc_*.md")
+	if err != nil {
+		t.Fatalf("Error creating temp file: %v", err)
+	}
+	defer os.Remove(tmpFile.Name())
+	content := "# One\n```bash\necho first\n```\n# Two\n```bash\necho second\n```\n# Three\n```bash\necho third\n```\n"
+	if _, err := tmpFile.Write([]byte(content)); err != nil {
+		t.Fatalf("Error writing to temp file: %v", err)
+	}
+	tmpFile.Close()
+
+	// Start at section 2, then run each code block.
+	stdin := strings.NewReader("2\nr\n\nr\n\n")
+	stdout := new(bytes.Buffer)
+	stderr := new(bytes.Buffer)
+	exitCode := runMain([]string{"--since-toc", tmpFile.Name()}, stdin, stdout, stderr)
+	if exitCode != 0 {
+		t.Fatalf("Expected exit code 0, got %d: %s", exitCode, stderr.String())
+	}
+	got := stdout.String()
+	if !strings.Contains(got, "2. Two (two)") {
+		t.Errorf("Expected numbered table of contents, got: %s", got)
+	}
+	if strings.Contains(got, "echo first") {
+		t.Errorf("Expected sections before the start to be skipped, got: %s", got)
+	}
+	if !strings.Contains(got, "Output: second") || !strings.Contains(got, "Output: third") {
+		t.Errorf("Expected the run to start at section 2, got: %s", got)
+	}
+
+	exitCode = runMain([]string{"--since-toc", tmpFile.Name()}, strings.NewReader("0\n"), new(bytes.Buffer), new(bytes.Buffer))
+	if exitCode != 1 {
+		t.Errorf("Expected exit code 1 for an unknown section, got %d", exitCode)
+	}
+}
+
+func TestRunMain_Confirm(t *testing.T) {
+	tmpFile, err := os.CreateTemp("", "README_confirm_*.md")
+	if err != nil {
+		t.Fatalf("Error creating temp file: %v", err)
+	}
+	defer os.Remove(tmpFile.Name())
+	content := "# Setup\n[prompt]:# (name \"Name?\" bob)\n```bash\necho \"ran $name\"\n```\n```verify\ntrue\n```\n"
+	if _, err := tmpFile.Write([]byte(content)); err != nil {
+		t.Fatalf("Error writing to temp file: %v", err)
+	}
+	tmpFile.Close()
+
+	tc := []struct {
+		name     string
+		answer   string
+		exitCode int
+		ran      bool
+	}{
+		{"yes", "yes\n", 0, true},
+		{"no", "no\n", 1, false},
+		{"default", "\n", 1, false},
+	}
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			stdout := new(bytes.Buffer)
+			stderr := new(bytes.Buffer)
+			exitCode := runMain([]string{"--confirm", "--auto", tmpFile.Name()}, strings.NewReader(tt.answer), stdout, stderr)
+			if exitCode != tt.exitCode {
+				t.Fatalf("Expected exit code %d, got %d: %s", tt.exitCode, exitCode, stderr.String())
+			}
+			if !strings.Contains(stdout.String(), "This README contains 2 code blocks (1 bash, 1 verify) and will set 1 environment variable.") {
+				t.Errorf("Expected a summary of the run, got: %s", stdout.String())
+			}
+			if strings.Contains(stdout.String(), "ran bob") != tt.ran {
+				t.Errorf("Expected ran=%v, got: %s", tt.ran, stdout.String())
+			}
+		})
+	}
+}
+
+func TestRunMain_EnvFile(t *testing.T) {
+	tmpFile, err := os.CreateTemp("", "README_env_file_*.md")
+	if err != nil {
+		t.Fatalf("Error creating temp file: %v", err)
+	}
+	defer os.Remove(tmpFile.Name())
+	content := "# Intro\n\n```bash\necho \"greeting is $ENV_FILE_GREETING\"\n```\n"
+	if _, err := tmpFile.Write([]byte(content)); err != nil {
+		t.Fatalf("Error writing to temp file: %v", err)
+	}
+	tmpFile.Close()
+	envFile := filepath.Join(t.TempDir(), ".env")
+	if err := os.WriteFile(envFile, []byte("# greeting for the test\nENV_FILE_GREETING=\"hello world\"\n"), 0644); err != nil {
+		t.Fatalf("Error writing env file: %v", err)
+	}
+	// Restore the environment after the run exports the variable.
+	t.Setenv("ENV_FILE_GREETING", "")
+
+	stdout := new(bytes.Buffer)
+	stderr := new(bytes.Buffer)
+	exitCode := runMain([]string{"--auto", "--env-file", envFile, tmpFile.Name()}, strings.NewReader(""), stdout, stderr)
+	if exitCode != 0 {
+		t.Fatalf("Expected exit code 0, got %d: %s", exitCode, stderr.String())
+	}
+	if !strings.Contains(stdout.String(), "greeting is hello world") {
+		t.Errorf("Expected variable from env file, got: %s", stdout.String())
+	}
+
+	exitCode = runMain([]string{"--env-file", "/does/not/exist", tmpFile.Name()}, strings.NewReader(""), new(bytes.Buffer), new(bytes.Buffer))
+	if exitCode != 1 {
+		t.Errorf("Expected exit code 1 for a missing env file, got %d", exitCode)
+	}
+}
+
+func TestRunMain_ValidateAnchors(t *testing.T) {
+	tc := []struct {
+		name     string
+		content  string
+		exitCode int
+	}{
+		{"valid", "# Intro\nSee [setup](#setup).\n## Setup\n", 0},
+		{"dangling", "# Intro\nSee [setup](#setup) and [gone](#gone).\n## Setup\n", 1},
+	}
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpFile, err := os.CreateTemp("", "README_anchors_*.md")
+			if err != nil {
+				t.Fatalf("Error creating temp file: %v", err)
+			}
+			defer os.Remove(tmpFile.Name())
+			if _, err := tmpFile.Write([]byte(tt.content)); err != nil {
+				t.Fatalf("Error writing to temp file: %v", err)
+			}
+			tmpFile.Close()
+
+			stdout := new(bytes.Buffer)
+			exitCode := runMain([]string{"--validate-anchors", tmpFile.Name()}, strings.NewReader(""), stdout, new(bytes.Buffer))
+			if exitCode != tt.exitCode {
+				t.Errorf("Expected exit code %d, got %d", tt.exitCode, exitCode)
+			}
+			if strings.Contains(stdout.String(), "#setup") {
+				t.Errorf("Expected valid link not to be reported, got: %s", stdout.String())
+			}
+			if tt.exitCode == 1 && !strings.Contains(stdout.String(), ":2: link to missing anchor #gone") {
+				t.Errorf("Expected dangling link to be reported, got: %s", stdout.String())
+			}
+		})
+	}
+}
+
+func TestRunMain_CheckRunners(t *testing.T) {
+	tmpFile, err := os.CreateTemp("", "README_runners_*.md")
+	if err != nil {
+		t.Fatalf("Error creating temp file: %v", err)
+	}
+	defer os.Remove(tmpFile.Name())
+	if _, err := tmpFile.Write([]byte("# Intro\n```bash\necho hi\n```\n```go\nfmt.Println(\"hi\")\n```\n")); err != nil {
+		t.Fatalf("Error writing to temp file: %v", err)
+	}
+	tmpFile.Close()
+
+	stdout := new(bytes.Buffer)
+	exitCode := runMain([]string{"--check-runners", tmpFile.Name()}, strings.NewReader(""), stdout, new(bytes.Buffer))
+	if exitCode != 1 {
+		t.Errorf("Expected exit code 1, got %d", exitCode)
+	}
+	if !strings.Contains(stdout.String(), ":5: no runner for go code block") {
+		t.Errorf("Expected go block to be reported, got: %s", stdout.String())
+	}
+	if strings.Contains(stdout.String(), "echo hi") || strings.Contains(stdout.String(), "bash") {
+		t.Errorf("Expected nothing to run and bash block not to be reported, got: %s", stdout.String())
+	}
+}
+
+func TestRunMain_Remote(t *testing.T) {
+	dir := t.TempDir()
+	orig := cacheDir
+	defer func() { cacheDir = orig }()
+	cacheDir = func() (string, error) { return dir, nil }
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/README.md" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, "# Remote\n\n```bash\necho \"remote code\"\n```\n")
+	}))
+	defer server.Close()
+
+	tc := []struct {
+		name     string
+		args     []string
+		stdin    string
+		exitCode int
+		ran      bool
+	}{
+		{"confirmed", []string{server.URL + "/README.md"}, "yes\nr\n", 0, true},
+		{"declined", []string{server.URL + "/README.md"}, "no\n", 1, false},
+		{"auto", []string{"--auto", server.URL + "/README.md"}, "", 1, false},
+		{"auto trusted", []string{"--auto", "--trust-remote", server.URL + "/README.md"}, "", 0, true},
+		{"trusted", []string{"--trust-remote", server.URL + "/README.md"}, "r\n", 0, true},
+		{"not found", []string{"--auto", "--trust-remote", server.URL + "/missing.md"}, "", 1, false},
+	}
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			stdout := new(bytes.Buffer)
+			stderr := new(bytes.Buffer)
+			exitCode := runMain(tt.args, strings.NewReader(tt.stdin), stdout, stderr)
+			if exitCode != tt.exitCode {
+				t.Errorf("Expected exit code %d, got %d: %s", tt.exitCode, exitCode, stderr.String())
+			}
+			if strings.Contains(stdout.String(), "Output: remote code") != tt.ran {
+				t.Errorf("Expected code to run: %v, got: %s", tt.ran, stdout.String())
+			}
+			if tt.exitCode == 0 && !strings.Contains(stderr.String(), "remote README") {
+				t.Errorf("Expected a remote code warning, got: %s", stderr.String())
+			}
+			if tt.name == "auto" && !strings.Contains(stderr.String(), "--trust-remote") {
+				t.Errorf("Expected --trust-remote to be suggested, got: %s", stderr.String())
+			}
+			if tt.name == "not found" && !strings.Contains(stderr.String(), "404") {
+				t.Errorf("Expected the HTTP status in the error, got: %s", stderr.String())
+			}
+		})
+	}
+}
+
+func TestRunMain_Offline(t *testing.T) {
+	dir := t.TempDir()
+	orig := cacheDir
+	defer func() { cacheDir = orig }()
+	cacheDir = func() (string, error) { return dir, nil }
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "# Cached\n\n```bash\necho \"cached code\"\n```\n")
+	}))
+	url := server.URL + "/README.md"
+
+	// Nothing is cached yet.
+	stderr := new(bytes.Buffer)
+	exitCode := runMain([]string{"--auto", "--trust-remote", "--offline", url}, strings.NewReader(""), new(bytes.Buffer), stderr)
+	if exitCode != 1 || !strings.Contains(stderr.String(), "not cached") {
+		t.Errorf("Expected an error for an uncached README, got %d: %s", exitCode, stderr.String())
+	}
+
+	// Fetching caches the README, which is then served with the server down.
+	if exitCode := runMain([]string{"--auto", "--trust-remote", url}, strings.NewReader(""), new(bytes.Buffer), new(bytes.Buffer)); exitCode != 0 {
+		t.Fatalf("Expected exit code 0 when fetching, got %d", exitCode)
+	}
+	server.Close()
+	stdout := new(bytes.Buffer)
+	stderr = new(bytes.Buffer)
+	exitCode = runMain([]string{"--auto", "--trust-remote", "--offline", url}, strings.NewReader(""), stdout, stderr)
+	if exitCode != 0 {
+		t.Fatalf("Expected exit code 0 offline, got %d: %s", exitCode, stderr.String())
+	}
+	if !strings.Contains(stdout.String(), "Output: cached code") {
+		t.Errorf("Expected cached README to run, got: %s", stdout.String())
+	}
+}
+
+func TestRunMain_RemoteCache(t *testing.T) {
+	var fetched int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		fetched++
+		w.Header().Set("ETag", `"v1"`)
+		fmt.Fprint(w, "# Cached\n\n```bash\necho \"cached code\"\n```\n")
+	}))
+	defer server.Close()
+	url := server.URL + "/README.md"
+
+	tc := []struct {
+		name    string
+		dir     func(t *testing.T) string
+		fetched int
+		warning bool
+	}{
+		{
+			name:    "not modified",
+			dir:     func(t *testing.T) string { return t.TempDir() },
+			fetched: 1,
+		},
+		{
+			name: "unwritable cache",
+			dir: func(t *testing.T) string {
+				file := filepath.Join(t.TempDir(), "file")
+				if err := os.WriteFile(file, nil, 0644); err != nil {
+					t.Fatal(err)
+				}
+				return filepath.Join(file, "cache")
+			},
+			fetched: 2,
+			warning: true,
+		},
+	}
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := tt.dir(t)
+			orig := cacheDir
+			defer func() { cacheDir = orig }()
+			cacheDir = func() (string, error) { return dir, nil }
+			fetched = 0
+			for i := 0; i < 2; i++ {
+				stdout := new(bytes.Buffer)
+				stderr := new(bytes.Buffer)
+				if exitCode := runMain([]string{"--auto", "--trust-remote", url}, strings.NewReader(""), stdout, stderr); exitCode != 0 {
+					t.Fatalf("Expected exit code 0, got %d: %s", exitCode, stderr.String())
+				}
+				if !strings.Contains(stdout.String(), "Output: cached code") {
+					t.Errorf("Expected the README to run, got: %s", stdout.String())
+				}
+				if strings.Contains(stderr.String(), "could not cache") != tt.warning {
+					t.Errorf("Expected a cache warning: %v, got: %s", tt.warning, stderr.String())
+				}
+			}
+			if fetched != tt.fetched {
+				t.Errorf("Expected the README to be downloaded %d times, got %d", tt.fetched, fetched)
+			}
+		})
+	}
+}
+
+func TestRunMain_LogFormatJSON(t *testing.T) {
+	tmpFile, err := os.CreateTemp("", "README_log_json_*.md")
+	if err != nil {
+		t.Fatalf("Error creating temp file: %v", err)
+	}
+	defer os.Remove(tmpFile.Name())
+	content := "# Intro\n\n```bash\necho logged\n```\n"
+	if _, err := tmpFile.Write([]byte(content)); err != nil {
+		t.Fatalf("Error writing to temp file: %v", err)
+	}
+	tmpFile.Close()
+	logFile := filepath.Join(t.TempDir(), "run.log")
+
+	stderr := new(bytes.Buffer)
+	exitCode := runMain([]string{"--auto", "--log", logFile, "--log-format", "json", tmpFile.Name()}, strings.NewReader(""), new(bytes.Buffer), stderr)
+	if exitCode != 0 {
+		t.Fatalf("Expected exit code 0, got %d: %s", exitCode, stderr.String())
+	}
+	data, err := os.ReadFile(logFile)
+	if err != nil {
+		t.Fatalf("Error reading log: %v", err)
+	}
+	var events []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		var event map[string]any
+		if err := json.Unmarshal([]byte(line), &event); err != nil {
+			t.Fatalf("Invalid JSON log line %q: %v", line, err)
+		}
+		events = append(events, event)
+	}
+	var types []string
+	for _, event := range events {
+		types = append(types, event["event"].(string))
+		if _, ok := event["timestamp"]; !ok {
+			t.Errorf("Expected a timestamp in %v", event)
+		}
+	}
+	if want := []string{"section", "run", "complete"}; !reflect.DeepEqual(types, want) {
+		t.Fatalf("Expected events %v, got %v", want, types)
+	}
+	run := events[1]
+	if run["section"] != "Intro" || run["command"] != "echo logged" || run["exit_status"] != float64(0) {
+		t.Errorf("Unexpected run event %v", run)
+	}
+
+	if exitCode := runMain([]string{"--log-format", "xml", tmpFile.Name()}, strings.NewReader(""), new(bytes.Buffer), new(bytes.Buffer)); exitCode != 1 {
+		t.Errorf("Expected exit code 1 for an unknown log format, got %d", exitCode)
+	}
+}
+
+func TestRunMain_EditCode(t *testing.T) {
+	tmpFile, err := os.CreateTemp("", "README_edit_*.md")
+	if err != nil {
+		t.Fatalf("Error creating temp file: %v", err)
+	}
+	defer os.Remove(tmpFile.Name())
+	content := "# Intro\n\n```bash\necho \"original command\"\n```\n"
+	if _, err := tmpFile.Write([]byte(content)); err != nil {
+		t.Fatalf("Error writing to temp file: %v", err)
+	}
+	tmpFile.Close()
+
+	// A non-interactive "editor" that rewrites the block.
+	t.Setenv("EDITOR", "sed -i s/original/edited/")
+	stdout := new(bytes.Buffer)
+	stderr := new(bytes.Buffer)
+	exitCode := runMain([]string{tmpFile.Name()}, strings.NewReader("e\n\n"), stdout, stderr)
+	if exitCode != 0 {
+		t.Fatalf("Expected exit code 0, got %d: %s", exitCode, stderr.String())
+	}
+	if !strings.Contains(stdout.String(), "Output: edited command") {
+		t.Errorf("Expected the edited command to run, got: %s", stdout.String())
+	}
+}
+
+func TestRunMain_LangUI(t *testing.T) {
+	tmpFile, err := os.CreateTemp("", "README_lang_*.md")
+	if err != nil {
+		t.Fatalf("Error creating temp file: %v", err)
+	}
+	defer os.Remove(tmpFile.Name())
+	if _, err := tmpFile.Write([]byte("# Titre\n")); err != nil {
+		t.Fatalf("Error writing to temp file: %v", err)
+	}
+	tmpFile.Close()
+
+	tc := []struct {
+		name     string
+		locale   string
+		args     []string
+		exitCode int
+		expected string
+	}{
+		{"flag", "en_US.UTF-8", []string{"--lang-ui", "fr"}, 0, "README terminé !"},
+		{"locale", "fr_FR.UTF-8", nil, 0, "README terminé !"},
+		{"unknown locale", "xx_XX", nil, 0, "README complete!"},
+		{"unknown flag", "", []string{"--lang-ui", "xx"}, 1, ""},
+	}
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("LC_ALL", "")
+			t.Setenv("LC_MESSAGES", "")
+			t.Setenv("LANG", tt.locale)
+			stdout := new(bytes.Buffer)
+			args := append(append([]string{"--auto"}, tt.args...), tmpFile.Name())
+			exitCode := runMain(args, strings.NewReader(""), stdout, new(bytes.Buffer))
+			if exitCode != tt.exitCode {
+				t.Fatalf("Expected exit code %d, got %d", tt.exitCode, exitCode)
+			}
+			if !strings.Contains(stdout.String(), tt.expected) {
+				t.Errorf("Expected %q, got: %s", tt.expected, stdout.String())
+			}
+		})
+	}
+}
+
+func TestRunMain_Replay(t *testing.T) {
+	dir := t.TempDir()
+	readme := filepath.Join(dir, "README.md")
+	content := "# One\n```bash\necho first\n```\n## Two\n```bash\necho second\n```\n"
+	if err := os.WriteFile(readme, []byte(content), 0644); err != nil {
+		t.Fatalf("Error writing README: %v", err)
+	}
+	transcript := filepath.Join(dir, "transcript.jsonl")
+	logFile := filepath.Join(dir, "run.log")
+
+	recorded := new(bytes.Buffer)
+	exitCode := runMain([]string{"--log", logFile, "--transcript", transcript, readme}, strings.NewReader("r\n\ns\n"), recorded, new(bytes.Buffer))
+	if exitCode != 0 {
+		t.Fatalf("Expected exit code 0, got %d", exitCode)
+	}
+	if !strings.Contains(recorded.String(), "Output: first") || strings.Contains(recorded.String(), "Output: second") {
+		t.Fatalf("Expected only the first block to run, got: %s", recorded.String())
+	}
+
+	replayed := new(bytes.Buffer)
+	stderr := new(bytes.Buffer)
+	exitCode = runMain([]string{"--log", logFile, "--replay", transcript, readme}, strings.NewReader(""), replayed, stderr)
+	if exitCode != 0 {
+		t.Fatalf("Expected exit code 0, got %d: %s", exitCode, stderr.String())
+	}
+	if replayed.String() != recorded.String() {
+		t.Errorf("Expected replay to reproduce the session.\nRecorded: %q\nReplayed: %q", recorded.String(), replayed.String())
+	}
+	if stderr.Len() > 0 {
+		t.Errorf("Expected no warnings, got: %s", stderr.String())
+	}
+}
+
+func TestRunMain_ExportScript(t *testing.T) {
+	dir := t.TempDir()
+	readme := filepath.Join(dir, "README.md")
+	if err := os.WriteFile(readme, []byte("# Hello\n\n```bash\necho exported\n```\n"), 0644); err != nil {
+		t.Fatalf("Error writing README: %v", err)
+	}
+	script := filepath.Join(dir, "run.sh")
+
+	stdout := new(bytes.Buffer)
+	stderr := new(bytes.Buffer)
+	if exitCode := runMain([]string{"--export-script", script, readme}, strings.NewReader(""), stdout, stderr); exitCode != 0 {
+		t.Fatalf("Expected exit code 0, got %d: %s", exitCode, stderr.String())
+	}
+	if strings.Contains(stdout.String(), "Output: exported") {
+		t.Errorf("Expected nothing to run, got: %s", stdout.String())
+	}
+	info, err := os.Stat(script)
+	if err != nil {
+		t.Fatalf("Expected script to be written: %v", err)
+	}
+	if info.Mode().Perm()&0100 == 0 {
+		t.Errorf("Expected script to be executable, got mode %v", info.Mode())
+	}
+	out, err := exec.Command("bash", script).CombinedOutput()
+	if err != nil || string(out) != "exported\n" {
+		t.Errorf("Expected script to run the block, got %q: %v", out, err)
+	}
+}
+
+func TestRunMain_CopyToClipboard(t *testing.T) {
+	dir := t.TempDir()
+	readme := filepath.Join(dir, "README.md")
+	if err := os.WriteFile(readme, []byte("# Hello\n\n```console\n$ echo copied\n$ echo twice\n```\n"), 0644); err != nil {
+		t.Fatalf("Error writing README: %v", err)
+	}
+	clipboard := filepath.Join(dir, "clipboard")
+	t.Setenv("README_RUNNER_CLIPBOARD", "cat > "+clipboard)
+
+	stdout := new(bytes.Buffer)
+	stderr := new(bytes.Buffer)
+	if exitCode := runMain([]string{readme}, strings.NewReader("c\n"), stdout, stderr); exitCode != 0 {
+		t.Fatalf("Expected exit code 0, got %d: %s", exitCode, stderr.String())
+	}
+	if !strings.Contains(stdout.String(), "> Copied to the clipboard") || strings.Contains(stdout.String(), "Output: copied") {
+		t.Errorf("Expected the block to be copied rather than run, got: %s", stdout.String())
+	}
+	content, err := os.ReadFile(clipboard)
+	if err != nil {
+		t.Fatalf("Expected the clipboard command to run: %v", err)
+	}
+	if string(content) != "echo copied\necho twice\n" {
+		t.Errorf("Expected the block on the clipboard, got %q", content)
+	}
+}
+
+func TestRunMain_CustomAnchor(t *testing.T) {
+	dir := t.TempDir()
+	readme := filepath.Join(dir, "README.md")
+	content := "# Intro\n\n```bash\necho intro\n```\n\n## Setup {#install}\n\n```bash\necho setup\n```\n"
+	if err := os.WriteFile(readme, []byte(content), 0644); err != nil {
+		t.Fatalf("Error writing README: %v", err)
+	}
+
+	stdout := new(bytes.Buffer)
+	stderr := new(bytes.Buffer)
+	exitCode := runMain([]string{"--auto", "--start", "install", readme}, strings.NewReader(""), stdout, stderr)
+	if exitCode != 0 {
+		t.Fatalf("Expected exit code 0, got %d: %s", exitCode, stderr.String())
+	}
+	got := stdout.String()
+	if strings.Contains(got, "Output: intro") || !strings.Contains(got, "Output: setup") {
+		t.Errorf("Expected the run to start at the explicit anchor, got: %s", got)
+	}
+	if strings.Contains(got, "{#install}") || !strings.Contains(got, "## Setup") {
+		t.Errorf("Expected the explicit anchor to be hidden from the header, got: %s", got)
+	}
+
+	stdout.Reset()
+	if exitCode := runMain([]string{"--toc", readme}, strings.NewReader(""), stdout, stderr); exitCode != 0 {
+		t.Fatalf("Expected exit code 0, got %d: %s", exitCode, stderr.String())
+	}
+	if !strings.Contains(stdout.String(), "Setup (install)") {
+		t.Errorf("Expected the table of contents to use the explicit anchor, got: %s", stdout.String())
+	}
+}
+
+func TestRunMain_KeepGoing(t *testing.T) {
+	dir := t.TempDir()
+	readme := filepath.Join(dir, "README.md")
+	content := "# Build\n\n```bash\necho building; (exit 2)\n```\n\n# Test\n\n```bash\necho testing; false\n```\n\n# Done\n\n```bash\necho done\n```\n"
+	if err := os.WriteFile(readme, []byte(content), 0644); err != nil {
+		t.Fatalf("Error writing README: %v", err)
+	}
+
+	tc := []struct {
+		name     string
+		args     []string
+		expected []string
+		stderr   string
+	}{
+		{
+			name:     "keep going",
+			args:     []string{"--auto", "--keep-going", readme},
+			expected: []string{"Output: building", "Output: testing", "Output: done", "> Failed code blocks:\n  Build: echo building; (exit 2) (status 2)\n  Test: echo testing; false (status 1)\n"},
+			stderr:   "2 code block(s) failed",
+		},
+		{
+			name:     "stop at the first failure",
+			args:     []string{"--auto", readme},
+			expected: []string{"Output: building"},
+			stderr:   "Stopped: code block failed: echo building; (exit 2) exited with status 2",
+		},
+	}
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			stdout := new(bytes.Buffer)
+			stderr := new(bytes.Buffer)
+			if exitCode := runMain(tt.args, strings.NewReader(""), stdout, stderr); exitCode != 1 {
+				t.Errorf("Expected exit code 1, got %d", exitCode)
+			}
+			for _, want := range tt.expected {
+				if !strings.Contains(stdout.String(), want) {
+					t.Errorf("Expected output to contain %q, got: %s", want, stdout.String())
+				}
+			}
+			if !strings.Contains(stderr.String(), tt.stderr) {
+				t.Errorf("Expected stderr to contain %q, got: %s", tt.stderr, stderr.String())
+			}
+		})
+	}
+}
+
+func TestRunMain_PlainHeaders(t *testing.T) {
+	dir := t.TempDir()
+	readme := filepath.Join(dir, "README.md")
+	if err := os.WriteFile(readme, []byte("# Guide\n\n## Setup\n\nSome text.\n"), 0644); err != nil {
+		t.Fatalf("Error writing README: %v", err)
+	}
+
+	stdout := new(bytes.Buffer)
+	stderr := new(bytes.Buffer)
+	if exitCode := runMain([]string{"--auto", "--plain-headers", readme}, strings.NewReader(""), stdout, stderr); exitCode != 0 {
+		t.Fatalf("Expected exit code 0, got %d: %s", exitCode, stderr.String())
+	}
+	got := stdout.String()
+	if strings.Contains(got, "#") {
+		t.Errorf("Expected headers without #, got: %s", got)
+	}
+	if !strings.Contains(got, "GUIDE\n=====\n") || !strings.Contains(got, "Setup\n-----\n") {
+		t.Errorf("Expected underlined headers, got: %s", got)
+	}
+
+	if exitCode := runMain([]string{"--plain-headers", "--theme", "boxed", readme}, strings.NewReader(""), new(bytes.Buffer), stderr); exitCode != 1 {
+		t.Errorf("Expected exit code 1 combining --plain-headers and --theme, got %d", exitCode)
+	}
+}
+
+func TestPreambleFlags(t *testing.T) {
+	preambles := preambleFlags{}
+	for _, value := range []string{"bash=set -u", "python=import os", "bash=greet() { echo hi; }"} {
+		if err := preambles.Set(value); err != nil {
+			t.Fatalf("Unexpected error for %q: %v", value, err)
+		}
+	}
+	expected := preambleFlags{"bash": "set -u\ngreet() { echo hi; }", "python": "import os"}
+	if !reflect.DeepEqual(preambles, expected) {
+		t.Errorf("Expected %v, got %v", expected, preambles)
+	}
+	if err := preambles.Set("set -x"); err == nil {
+		t.Error("Expected an error for a preamble without a language")
+	}
+}
+
+func TestRunMain_MultipleFiles(t *testing.T) {
+	dir := t.TempDir()
+	part1 := "# Part 1\n\n[prompt]:# (PART_NAME \"Name?\" tutorial)\n\n```bash\nPART_GREETING=\"hello from part 1\"\n```\n"
+	part2 := "# Part 2\n\n[prompt]:# (PART_NAME \"Name?\" other)\n\n```bash\necho \"$PART_GREETING, $PART_NAME\"\n```\n"
+	part3 := "# Part 3\n\n```bash\necho done\n```\n"
+	for name, content := range map[string]string{"part1.md": part1, "part2.md": part2, "part3.md": part3} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("Error writing README: %v", err)
+		}
+	}
+
+	tc := []struct {
+		name string
+		args []string
+	}{
+		{"paths", []string{filepath.Join(dir, "part1.md"), filepath.Join(dir, "part2.md"), filepath.Join(dir, "part3.md")}},
+		{"glob", []string{filepath.Join(dir, "part*.md")}},
+	}
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			stdout := new(bytes.Buffer)
+			stderr := new(bytes.Buffer)
+			exitCode := runMain(append([]string{"--auto"}, tt.args...), strings.NewReader(""), stdout, stderr)
+			if exitCode != 0 {
+				t.Fatalf("Expected exit code 0, got %d: %s", exitCode, stderr.String())
+			}
+			got := stdout.String()
+			if !strings.Contains(got, "Output: hello from part 1, tutorial") {
+				t.Errorf("Expected the second README to see the first one's variables, got: %s", got)
+			}
+			if strings.Index(got, "# Part 1") > strings.Index(got, "# Part 2") {
+				t.Errorf("Expected the READMEs to run in order, got: %s", got)
+			}
+			if strings.Contains(got, "no prompt found") {
+				t.Errorf("Expected answers carried over from earlier READMEs not to be reported, got: %s", got)
+			}
+		})
+	}
+
+	stderr := new(bytes.Buffer)
+	if exitCode := runMain([]string{"--toc", filepath.Join(dir, "part*.md")}, strings.NewReader(""), new(bytes.Buffer), stderr); exitCode != 1 {
+		t.Errorf("Expected exit code 1 for several READMEs outside run mode, got %d", exitCode)
+	}
+	if exitCode := runMain([]string{"--auto", filepath.Join(dir, "missing*.md")}, strings.NewReader(""), new(bytes.Buffer), stderr); exitCode != 1 {
+		t.Errorf("Expected exit code 1 for a pattern matching nothing, got %d", exitCode)
+	}
+}
+
+func TestRunMain_Summary(t *testing.T) {
+	dir := t.TempDir()
+	readme := filepath.Join(dir, "README.md")
+	content := "# Title\n\n[prompt]:# (NAME \"Name?\" x)\n\n```bash\necho should not run\n```\n\n```python\nprint(1)\n```\n"
+	if err := os.WriteFile(readme, []byte(content), 0644); err != nil {
+		t.Fatalf("Error writing README: %v", err)
+	}
+
+	stdout := new(bytes.Buffer)
+	stderr := new(bytes.Buffer)
+	if exitCode := runMain([]string{"--summary", readme}, strings.NewReader(""), stdout, stderr); exitCode != 0 {
+		t.Fatalf("Expected exit code 0, got %d: %s", exitCode, stderr.String())
+	}
+	got := stdout.String()
+	if !strings.Contains(got, "Code blocks: 2 (1 bash, 1 python)") || !strings.Contains(got, "Prompts: 1") {
+		t.Errorf("Expected the counts of the README, got: %s", got)
+	}
+	if strings.Contains(got, "Output:") {
+		t.Errorf("Expected nothing to run, got: %s", got)
+	}
+}
@@ -0,0 +1,58 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestHandleInterrupts(t *testing.T) {
+	cleaned := make(chan struct{})
+	exited := make(chan int, 2)
+	stop := handleInterrupts(func() bool { return false }, func() { close(cleaned) }, func(code int) { exited <- code })
+	defer stop()
+
+	if err := syscall.Kill(os.Getpid(), syscall.SIGINT); err != nil {
+		t.Fatalf("Error sending interrupt: %v", err)
+	}
+	select {
+	case <-cleaned:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected cleanup to run after an interrupt")
+	}
+	select {
+	case code := <-exited:
+		if code != 130 {
+			t.Errorf("Expected exit code 130, got %d", code)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected exit after cleanup")
+	}
+}
+
+func TestHandleInterruptsRunningCommand(t *testing.T) {
+	interrupted := make(chan struct{}, 1)
+	exited := make(chan int, 2)
+	stop := handleInterrupts(func() bool {
+		interrupted <- struct{}{}
+		return true
+	}, func() {}, func(code int) { exited <- code })
+	defer stop()
+
+	if err := syscall.Kill(os.Getpid(), syscall.SIGINT); err != nil {
+		t.Fatalf("Error sending interrupt: %v", err)
+	}
+	select {
+	case <-interrupted:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the running command to be interrupted")
+	}
+	select {
+	case code := <-exited:
+		t.Errorf("Expected the program to carry on, got exit code %d", code)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
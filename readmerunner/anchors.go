@@ -0,0 +1,93 @@
+package readmerunner
+
+import (
+	"bufio"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// anchorLinkRe matches internal links such as "[Install](#install)".
+var anchorLinkRe = regexp.MustCompile(`\]\(#([^)\s]*)\)`)
+
+// BrokenAnchor is an internal link whose target isn't a header anchor in the
+// document.
+type BrokenAnchor struct {
+	// Line is the 1-based line number of the link.
+	Line int
+	// Anchor is the link target without the leading "#".
+	Anchor string
+}
+
+// ResolveStartAnchor returns the anchor of the header a run given start
+// should begin at.  An exact anchor is used as is.  Otherwise start is
+// matched, ignoring case, as part of the header texts, so that "install"
+// finds "## Installation".  It is an error if several headers match.  When
+// none do, start is returned unchanged.
+func ResolveStartAnchor(mdContent []byte, start string) (string, error) {
+	if start == "" {
+		return "", nil
+	}
+	var candidates []string
+	seen := map[string]bool{}
+	needle := strings.ToLower(start)
+	for _, sec := range parseSections(mdContent, "", nil) {
+		if sec.Type != SectionHeader {
+			continue
+		}
+		header, _ := getHeadingText(sec.Lines[0])
+		anchor := sec.Anchor
+		if anchor == start {
+			return start, nil
+		}
+		if !seen[anchor] && (strings.Contains(strings.ToLower(header), needle) || strings.Contains(anchor, needle)) {
+			seen[anchor] = true
+			candidates = append(candidates, anchor)
+		}
+	}
+	switch len(candidates) {
+	case 0:
+		return start, nil
+	case 1:
+		return candidates[0], nil
+	default:
+		return "", fmt.Errorf("start %q matches several headers: %s", start, strings.Join(candidates, ", "))
+	}
+}
+
+// CheckAnchors returns the internal links in the markdown content that don't
+// point at one of its headers.  Repeated headers have their anchors numbered
+// the way GitHub does, e.g. "setup-1".  Links inside code blocks are ignored.
+func CheckAnchors(mdContent []byte) []BrokenAnchor {
+	anchors := map[string]bool{}
+	repeats := map[string]int{}
+	for _, sec := range parseSections(mdContent, "", nil) {
+		if sec.Type != SectionHeader {
+			continue
+		}
+		anchor := sec.Anchor
+		if n := repeats[sec.Anchor]; n > 0 {
+			anchor = fmt.Sprintf("%s-%d", sec.Anchor, n)
+		}
+		repeats[sec.Anchor]++
+		anchors[anchor] = true
+	}
+
+	var broken []BrokenAnchor
+	scanner := bufio.NewScanner(strings.NewReader(stripBOM(mdContent)))
+	var fences fenceTracker
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+		if fences.inCode(strings.TrimSpace(line)) {
+			continue
+		}
+		for _, match := range anchorLinkRe.FindAllStringSubmatch(line, -1) {
+			if !anchors[match[1]] {
+				broken = append(broken, BrokenAnchor{Line: lineNo, Anchor: match[1]})
+			}
+		}
+	}
+	return broken
+}
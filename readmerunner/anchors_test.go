@@ -0,0 +1,55 @@
+package readmerunner
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCheckAnchors(t *testing.T) {
+	mdContent := []byte("# Title\nSee [install](#installing) and [usage](#usage).\n" +
+		"```markdown\n[ignored](#in-code)\n```\n## Installing\n[top](#title) [external](https://example.com/#x)\n" +
+		"~~~markdown\n[ignored](#in-tildes)\n~~~\n## Installing\n[second](#installing-1) [third](#installing-2)\n")
+
+	broken := CheckAnchors(mdContent)
+	expected := []BrokenAnchor{{Line: 2, Anchor: "usage"}, {Line: 12, Anchor: "installing-2"}}
+	if !reflect.DeepEqual(broken, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, broken)
+	}
+}
+
+func TestResolveStartAnchor(t *testing.T) {
+	mdContent := []byte("# Project\n## Installation\n## Install Check\n## Usage\n### Advanced Usage\n")
+	tc := []struct {
+		name      string
+		start     string
+		expected  string
+		expectErr bool
+	}{
+		{"empty", "", "", false},
+		{"exact", "usage", "usage", false},
+		{"unique partial", "installa", "installation", false},
+		{"case insensitive", "INSTALLATION", "installation", false},
+		{"partial word", "check", "install-check", false},
+		{"partial anchor", "advanced-", "advanced-usage", false},
+		{"ambiguous", "install", "", true},
+		{"no match", "deploy", "deploy", false},
+	}
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ResolveStartAnchor(mdContent, tt.start)
+			if tt.expectErr {
+				if err == nil || !strings.Contains(err.Error(), "installation, install-check") {
+					t.Errorf("Expected an error listing the candidates, got %q, %v", got, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if got != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,104 @@
+package readmerunner
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// SaveAnswers writes prompt answers to path.  Paths ending in ".json" are
+// written as a JSON object, anything else as KEY=VALUE lines.
+func SaveAnswers(path string, answers map[string]string) error {
+	var data []byte
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		b, err := json.MarshalIndent(answers, "", "  ")
+		if err != nil {
+			return err
+		}
+		data = append(b, '\n')
+	} else {
+		keys := make([]string, 0, len(answers))
+		for k := range answers {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		var b strings.Builder
+		for _, k := range keys {
+			fmt.Fprintf(&b, "%s=%s\n", k, quoteValue(answers[k]))
+		}
+		data = []byte(b.String())
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// LoadAnswers reads prompt answers written by SaveAnswers.
+func LoadAnswers(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if strings.HasPrefix(strings.TrimSpace(string(data)), "{") {
+		answers := map[string]string{}
+		if err := json.Unmarshal(data, &answers); err != nil {
+			return nil, fmt.Errorf("invalid answers file %s: %w", path, err)
+		}
+		return answers, nil
+	}
+	return parseEnv(string(data))
+}
+
+// LoadEnvFile reads KEY=VALUE pairs from a .env file.
+func LoadEnvFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	vars, err := parseEnv(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("invalid env file %s: %w", path, err)
+	}
+	return vars, nil
+}
+
+// parseEnv parses KEY=VALUE lines, optionally prefixed with "export".  Blank
+// lines and lines starting with "#" are ignored, double-quoted values are
+// unquoted and single-quoted values are taken literally.
+func parseEnv(content string) (map[string]string, error) {
+	vars := map[string]string{}
+	for i, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+		key, value, ok := strings.Cut(line, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("line %d: expected KEY=VALUE, got %q", i+1, line)
+		}
+		value = strings.TrimSpace(value)
+		if strings.HasPrefix(value, `"`) {
+			unquoted, err := strconv.Unquote(value)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid quoted value %s", i+1, value)
+			}
+			value = unquoted
+		} else if len(value) >= 2 && strings.HasPrefix(value, "'") && strings.HasSuffix(value, "'") {
+			value = value[1 : len(value)-1]
+		}
+		vars[key] = value
+	}
+	return vars, nil
+}
+
+// quoteValue quotes v when it can't be written as a bare value.
+func quoteValue(v string) string {
+	if v == "" || strings.ContainsAny(v, " \t\n\"'#\\") {
+		return strconv.Quote(v)
+	}
+	return v
+}
@@ -0,0 +1,60 @@
+package readmerunner
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestSaveLoadAnswers(t *testing.T) {
+	answers := map[string]string{
+		"name":     "Alice",
+		"greeting": "hello world",
+		"empty":    "",
+		"quoted":   `say "hi"`,
+	}
+	for _, file := range []string{"answers.env", "answers.json"} {
+		t.Run(file, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), file)
+			if err := SaveAnswers(path, answers); err != nil {
+				t.Fatalf("SaveAnswers returned error: %v", err)
+			}
+			loaded, err := LoadAnswers(path)
+			if err != nil {
+				t.Fatalf("LoadAnswers returned error: %v", err)
+			}
+			if !reflect.DeepEqual(loaded, answers) {
+				t.Errorf("Expected %v, got %v", answers, loaded)
+			}
+		})
+	}
+}
+
+func TestParseEnv(t *testing.T) {
+	tc := []struct {
+		name      string
+		content   string
+		expected  map[string]string
+		expectErr bool
+	}{
+		{"simple", "FOO=bar\nBAZ=qux", map[string]string{"FOO": "bar", "BAZ": "qux"}, false},
+		{"comments and blanks", "# comment\n\nFOO=bar\n", map[string]string{"FOO": "bar"}, false},
+		{"quoted", `FOO="hello world"`, map[string]string{"FOO": "hello world"}, false},
+		{"equals in value", "FOO=a=b", map[string]string{"FOO": "a=b"}, false},
+		{"single quoted", `FOO='$not "expanded"'`, map[string]string{"FOO": `$not "expanded"`}, false},
+		{"export prefix", "export FOO=bar", map[string]string{"FOO": "bar"}, false},
+		{"missing equals", "FOO", nil, true},
+		{"bad quote", `FOO="unterminated`, nil, true},
+	}
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			vars, err := parseEnv(tt.content)
+			if (err != nil) != tt.expectErr {
+				t.Fatalf("Expected error: %v, got %v", tt.expectErr, err)
+			}
+			if !tt.expectErr && !reflect.DeepEqual(vars, tt.expected) {
+				t.Errorf("Expected %v, got %v", tt.expected, vars)
+			}
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package readmerunner
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ParseBlocks parses a list of code block numbers and ranges, e.g. "1,3-5",
+// into the numbers it covers, for Options.Blocks.
+func ParseBlocks(list string) ([]int, error) {
+	var blocks []int
+	for _, part := range strings.Split(list, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		first, last, isRange := strings.Cut(part, "-")
+		start, err := strconv.Atoi(strings.TrimSpace(first))
+		if err != nil || start < 1 {
+			return nil, fmt.Errorf("invalid block number %q", part)
+		}
+		end := start
+		if isRange {
+			end, err = strconv.Atoi(strings.TrimSpace(last))
+			if err != nil || end < start {
+				return nil, fmt.Errorf("invalid block range %q", part)
+			}
+		}
+		for n := start; n <= end; n++ {
+			blocks = append(blocks, n)
+		}
+	}
+	return blocks, nil
+}
+
+// numberBlocks sets the Block number of the runnable code blocks of sections,
+// in document order.
+func numberBlocks(sections []Section) {
+	n := 0
+	for i, sec := range sections {
+		if sec.Type == SectionCode && isShellLanguage(parseFence(sec.Lines[0]).Language) {
+			n++
+			sections[i].Block = n
+		}
+	}
+}
+
+// blockSelected reports whether a code block, given by its Block number, is
+// one of Options.Blocks, or whether the run isn't limited to some blocks.
+func (s *session) blockSelected(block int) bool {
+	if len(s.opts.Blocks) == 0 {
+		return true
+	}
+	for _, n := range s.opts.Blocks {
+		if n == block {
+			return true
+		}
+	}
+	return false
+}
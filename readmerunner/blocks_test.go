@@ -0,0 +1,72 @@
+package readmerunner
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseBlocks(t *testing.T) {
+	tc := []struct {
+		name     string
+		list     string
+		expected []int
+		wantErr  bool
+	}{
+		{"empty", "", nil, false},
+		{"single", "2", []int{2}, false},
+		{"list and range", "1,3-5", []int{1, 3, 4, 5}, false},
+		{"spaces", " 1, 3 - 4 ", []int{1, 3, 4}, false},
+		{"not a number", "one", nil, true},
+		{"zero", "0", nil, true},
+		{"backwards range", "5-3", nil, true},
+	}
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			blocks, err := ParseBlocks(tt.list)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseBlocks(%q) error = %v, wantErr %v", tt.list, err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(blocks, tt.expected) {
+				t.Errorf("ParseBlocks(%q) = %v, want %v", tt.list, blocks, tt.expected)
+			}
+		})
+	}
+}
+
+func TestRunMarkdownBlocks(t *testing.T) {
+	mdContent := []byte("# One\n```bash\necho one\n```\n```json\n{}\n```\n```bash\necho two\n```\n# Two\n[tags]:# (later)\n```bash\necho three\n```\n```bash {group}\necho four\n```\n```bash {group}\necho five\n```\n")
+	tc := []struct {
+		name     string
+		opts     Options
+		expected []string
+		skipped  int
+	}{
+		{"Selected", Options{Blocks: []int{2, 4}}, []string{"two", "four"}, 3},
+		{"Numbered Before Tags", Options{Blocks: []int{3, 5}, Tags: []string{"later"}}, []string{"three", "five"}, 1},
+		{"All", Options{}, []string{"one", "two", "three", "four", "five"}, 0},
+	}
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.opts.Auto = true
+			var buf bytes.Buffer
+			result, err := RunMarkdownWithOptions(mdContent, tt.opts, &buf, fakePrompt(nil))
+			if err != nil {
+				t.Fatalf("RunMarkdownWithOptions returned error: %v", err)
+			}
+			var ran []string
+			for _, line := range strings.Split(buf.String(), "\n") {
+				if strings.HasPrefix(line, "> Output") {
+					ran = append(ran, line[strings.LastIndex(line, " ")+1:])
+				}
+			}
+			if !reflect.DeepEqual(ran, tt.expected) {
+				t.Errorf("Expected blocks %q to run, got %q", tt.expected, ran)
+			}
+			if result.BlocksSkipped != tt.skipped {
+				t.Errorf("Expected %d blocks skipped, got %d", tt.skipped, result.BlocksSkipped)
+			}
+		})
+	}
+}
@@ -0,0 +1,44 @@
+package readmerunner
+
+import (
+	"errors"
+	"os/exec"
+)
+
+// ErrUnknownLanguage is returned when Options.StrictLanguages is set and a
+// code block's language has no runner and isn't display-only, e.g. a typo
+// such as "bsah".
+var ErrUnknownLanguage = errors.New("no runner for code block language")
+
+// MissingRunner is a code block that can't be run on this machine, either
+// because its language has no runner or because the runner's interpreter
+// isn't installed.
+type MissingRunner struct {
+	// Line is the 1-based line number of the opening fence.
+	Line int
+	// Language is the fence language, empty when the fence has none.
+	Language string
+}
+
+// CheckRunners returns the code blocks of the markdown content that
+// GetRunner couldn't run, after resolving language aliases.  Display-only
+// blocks, e.g. diffs and diagrams, aren't reported.  Nothing is run.
+func CheckRunners(mdContent []byte) []MissingRunner {
+	var missing []MissingRunner
+	for _, sec := range parseSections(mdContent, "", nil) {
+		if sec.Type != SectionCode {
+			continue
+		}
+		lang := parseFence(sec.Lines[0]).Language
+		if isDisplayLanguage(lang) {
+			continue
+		}
+		if command := runnerCommand(lang); command != "" {
+			if _, err := exec.LookPath(command); err == nil {
+				continue
+			}
+		}
+		missing = append(missing, MissingRunner{Line: sec.StartLine, Language: lang})
+	}
+	return missing
+}
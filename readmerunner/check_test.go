@@ -0,0 +1,43 @@
+package readmerunner
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCheckRunners(t *testing.T) {
+	mdContent := []byte("# Title\n```bash\necho hi\n```\n```go\nfmt.Println(\"hi\")\n```\n```console\n$ ls\n```\n```\nplain\n```\n```json\n{}\n```\n")
+
+	missing := CheckRunners(mdContent)
+	expected := []MissingRunner{{Line: 5, Language: "go"}, {Line: 11, Language: ""}}
+	if !reflect.DeepEqual(missing, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, missing)
+	}
+}
+
+func TestRunnerCommand(t *testing.T) {
+	defer CloseRunners()
+	tc := []struct {
+		language string
+		expected string
+	}{
+		{"bash", "bash"},
+		{"console", "bash"},
+		{"verify", "bash"},
+		{"sh", "sh"},
+		{"shell", "sh"},
+		{"go", ""},
+		{"", ""},
+	}
+	for _, tt := range tc {
+		t.Run(tt.language, func(t *testing.T) {
+			got := runnerCommand(tt.language)
+			if got != tt.expected {
+				t.Fatalf("runnerCommand(%q) = %q, want %q", tt.language, got, tt.expected)
+			}
+			if (GetRunner(tt.language) != nil) != (got != "") {
+				t.Errorf("GetRunner(%q) disagrees with runnerCommand %q", tt.language, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,236 @@
+package readmerunner
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Colors holds the ANSI colors used in run mode, as SGR parameters such as
+// "32" for green or "1;34" for bold blue.  An empty color leaves the text as
+// is.
+type Colors struct {
+	// Header colors headers.
+	Header string
+	// Prompt colors the prompts asking the user what to do.
+	Prompt string
+	// Code colors the lines of code blocks other than diffs.
+	Code string
+	// Success colors the result of a passing verify block.
+	Success string
+	// Failure colors the result of a failing verify block.
+	Failure string
+	// Warning colors the caution shown for code blocks using sudo.
+	Warning string
+	// Danger colors the warning shown for {danger} code blocks.
+	Danger string
+	// Added colors the added lines of diffs, including expected output.
+	Added string
+	// Removed colors the removed lines of diffs, including expected output.
+	Removed string
+	// Hunk colors the "@@" hunk headers of diffs.
+	Hunk string
+	// DiffHeader colors the "---" and "+++" file headers of diffs.
+	DiffHeader string
+}
+
+// DefaultColors holds the colors used unless SetColors is called.
+var DefaultColors = Colors{
+	Success:    "32",
+	Failure:    "31",
+	Warning:    "33",
+	Danger:     "31",
+	Added:      "32",
+	Removed:    "31",
+	Hunk:       "36",
+	DiffHeader: "1",
+}
+
+// DarkColors holds colors that stand out on a dark background, using the
+// bright variants of DefaultColors.
+var DarkColors = Colors{
+	Success:    "92",
+	Failure:    "91",
+	Warning:    "93",
+	Danger:     "91",
+	Added:      "92",
+	Removed:    "91",
+	Hunk:       "96",
+	DiffHeader: "1",
+}
+
+// LightColors holds colors that are readable on a light background, where
+// yellow and cyan are faint, using bold and darker colors instead.
+var LightColors = Colors{
+	Success:    "1;32",
+	Failure:    "1;31",
+	Warning:    "1;35",
+	Danger:     "1;31",
+	Added:      "32",
+	Removed:    "31",
+	Hunk:       "34",
+	DiffHeader: "1",
+}
+
+// BackgroundColors returns the colors for a terminal background, "dark" or
+// "light".
+func BackgroundColors(background string) (Colors, error) {
+	switch strings.ToLower(background) {
+	case "dark":
+		return DarkColors, nil
+	case "light":
+		return LightColors, nil
+	}
+	return DefaultColors, fmt.Errorf("unknown background %q", background)
+}
+
+// DetectBackground returns "dark" or "light" from the background color that
+// some terminals export in $COLORFGBG, e.g. "15;0" for white on black, or ""
+// if it isn't known.
+func DetectBackground() string {
+	fields := strings.Split(os.Getenv("COLORFGBG"), ";")
+	bg, err := strconv.Atoi(fields[len(fields)-1])
+	if err != nil {
+		return ""
+	}
+	// Of the 16 basic colors, light gray and white are light backgrounds and
+	// the dark colors, including dark gray, are dark ones.
+	switch {
+	case bg == 7 || bg == 15:
+		return "light"
+	case bg >= 0 && bg <= 8:
+		return "dark"
+	}
+	return ""
+}
+
+// colors holds the colors in use.
+var colors = DefaultColors
+
+// SetColors replaces the colors used in run mode, e.g. with those loaded by
+// LoadColors.
+func SetColors(c Colors) {
+	colors = c
+}
+
+// colorNames maps the color names accepted in a theme file to their SGR
+// parameters.
+var colorNames = map[string]string{
+	"none":    "",
+	"bold":    "1",
+	"black":   "30",
+	"red":     "31",
+	"green":   "32",
+	"yellow":  "33",
+	"blue":    "34",
+	"magenta": "35",
+	"cyan":    "36",
+	"white":   "37",
+	"gray":    "90",
+}
+
+// sgrRe matches raw SGR parameters such as "1;34".
+var sgrRe = regexp.MustCompile(`^\d+(;\d+)*$`)
+
+// parseColor returns the SGR parameters of a color given by name, e.g.
+// "yellow" or "bold blue", or as raw parameters, e.g. "1;34".
+func parseColor(value string) (string, error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	if sgrRe.MatchString(value) {
+		return value, nil
+	}
+	var params []string
+	for _, name := range strings.Fields(value) {
+		param, ok := colorNames[name]
+		if !ok {
+			return "", fmt.Errorf("unknown color %q", name)
+		}
+		if param != "" {
+			params = append(params, param)
+		}
+	}
+	return strings.Join(params, ";"), nil
+}
+
+// ParseColors returns DefaultColors with the colors set by the key=color lines
+// of a theme file replaced, e.g. "success=yellow" or "header=1;34".  Keys are
+// the names of the Colors fields, in any case, and "none" removes a color.
+// Blank lines and lines starting with "#" are ignored.
+func ParseColors(content string) (Colors, error) {
+	c := DefaultColors
+	entries, err := parseEnv(content)
+	if err != nil {
+		return c, err
+	}
+	fields := map[string]reflect.Value{}
+	v := reflect.ValueOf(&c).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		fields[strings.ToLower(v.Type().Field(i).Name)] = v.Field(i)
+	}
+	keys := make([]string, 0, len(entries))
+	for key := range entries {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		field, ok := fields[strings.ToLower(strings.ReplaceAll(key, "-", ""))]
+		if !ok {
+			return c, fmt.Errorf("unknown theme key %q", key)
+		}
+		color, err := parseColor(entries[key])
+		if err != nil {
+			return c, fmt.Errorf("%s: %w", key, err)
+		}
+		field.SetString(color)
+	}
+	return c, nil
+}
+
+// LoadColors reads the colors of a theme file, as described by ParseColors.
+func LoadColors(path string) (Colors, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return DefaultColors, err
+	}
+	c, err := ParseColors(string(data))
+	if err != nil {
+		return c, fmt.Errorf("invalid theme file %s: %w", path, err)
+	}
+	return c, nil
+}
+
+// colorize wraps text in the escapes of a color.
+func colorize(color, text string) string {
+	if color == "" {
+		return text
+	}
+	return "\033[" + color + "m" + text + "\033[0m"
+}
+
+// colorLines colors each line, e.g. of a header drawn on several lines.
+func colorLines(color string, lines []string) []string {
+	if color == "" {
+		return lines
+	}
+	colored := make([]string, len(lines))
+	for i, line := range lines {
+		colored[i] = colorize(color, line)
+	}
+	return colored
+}
+
+// colorPrompt colors a prompt, leaving the blank lines ahead of it and the
+// space after it uncolored.
+func colorPrompt(color, msg string) string {
+	if color == "" {
+		return msg
+	}
+	text := strings.TrimLeft(msg, "\n")
+	lead := msg[:len(msg)-len(text)]
+	body := strings.TrimRight(text, " ")
+	return lead + colorize(color, body) + text[len(body):]
+}
@@ -0,0 +1,122 @@
+package readmerunner
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseColors(t *testing.T) {
+	tc := []struct {
+		name    string
+		content string
+		check   func(Colors) bool
+		err     string
+	}{
+		{"Name", "success=yellow", func(c Colors) bool { return c.Success == "33" && c.Failure == "31" }, ""},
+		{"Combined Names", "header=bold blue", func(c Colors) bool { return c.Header == "1;34" }, ""},
+		{"Raw Parameters", "# Prompts\nPrompt = 1;36\n", func(c Colors) bool { return c.Prompt == "1;36" }, ""},
+		{"Dashed Key", "diff-header=none", func(c Colors) bool { return c.DiffHeader == "" }, ""},
+		{"Unknown Key", "title=red", nil, `unknown theme key "title"`},
+		{"Unknown Color", "success=orange", nil, `success: unknown color "orange"`},
+	}
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := ParseColors(tt.content)
+			if tt.err != "" {
+				if err == nil || err.Error() != tt.err {
+					t.Fatalf("Expected error %q, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseColors returned error: %v", err)
+			}
+			if !tt.check(c) {
+				t.Errorf("Unexpected colors %+v", c)
+			}
+		})
+	}
+}
+
+func TestLoadColorsVerify(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "theme")
+	if err := os.WriteFile(path, []byte("success=yellow\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	c, err := LoadColors(path)
+	if err != nil {
+		t.Fatalf("LoadColors returned error: %v", err)
+	}
+	SetColors(c)
+	defer SetColors(DefaultColors)
+
+	runner, ok := GetRunner("verify").(*VerifyRunner)
+	if !ok {
+		t.Fatal("Expected a verify runner")
+	}
+	out, _, err := runner.RunStatus("true")
+	if err != nil {
+		t.Fatalf("RunStatus returned error: %v", err)
+	}
+	if out != "\x1b[33mSuccess\x1b[0m\n" {
+		t.Errorf("Expected yellow success, got %q", out)
+	}
+	out, _, _ = runner.RunStatus("false")
+	if !strings.HasPrefix(out, "\x1b[31mFailure") {
+		t.Errorf("Expected the default red failure, got %q", out)
+	}
+}
+
+func TestBackgroundColorsVerify(t *testing.T) {
+	defer SetColors(DefaultColors)
+	runner, ok := GetRunner("verify").(*VerifyRunner)
+	if !ok {
+		t.Fatal("Expected a verify runner")
+	}
+	outputs := map[string]string{}
+	for _, background := range []string{"dark", "light"} {
+		c, err := BackgroundColors(background)
+		if err != nil {
+			t.Fatalf("BackgroundColors(%q) returned error: %v", background, err)
+		}
+		SetColors(c)
+		out, _, err := runner.RunStatus("true")
+		if err != nil {
+			t.Fatalf("RunStatus returned error: %v", err)
+		}
+		outputs[background] = out
+	}
+	if outputs["dark"] != "\x1b[92mSuccess\x1b[0m\n" {
+		t.Errorf("Expected bright green success on dark, got %q", outputs["dark"])
+	}
+	if outputs["light"] != "\x1b[1;32mSuccess\x1b[0m\n" {
+		t.Errorf("Expected bold green success on light, got %q", outputs["light"])
+	}
+	if _, err := BackgroundColors("blue"); err == nil {
+		t.Error("Expected an error for an unknown background")
+	}
+}
+
+func TestDetectBackground(t *testing.T) {
+	tc := []struct {
+		colorfgbg string
+		expected  string
+	}{
+		{"15;0", "dark"},
+		{"0;15", "light"},
+		{"0;default;7", "light"},
+		{"7;8", "dark"},
+		{"default;default", ""},
+		{"", ""},
+	}
+	for _, tt := range tc {
+		t.Run(tt.colorfgbg, func(t *testing.T) {
+			t.Setenv("COLORFGBG", tt.colorfgbg)
+			if got := DetectBackground(); got != tt.expected {
+				t.Errorf("DetectBackground() with COLORFGBG=%q = %q, want %q", tt.colorfgbg, got, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,42 @@
+package readmerunner
+
+import (
+	"fmt"
+	"strings"
+)
+
+// askContinue shows a prompt that waits for the user to carry on.  A response
+// starting with "!" runs the rest of it as a command where the shell code
+// blocks run, e.g. "!ls" to check the state left by the tutorial so far, and the prompt is
+// shown again.  With Options.AutoAdvance, the run carries on by itself when
+// nothing is typed in time.
+func (s *session) askContinue(msg string) string {
+	for {
+		var response string
+		if s.opts.AutoAdvance > 0 {
+			response = s.prompts.ask(msg, s.opts.AutoAdvance, fill(s.messages().AutoAdvance, "duration", s.opts.AutoAdvance.String()))
+		} else {
+			response = s.promptFunc(msg)
+		}
+		command, ok := strings.CutPrefix(strings.TrimSpace(response), "!")
+		if !ok {
+			return response
+		}
+		if command = strings.TrimSpace(command); command != "" {
+			s.runCommand(command)
+		}
+	}
+}
+
+// runCommand runs an ad hoc command typed at a prompt where the shell code
+// blocks run and prints its output.
+func (s *session) runCommand(command string) {
+	out, _, err := s.shellRun(command)
+	if err != nil {
+		fmt.Fprintln(s.w, "\n"+s.messages().Error+err.Error())
+	}
+	if out == "" {
+		out = "(no output)"
+	}
+	fmt.Fprintln(s.w, "\n"+s.messages().Output+strings.TrimSuffix(out, "\n"))
+}
@@ -0,0 +1,78 @@
+package readmerunner
+
+import (
+	"strings"
+	"time"
+)
+
+// EventType identifies what happened during a run.
+type EventType string
+
+const (
+	// EventSection is sent when a header is shown.
+	EventSection EventType = "section"
+	// EventRun is sent after a code block runs.
+	EventRun EventType = "run"
+	// EventSkip is sent when a code block is not run.
+	EventSkip EventType = "skip"
+	// EventAnswer is sent when a prompt is answered.
+	EventAnswer EventType = "answer"
+	// EventExit is sent when the user exits before the end of the README.
+	EventExit EventType = "exit"
+	// EventComplete is sent when the end of the README is reached.
+	EventComplete EventType = "complete"
+)
+
+// Event describes a step of a run, e.g. for structured logging.
+type Event struct {
+	Time time.Time `json:"timestamp"`
+	Type EventType `json:"event"`
+	// Section is the text of the header the event happened under.
+	Section string `json:"section,omitempty"`
+	// Command is the first line of the code block for run and skip events.
+	Command string `json:"command,omitempty"`
+	// Line is the line of the opening fence of the code block for run and
+	// skip events.
+	Line int `json:"line,omitempty"`
+	// ExitStatus is the exit status of the code block for run events.
+	ExitStatus int `json:"exit_status"`
+	// Output is what the code block printed for run events.
+	Output string `json:"output,omitempty"`
+	// Variable is the variable set by the prompt for answer events.
+	Variable string `json:"variable,omitempty"`
+}
+
+// emit sends e to the event handler, if there is one.
+func (s *session) emit(e Event) {
+	if s.opts.OnEvent == nil {
+		return
+	}
+	e.Time = time.Now()
+	if e.Section == "" {
+		e.Section = s.header
+	}
+	s.opts.OnEvent(e)
+}
+
+// showSection passes a section that is shown to the section handler, if
+// there is one.
+func (s *session) showSection(sec Section) {
+	if s.opts.OnSection != nil {
+		s.opts.OnSection(sec)
+	}
+}
+
+// skipBlock records that the code block was not run.
+func (s *session) skipBlock(code []string) {
+	s.result.BlocksSkipped++
+	s.lastChoice = "s"
+	s.emit(Event{Type: EventSkip, Command: blockCommand(code), Line: s.line})
+}
+
+// blockCommand returns the first line of a code block, used to identify it.
+func blockCommand(code []string) string {
+	if len(code) < 3 {
+		return ""
+	}
+	return strings.TrimSpace(code[1])
+}
@@ -0,0 +1,93 @@
+package readmerunner
+
+import (
+	"strings"
+)
+
+// parseExpect returns the expected output line declared by an expect
+// directive, e.g. "[expect]:# (hello world)".
+func parseExpect(trimmed string) string {
+	return directiveText(trimmed, "[expect]:#")
+}
+
+// directiveText returns the text of a hidden directive line after its
+// prefix, without the parentheses it is usually wrapped in.
+func directiveText(trimmed, prefix string) string {
+	line := strings.TrimSpace(strings.TrimPrefix(trimmed, prefix))
+	if strings.HasPrefix(line, "(") && strings.HasSuffix(line, ")") {
+		line = line[1 : len(line)-1]
+	}
+	return line
+}
+
+// outputLines splits command output into lines, ignoring a trailing newline.
+func outputLines(out string) []string {
+	out = strings.TrimSuffix(out, "\n")
+	if out == "" {
+		return nil
+	}
+	return strings.Split(out, "\n")
+}
+
+// check runs a verify snippet that should exit with status and, if there are
+// expected lines, print them.  It reports Success or Failure and whether the
+// snippet passed.  An output mismatch is reported as a failure followed by a
+// diff of the expected and actual output.
+func (r *VerifyRunner) check(code string, status int, expected []string) (string, int, bool, error) {
+	out, exitCode, err := r.RunOutput(code)
+	if err != nil {
+		return "", 0, false, err
+	}
+	if exitCode != status {
+		return exitFailure(exitCode, status, out), exitCode, false, nil
+	}
+	if len(expected) > 0 {
+		if diff, same := diffLines(expected, outputLines(out)); !same {
+			return verifyFailure("output did not match") + strings.Join(diff, "\n") + "\n", exitCode, false, nil
+		}
+	}
+	return verifySuccess(), exitCode, true, nil
+}
+
+// diffLines compares expected and actual line by line.  Lines only in
+// expected are prefixed with a "-" colored as removed, lines only in actual
+// with a "+" colored as added,
+// and common lines with two spaces.  It also reports whether the two match.
+func diffLines(expected, actual []string) ([]string, bool) {
+	// lcs[i][j] is the length of the longest common subsequence of
+	// expected[i:] and actual[j:].
+	lcs := make([][]int, len(expected)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(actual)+1)
+	}
+	for i := len(expected) - 1; i >= 0; i-- {
+		for j := len(actual) - 1; j >= 0; j-- {
+			if expected[i] == actual[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var diff []string
+	same := true
+	i, j := 0, 0
+	for i < len(expected) || j < len(actual) {
+		switch {
+		case i < len(expected) && j < len(actual) && expected[i] == actual[j]:
+			diff = append(diff, "  "+expected[i])
+			i++
+			j++
+		case j == len(actual) || (i < len(expected) && lcs[i+1][j] >= lcs[i][j+1]):
+			diff = append(diff, colorize(colors.Removed, "- "+expected[i]))
+			same = false
+			i++
+		default:
+			diff = append(diff, colorize(colors.Added, "+ "+actual[j]))
+			same = false
+			j++
+		}
+	}
+	return diff, same
+}
@@ -0,0 +1,89 @@
+package readmerunner
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseExpect(t *testing.T) {
+	tc := []struct {
+		name     string
+		line     string
+		expected string
+	}{
+		{"parenthesized", "[expect]:# (hello world)", "hello world"},
+		{"bare", "[expect]:# hello", "hello"},
+		{"empty", "[expect]:# ()", ""},
+	}
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseExpect(tt.line); got != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestDiffLines(t *testing.T) {
+	tc := []struct {
+		name     string
+		expected []string
+		actual   []string
+		diff     []string
+		same     bool
+	}{
+		{"same", []string{"a", "b"}, []string{"a", "b"}, []string{"  a", "  b"}, true},
+		{"changed", []string{"a", "b", "c"}, []string{"a", "x", "c"}, []string{"  a", "\033[31m- b\033[0m", "\033[32m+ x\033[0m", "  c"}, false},
+		{"missing", []string{"a", "b"}, []string{"a"}, []string{"  a", "\033[31m- b\033[0m"}, false},
+		{"extra", []string{"a"}, []string{"a", "b"}, []string{"  a", "\033[32m+ b\033[0m"}, false},
+	}
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			diff, same := diffLines(tt.expected, tt.actual)
+			if !reflect.DeepEqual(diff, tt.diff) {
+				t.Errorf("Expected diff %q, got %q", tt.diff, diff)
+			}
+			if same != tt.same {
+				t.Errorf("Expected same=%v, got %v", tt.same, same)
+			}
+		})
+	}
+}
+
+func TestRunMarkdownExpect(t *testing.T) {
+	tc := []struct {
+		name     string
+		expect   string
+		failures int
+	}{
+		{"matching output", "[expect]:# (one)\n[expect]:# (two)\n", 0},
+		{"different output", "[expect]:# (one)\n[expect]:# (three)\n", 1},
+	}
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			mdContent := []byte("# Title\n" + tt.expect + "```verify\necho one\necho two\n```\n")
+			var buf bytes.Buffer
+			result, err := RunMarkdownWithOptions(mdContent, Options{Auto: true}, &buf, fakePrompt(nil))
+			if err != nil {
+				t.Fatalf("RunMarkdownWithOptions returned error: %v", err)
+			}
+			if result.VerifyFailures != tt.failures {
+				t.Errorf("Expected %d verify failures, got %d: %q", tt.failures, result.VerifyFailures, buf.String())
+			}
+			output := buf.String()
+			if strings.Contains(output, "[expect]:#") {
+				t.Errorf("Expected expect directives to be hidden, got %q", output)
+			}
+			if tt.failures > 0 {
+				if !strings.Contains(output, "\033[31m- three\033[0m") || !strings.Contains(output, "\033[32m+ two\033[0m") {
+					t.Errorf("Expected diff of the differing line, got %q", output)
+				}
+				if strings.Contains(output, "- one") || strings.Contains(output, "+ one") {
+					t.Errorf("Expected matching line to be unmarked, got %q", output)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,137 @@
+package readmerunner
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ExportScript writes the shell code blocks of the sections a run with opts
+// goes through as a bash script, with the headers as comments.  Prompts become
+// "read" commands that fall back to their default, and verify blocks are
+// included as comments since they are checks rather than steps.  Sections
+// with a "[when]:#" or "[requires]:#" directive are wrapped in an "if".
+// Blocks of other languages are left out.
+func ExportScript(w io.Writer, mdContent []byte, opts Options) error {
+	s := &session{opts: opts}
+	var b strings.Builder
+	b.WriteString("#!/usr/bin/env bash\n# Generated by readme-runner.\n")
+	named := namedBlocks(mdContent)
+	guard := ""
+	for _, sec := range selectSections(mdContent, opts) {
+		// A named code block is exported again where a directive runs it.
+		if sec.Type == SectionRun {
+			block, err := resolveRun(sec, named)
+			if err != nil {
+				return err
+			}
+			block.When, block.Requires = sec.When, sec.Requires
+			sec = block
+		}
+		cond, err := exportCondition(sec)
+		if err != nil {
+			return err
+		}
+		if cond != guard {
+			if guard != "" {
+				b.WriteString("fi\n")
+			}
+			if cond != "" {
+				fmt.Fprintf(&b, "if %s; then\n", cond)
+			}
+			guard = cond
+		}
+		switch sec.Type {
+		case SectionHeader:
+			header, _ := getHeadingText(sec.Lines[0])
+			fmt.Fprintf(&b, "\n# %s\n", header)
+		case SectionPrompt:
+			pd, err := parsePrompt(strings.TrimSpace(sec.Lines[0]))
+			if err != nil {
+				return err
+			}
+			exportPrompt(&b, pd)
+		case SectionCode:
+			if len(sec.Lines) <= 2 {
+				continue
+			}
+			lang := parseFence(sec.Lines[0]).Language
+			if !isShellLanguage(lang) {
+				continue
+			}
+			if opts.Language != "" && resolveLanguage(opts.Language) != resolveLanguage(lang) {
+				continue
+			}
+			code := s.scriptText(sec.Lines, sec.Stdin)
+			if resolveLanguage(lang) == "verify" {
+				code = "# verify:\n# " + strings.ReplaceAll(code, "\n", "\n# ")
+			}
+			b.WriteString(code + "\n")
+		}
+	}
+	if guard != "" {
+		b.WriteString("fi\n")
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// exportPrompt writes the commands asking for the answer to a prompt.  Like
+// a run, they fall back to the default, store confirmations as true or false
+// and read multiline answers up to an empty line.
+func exportPrompt(b *strings.Builder, pd *Prompt) {
+	text := pd.Text
+	if pd.Confirm {
+		text += " (y/n)"
+	}
+	if pd.Multiline {
+		text += " (end with an empty line)"
+	}
+	if pd.Default != "" {
+		text += " [" + pd.Default + "]"
+	}
+	if pd.Multiline {
+		fmt.Fprintf(b, "printf '%%s\\n' %s >&2\n", shellQuote(text+":"))
+		fmt.Fprintf(b, "%s=$(while IFS= read -r line && [ -n \"$line\" ]; do printf '%%s\\n' \"$line\"; done)\n", pd.VarName)
+	} else {
+		fmt.Fprintf(b, "read -r -p %s %s\n", shellQuote(text+": "), pd.VarName)
+	}
+	if pd.Default != "" {
+		fmt.Fprintf(b, "if [ -z \"$%s\" ]; then %s=%s; fi\n", pd.VarName, pd.VarName, shellQuote(pd.Default))
+	}
+	if pd.Confirm {
+		fmt.Fprintf(b, "case \"$%s\" in\n", pd.VarName)
+		fmt.Fprintf(b, "[yY]|[yY][eE][sS]|[tT][rR][uU][eE]) %s=true ;;\n", pd.VarName)
+		fmt.Fprintf(b, "[nN]|[nN][oO]|[fF][aA][lL][sS][eE]) %s=false ;;\n", pd.VarName)
+		fmt.Fprintf(b, "*) echo %s >&2; exit 1 ;;\n", shellQuote("invalid response for "+pd.VarName+". Must be yes or no"))
+		b.WriteString("esac\n")
+	}
+	fmt.Fprintf(b, "export %s\n", pd.VarName)
+	if pd.File != "" {
+		fmt.Fprintf(b, "printf '%%s\\n' \"$%s\" > %s\n", pd.VarName, shellQuote(pd.File))
+	}
+}
+
+// exportCondition returns the shell condition for the "[when]:#" and
+// "[requires]:#" directives of sec, or "" when it has neither.
+func exportCondition(sec Section) (string, error) {
+	var conds []string
+	if sec.When != "" {
+		name, op, value, err := parseWhen(sec.When)
+		if err != nil {
+			return "", err
+		}
+		if op == "==" {
+			op = "="
+		}
+		conds = append(conds, fmt.Sprintf("[ \"${%s-}\" %s %s ]", name, op, shellQuote(value)))
+	}
+	if sec.Requires != "" {
+		matches := requiresRe.FindStringSubmatch(sec.Requires)
+		if matches == nil || strings.TrimSpace(matches[1]) == "" {
+			return "", fmt.Errorf("invalid requires directive: %s", sec.Requires)
+		}
+		conds = append(conds, "{ "+matches[1]+"\n} >/dev/null 2>&1")
+	}
+	return strings.Join(conds, " && "), nil
+}
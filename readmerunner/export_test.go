@@ -0,0 +1,130 @@
+package readmerunner
+
+import (
+	"bytes"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func TestExportScript(t *testing.T) {
+	mdContent := []byte("# Setup\n\n[prompt]:# (NAME \"Your name\" world)\n\n```bash\n$ echo \"hello $NAME\"\n```\n\n" +
+		"```verify\ntest -n \"$NAME\"\n```\n\n```python\nprint('skipped')\n```\n\n## Build\n\n[tags]:# (build)\n\n```sh\nmake\n```\n\n# Deploy\n\n[tags]:# (deploy)\n\n```bash\n./deploy.sh\n```\n")
+
+	tc := []struct {
+		name     string
+		opts     Options
+		expected []string
+		excluded []string
+	}{
+		{
+			name: "all blocks",
+			expected: []string{
+				"#!/usr/bin/env bash\n",
+				"\n# Setup\n",
+				"read -r -p 'Your name [world]: ' NAME\nif [ -z \"$NAME\" ]; then NAME='world'; fi\nexport NAME\n",
+				"echo \"hello $NAME\"\n",
+				"# verify:\n# test -n \"$NAME\"\n",
+				"\n# Build\nmake\n",
+				"\n# Deploy\n./deploy.sh\n",
+			},
+			excluded: []string{"print('skipped')", "$ echo"},
+		},
+		{
+			name:     "tags",
+			opts:     Options{Tags: []string{"build"}},
+			expected: []string{"\n# Build\nmake\n"},
+			excluded: []string{"./deploy.sh"},
+		},
+		{
+			name:     "start",
+			opts:     Options{StartAnchor: "deploy"},
+			expected: []string{"\n# Deploy\n./deploy.sh\n"},
+			excluded: []string{"# Setup", "make"},
+		},
+	}
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := ExportScript(&buf, mdContent, tt.opts); err != nil {
+				t.Fatalf("ExportScript returned error: %v", err)
+			}
+			script := buf.String()
+			for _, want := range tt.expected {
+				if !strings.Contains(script, want) {
+					t.Errorf("Expected script to contain %q, got:\n%s", want, script)
+				}
+			}
+			for _, unwanted := range tt.excluded {
+				if strings.Contains(script, unwanted) {
+					t.Errorf("Expected script not to contain %q, got:\n%s", unwanted, script)
+				}
+			}
+		})
+	}
+}
+
+func TestExportScriptRuns(t *testing.T) {
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skip("bash not available")
+	}
+	tc := []struct {
+		name     string
+		md       string
+		input    string
+		expected string
+	}{
+		{
+			name:     "default is not expanded",
+			md:       "[prompt]:# (NAME \"Name?\" $HOME`id`\\x)\n```bash\necho \"$NAME\"\n```\n",
+			input:    "\n",
+			expected: "$HOME`id`\\x\n",
+		},
+		{
+			name:     "when",
+			md:       "[prompt]:# (MODE \"Mode?\" [a,b] a)\n# A\n[when]:# (MODE == a)\n```bash\necho in a\n```\n# B\n[when]:# (MODE == \"b\")\n```bash\necho in b\n```\n# End\n```bash\necho done\n```\n",
+			input:    "\n",
+			expected: "in a\ndone\n",
+		},
+		{
+			name:     "requires",
+			md:       "# Missing\n[requires]:# (false)\n```bash\necho missing\n```\n# Present\n[requires]:# (true)\n```bash\necho present\n```\n",
+			expected: "present\n",
+		},
+		{
+			name:     "confirm",
+			md:       "[prompt]:# (GO \"Go?\" confirm)\n```bash\necho \"$GO\"\n```\n",
+			input:    "Yes\n",
+			expected: "true\n",
+		},
+		{
+			name:     "confirm no",
+			md:       "[prompt]:# (GO \"Go?\" confirm)\n```bash\necho \"$GO\"\n```\n",
+			input:    "FALSE\n",
+			expected: "false\n",
+		},
+		{
+			name:     "multiline",
+			md:       "[prompt]:# (TEXT \"Text?\" multiline)\n```bash\necho \"$TEXT\"\necho after\n```\n",
+			input:    "one\ntwo\n\nignored\n",
+			expected: "one\ntwo\nafter\n",
+		},
+	}
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := ExportScript(&buf, []byte(tt.md), Options{}); err != nil {
+				t.Fatalf("ExportScript returned error: %v", err)
+			}
+			cmd := exec.Command("bash", "-c", buf.String())
+			cmd.Stdin = strings.NewReader(tt.input)
+			out, err := cmd.Output()
+			if err != nil {
+				t.Fatalf("Script failed: %v\n%s", err, buf.String())
+			}
+			if string(out) != tt.expected {
+				t.Errorf("Expected output %q, got %q from:\n%s", tt.expected, out, buf.String())
+			}
+		})
+	}
+}
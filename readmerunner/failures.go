@@ -0,0 +1,98 @@
+package readmerunner
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// ErrBlockFailed is returned when a code block fails during an auto run with
+// Options.StopOnFailure set.
+var ErrBlockFailed = errors.New("code block failed")
+
+// Failure records a code block that exited with a non-zero status.
+type Failure struct {
+	// Section is the text of the header the code block is under.
+	Section string
+	// Command is the first line of the code block.
+	Command string
+	// ExitStatus is the exit status of the code block.
+	ExitStatus int
+	// ExpectedStatus is the exit status the code block declared with
+	// {expect-exit=N}, or 0.
+	ExpectedStatus int
+}
+
+// String describes how the code block failed, e.g. "status 1" or
+// "status 0, expected 2".  A verify block that exited with the expected
+// status failed because its output didn't match.
+func (f Failure) String() string {
+	return f.describe(DefaultMessages)
+}
+
+// describe is String in the language of m.
+func (f Failure) describe(m Messages) string {
+	status := strconv.Itoa(f.ExitStatus)
+	if f.ExitStatus == f.ExpectedStatus {
+		return m.FailedOutput
+	}
+	if f.ExpectedStatus != 0 {
+		return fill(m.FailedExpected, "status", status, "expected", strconv.Itoa(f.ExpectedStatus))
+	}
+	return fill(m.FailedStatus, "status", status)
+}
+
+// expectedStatus returns the exit status a code block declares with
+// {expect-exit=N}, e.g. to show a command failing, or 0.  It returns an error
+// if N isn't an exit status.
+func expectedStatus(code []string) (int, error) {
+	if len(code) == 0 {
+		return 0, nil
+	}
+	value, ok := parseFence(code[0]).Attrs["expect-exit"]
+	if !ok {
+		return 0, nil
+	}
+	status, err := strconv.Atoi(value)
+	if err != nil || status < 0 || status > 255 {
+		return 0, fmt.Errorf("invalid exit status in {expect-exit=%s}", value)
+	}
+	return status, nil
+}
+
+// exitedAsExpected reports whether a code block exited with the status it
+// expects.  The status it declares has been checked by prepareBlock.
+func exitedAsExpected(code []string, status int) bool {
+	expected, _ := expectedStatus(code)
+	return status == expected
+}
+
+// recordFailure notes a code block that didn't pass, i.e. exited with a
+// status other than the one it expects, by default 0, or for a verify block
+// didn't print its expected output.  It returns ErrBlockFailed when the run
+// should stop there.
+func (s *session) recordFailure(code []string, status int, passed bool) error {
+	if passed {
+		return nil
+	}
+	expected, _ := expectedStatus(code)
+	failure := Failure{Section: s.header, Command: blockCommand(code), ExitStatus: status, ExpectedStatus: expected}
+	s.result.Failures = append(s.result.Failures, failure)
+	if s.opts.Auto && s.opts.StopOnFailure {
+		return fmt.Errorf("%w: %s exited with %s", ErrBlockFailed, failure.Command, failure)
+	}
+	return nil
+}
+
+// printFailures writes the code blocks that failed during an auto run, in the
+// order they ran.
+func (s *session) printFailures() {
+	if !s.opts.Auto || len(s.result.Failures) == 0 {
+		return
+	}
+	m := s.messages()
+	fmt.Fprintln(s.w, "\n"+m.Failures)
+	for _, f := range s.result.Failures {
+		fmt.Fprintln(s.w, fill(m.Failure, "section", f.Section, "command", f.Command, "reason", f.describe(m)))
+	}
+}
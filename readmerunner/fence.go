@@ -0,0 +1,79 @@
+package readmerunner
+
+import (
+	"strings"
+)
+
+// fenceInfo holds the language and attributes from the opening line of a code
+// fence, e.g. "```bash {danger}".
+type fenceInfo struct {
+	Language string
+	Attrs    map[string]string
+}
+
+// Has reports whether the fence declares the named attribute.
+func (f fenceInfo) Has(name string) bool {
+	_, ok := f.Attrs[name]
+	return ok
+}
+
+// fenceMarker returns the run of three or more backticks or tildes that opens
+// a code block on a trimmed line, e.g. "```" or "~~~~", or "" if the line
+// doesn't open one.
+func fenceMarker(trimmed string) string {
+	if !strings.HasPrefix(trimmed, "```") && !strings.HasPrefix(trimmed, "~~~") {
+		return ""
+	}
+	n := len(trimmed) - len(strings.TrimLeft(trimmed, trimmed[:1]))
+	return trimmed[:n]
+}
+
+// closesFence reports whether a trimmed line closes the code block opened by
+// marker, i.e. it is a run of at least as many of the same character.
+func closesFence(trimmed, marker string) bool {
+	return strings.HasPrefix(trimmed, marker) && strings.TrimLeft(trimmed, marker[:1]) == ""
+}
+
+// fenceTracker follows the code blocks of a document line by line, for
+// scanners that skip them.
+type fenceTracker struct {
+	open string // the marker of the code block the last line was in
+}
+
+// inCode reports whether a trimmed line is part of a code block, fences
+// included.
+func (f *fenceTracker) inCode(trimmed string) bool {
+	if f.open != "" {
+		if closesFence(trimmed, f.open) {
+			f.open = ""
+		}
+		return true
+	}
+	f.open = fenceMarker(trimmed)
+	return f.open != ""
+}
+
+// parseFence parses the opening line of a code fence.  Attributes are listed
+// in braces after the language and are either flags, "{danger}", or key/value
+// pairs, "{tags=linux,gpu}".  Flags are stored with an empty value.
+func parseFence(line string) fenceInfo {
+	info := strings.TrimSpace(strings.TrimLeft(strings.TrimSpace(line), "`~"))
+	fence := fenceInfo{Attrs: map[string]string{}}
+
+	attrs := ""
+	if start := strings.Index(info, "{"); start >= 0 {
+		attrs = info[start+1:]
+		if end := strings.LastIndex(attrs, "}"); end >= 0 {
+			attrs = attrs[:end]
+		}
+		info = info[:start]
+	}
+	if fields := strings.Fields(info); len(fields) > 0 {
+		fence.Language = fields[0]
+	}
+	for _, attr := range strings.Fields(attrs) {
+		key, value, _ := strings.Cut(attr, "=")
+		fence.Attrs[key] = value
+	}
+	return fence
+}
@@ -0,0 +1,72 @@
+package readmerunner
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseFence(t *testing.T) {
+	tc := []struct {
+		name     string
+		line     string
+		expected fenceInfo
+	}{
+		{"empty", "```", fenceInfo{Attrs: map[string]string{}}},
+		{"language", "```bash", fenceInfo{Language: "bash", Attrs: map[string]string{}}},
+		{"indented", "  ```bash", fenceInfo{Language: "bash", Attrs: map[string]string{}}},
+		{"flag", "```bash {danger}", fenceInfo{Language: "bash", Attrs: map[string]string{"danger": ""}}},
+		{"no space", "```bash{danger}", fenceInfo{Language: "bash", Attrs: map[string]string{"danger": ""}}},
+		{"key value", "```bash {danger tags=linux,gpu}", fenceInfo{Language: "bash", Attrs: map[string]string{"danger": "", "tags": "linux,gpu"}}},
+		{"tildes", "~~~bash {danger}", fenceInfo{Language: "bash", Attrs: map[string]string{"danger": ""}}},
+	}
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			fence := parseFence(tt.line)
+			if !reflect.DeepEqual(fence, tt.expected) {
+				t.Errorf("Expected %+v, got %+v", tt.expected, fence)
+			}
+		})
+	}
+}
+
+func TestFenceTracker(t *testing.T) {
+	tc := []struct {
+		name     string
+		lines    []string
+		expected []bool
+	}{
+		{"backticks", []string{"text", "```bash", "echo", "```", "text"}, []bool{false, true, true, true, false}},
+		{"tildes", []string{"~~~", "[x](#y)", "~~~", "text"}, []bool{true, true, true, false}},
+		{"other marker inside", []string{"~~~markdown", "```", "~~~"}, []bool{true, true, true}},
+		{"longer fence", []string{"````", "```", "````", "text"}, []bool{true, true, true, false}},
+		{"info string doesn't close", []string{"```", "```bash", "```", "text"}, []bool{true, true, true, false}},
+		{"too short", []string{"``", "text"}, []bool{false, false}},
+	}
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			var fences fenceTracker
+			var got []bool
+			for _, line := range tt.lines {
+				got = append(got, fences.inCode(line))
+			}
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("Expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestParseSectionsTildeFence(t *testing.T) {
+	md := []byte("# Title\n~~~bash\necho '```'\n```\n~~~\nAfter.\n")
+	sections := parseSections(md, "", nil)
+	var code []string
+	for _, sec := range sections {
+		if sec.Type == SectionCode {
+			code = sec.Lines
+		}
+	}
+	expected := []string{"~~~bash", "echo '```'", "```", "~~~"}
+	if !reflect.DeepEqual(code, expected) {
+		t.Errorf("Expected code block %q, got %q", expected, code)
+	}
+}
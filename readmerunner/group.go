@@ -0,0 +1,126 @@
+package readmerunner
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// isGrouped reports whether a section is a shell code block marked with the
+// {group} attribute, to be run together with its neighbours after a single
+// prompt.  {danger} blocks are never grouped, so that each is confirmed on its
+// own.
+func isGrouped(sec Section) bool {
+	if sec.Type != SectionCode || len(sec.Lines) <= 2 {
+		return false
+	}
+	fence := parseFence(sec.Lines[0])
+	return fence.Has("group") && !fence.Has("danger") && isShellLanguage(fence.Language) && resolveLanguage(fence.Language) != "verify"
+}
+
+// blockGroup returns the consecutive {group} code blocks of the same language
+// at the start of sections and the number of sections they span.  Blank text
+// between the blocks doesn't end the group.
+func blockGroup(sections []Section) ([]Section, int) {
+	var group []Section
+	span := 0
+	for i, sec := range sections {
+		if isGrouped(sec) && (len(group) == 0 || sameLanguage(group[0], sec)) {
+			group = append(group, sec)
+			span = i + 1
+		} else if sec.Type != SectionText || strings.TrimSpace(strings.Join(sec.Lines, "")) != "" {
+			break
+		}
+	}
+	return group, span
+}
+
+// sameLanguage reports whether two code blocks run in the same shell.
+func sameLanguage(a, b Section) bool {
+	return resolveLanguage(parseFence(a.Lines[0]).Language) == resolveLanguage(parseFence(b.Lines[0]).Language)
+}
+
+// showGroup shows the sections spanned by a group of code blocks, leaving out
+// those whose conditions don't hold, and returns the code blocks shown.  The
+// first section has already been counted as shown.
+func (s *session) showGroup(sections []Section) ([]Section, error) {
+	var blocks []Section
+	for i, sec := range sections {
+		if ok, err := s.sectionShown(sec); err != nil {
+			return nil, err
+		} else if !ok {
+			continue
+		}
+		if i > 0 {
+			s.result.SectionsShown++
+		}
+		s.showSection(sec)
+		lines := sec.Lines
+		if sec.Type == SectionCode {
+			lines = renderCode(lines)
+			blocks = append(blocks, sec)
+		}
+		fmt.Fprintln(s.w, strings.Join(lines, "\n"))
+	}
+	return blocks, nil
+}
+
+// processGroup asks once whether to run a group of {group} code blocks and,
+// if so, runs them one after the other in the persistent shell, labeling the
+// output of each.  Each block goes through the checks of a single block
+// first.  A block that fails doesn't stop the others unless the run stops on
+// failures.
+func (s *session) processGroup(blocks []Section) error {
+	type ready struct {
+		block  Section
+		runner CodeRunner
+		code   string
+	}
+	var group []ready
+	for _, block := range blocks {
+		s.setBlock(block)
+		runner, ok, err := s.prepareBlock(block.Lines)
+		if err != nil {
+			return err
+		}
+		if ok {
+			group = append(group, ready{block: block, runner: runner, code: s.scriptText(block.Lines, block.Stdin)})
+		}
+	}
+	if len(group) == 0 {
+		return nil
+	}
+	for _, g := range group {
+		s.warnSudo(parseFence(g.block.Lines[0]).Language, g.code)
+	}
+	choice := "r"
+	if !s.opts.Auto {
+		msg := "\n" + fill(s.messages().RunGroup, "count", strconv.Itoa(len(group)))
+		choice = strings.ToLower(strings.TrimSpace(s.promptFunc(msg)))
+	}
+	switch choice {
+	case "r":
+	case "x":
+		return ErrExit
+	default:
+		for _, g := range group {
+			s.setBlock(g.block)
+			s.skipBlock(g.block.Lines)
+		}
+		return nil
+	}
+
+	for _, g := range group {
+		s.setBlock(g.block)
+		started := time.Now()
+		out, status, passed, err := execBlock(g.runner, g.block.Lines, g.code, g.block.Expect)
+		if err := s.reportLabeled(g.block.Lines, out, status, passed, err, time.Since(started)); err != nil {
+			return err
+		}
+		if wasInterrupted() {
+			fmt.Fprintln(s.w, s.messages().Interrupted)
+		}
+	}
+	return nil
+}
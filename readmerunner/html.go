@@ -0,0 +1,237 @@
+package readmerunner
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// HTMLReport records README runs and writes them as a single HTML page, e.g.
+// to share a completed run.  Pass RecordSection as Options.OnSection and
+// Record as Options.OnEvent, and call AddRun after each run, so that the
+// sections are shown as the run went through them, along with the outputs of
+// the code blocks and the answers to the prompts.
+type HTMLReport struct {
+	title string
+	body  strings.Builder
+	// shown holds the sections of the run being recorded, in the order they
+	// were shown.
+	shown []reportedSection
+}
+
+// reportedSection is a section shown during a run, along with the run and
+// skip events of a code block.
+type reportedSection struct {
+	Section
+	events []Event
+}
+
+// RecordSection records a section shown during the run being reported.  It
+// is meant to be used as Options.OnSection.
+func (r *HTMLReport) RecordSection(sec Section) {
+	r.shown = append(r.shown, reportedSection{Section: sec})
+}
+
+// Record records an event of the run being reported.  It is meant to be used
+// as Options.OnEvent.  Run and skip events belong to the code block last
+// shown with their line, so a block shown again, e.g. by Options.Repeat,
+// gets the events of each time it is shown.
+func (r *HTMLReport) Record(e Event) {
+	if e.Type != EventRun && e.Type != EventSkip {
+		return
+	}
+	for i := len(r.shown) - 1; i >= 0; i-- {
+		if r.shown[i].Type == SectionCode && r.shown[i].StartLine == e.Line {
+			r.shown[i].events = append(r.shown[i].events, e)
+			return
+		}
+	}
+}
+
+// AddRun renders the sections recorded for a run of a README, along with the
+// answers of its result.  The recorded sections are cleared for the next run.
+func (r *HTMLReport) AddRun(mdContent []byte, result RunResult) {
+	links := linkDefinitions(mdContent)
+	for _, sec := range r.shown {
+		switch sec.Type {
+		case SectionHeader:
+			text, level := getHeadingText(sec.Lines[0])
+			level = min(max(level, 1), 6)
+			if r.title == "" {
+				r.title = text
+			}
+			fmt.Fprintf(&r.body, "<h%d id=\"%s\">%s</h%d>\n", level, html.EscapeString(sec.Anchor), inlineHTML(text), level)
+			writeTextHTML(&r.body, renderLinks(sec.Lines[1:], links))
+		case SectionText:
+			writeTextHTML(&r.body, renderLinks(sec.Lines, links))
+		case SectionCode:
+			r.writeCode(sec)
+		case SectionPrompt:
+			pd, err := parsePrompt(strings.TrimSpace(sec.Lines[0]))
+			if err != nil {
+				continue
+			}
+			answer, ok := result.Answers[pd.VarName]
+			if !ok {
+				fmt.Fprintf(&r.body, "<p class=\"prompt\">%s</p>\n", html.EscapeString(pd.Text))
+				continue
+			}
+			if secretRe.MatchString(pd.VarName) {
+				answer = "********"
+			}
+			fmt.Fprintf(&r.body, "<p class=\"prompt\">%s <strong>%s</strong></p>\n", html.EscapeString(pd.Text), html.EscapeString(answer))
+		}
+	}
+	r.shown = nil
+}
+
+// writeCode writes a code block followed by what happened to it during the
+// run: the output of each time it ran, or a note that it was skipped.
+func (r *HTMLReport) writeCode(sec reportedSection) {
+	if len(sec.Lines) < 2 {
+		return
+	}
+	language := parseFence(sec.Lines[0]).Language
+	code := dedent(sec.Lines[1:len(sec.Lines)-1], fenceIndent(sec.Lines[0]))
+	class := ""
+	if language != "" {
+		class = fmt.Sprintf(" class=\"language-%s\"", html.EscapeString(language))
+	}
+	fmt.Fprintf(&r.body, "<pre><code%s>%s</code></pre>\n", class, html.EscapeString(strings.Join(code, "\n")))
+	for _, e := range sec.events {
+		if e.Type == EventSkip {
+			r.body.WriteString("<p class=\"skipped\">Skipped</p>\n")
+			continue
+		}
+		fmt.Fprintf(&r.body, "<pre class=\"output\">%s</pre>\n", html.EscapeString(escapeSeqRe.ReplaceAllString(strings.TrimSuffix(e.Output, "\n"), "")))
+		if e.ExitStatus != 0 {
+			fmt.Fprintf(&r.body, "<p class=\"failed\">Exit status %d</p>\n", e.ExitStatus)
+		}
+	}
+}
+
+// htmlStyle is the style sheet of the page written by HTMLReport.
+const htmlStyle = `body { font-family: sans-serif; max-width: 50em; margin: 2em auto; padding: 0 1em; line-height: 1.5; }
+pre { background: #f6f8fa; padding: 0.75em; overflow-x: auto; }
+pre.output { background: #24292e; color: #e1e4e8; }
+.prompt strong { background: #fff5b1; }
+.skipped { color: #6a737d; font-style: italic; }
+.failed { color: #cb2431; }
+blockquote { border-left: 0.25em solid #dfe2e5; margin-left: 0; padding-left: 1em; color: #6a737d; }`
+
+// WriteTo writes the runs added so far as an HTML page.
+func (r *HTMLReport) WriteTo(w io.Writer) (int64, error) {
+	title := r.title
+	if title == "" {
+		title = "README"
+	}
+	n, err := fmt.Fprintf(w, "<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n<title>%s</title>\n<style>\n%s\n</style>\n</head>\n<body>\n%s</body>\n</html>\n",
+		html.EscapeString(title), htmlStyle, r.body.String())
+	return int64(n), err
+}
+
+var (
+	// listItemRe matches the items of bulleted and numbered lists, capturing
+	// the marker and the text of the item.
+	listItemRe = regexp.MustCompile(`^([-*+]|\d+[.)])\s+(.*)$`)
+	// inlineLinkRe matches inline links, "[text](url)", once escaped.
+	inlineLinkRe = regexp.MustCompile(`\[([^\]]+)\]\(([^)\s]+)\)`)
+	// strongRe matches bold text, "**text**".
+	strongRe = regexp.MustCompile(`\*\*([^*]+)\*\*`)
+	// escapeSeqRe matches terminal escape sequences, e.g. the colors of
+	// "ls --color", which would show as garbage in a page.
+	escapeSeqRe = regexp.MustCompile(`\x1b\[[0-9;?]*[ -/]*[@-~]`)
+)
+
+// writeTextHTML writes the lines of a text section as paragraphs, lists and
+// block quotes.
+func writeTextHTML(b *strings.Builder, lines []string) {
+	var paragraph []string
+	list := ""
+	endParagraph := func() {
+		if len(paragraph) > 0 {
+			fmt.Fprintf(b, "<p>%s</p>\n", inlineHTML(strings.Join(paragraph, " ")))
+			paragraph = nil
+		}
+	}
+	endList := func() {
+		if list != "" {
+			fmt.Fprintf(b, "</%s>\n", list)
+			list = ""
+		}
+	}
+	for _, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if matches := listItemRe.FindStringSubmatch(trimmed); matches != nil {
+			endParagraph()
+			kind := "ul"
+			if strings.IndexAny(matches[1], "0123456789") == 0 {
+				kind = "ol"
+			}
+			if list != kind {
+				endList()
+				fmt.Fprintf(b, "<%s>\n", kind)
+				list = kind
+			}
+			fmt.Fprintf(b, "<li>%s</li>\n", inlineHTML(matches[2]))
+			continue
+		}
+		if trimmed == "" {
+			endParagraph()
+			endList()
+			continue
+		}
+		endList()
+		if strings.HasPrefix(trimmed, ">") {
+			endParagraph()
+			fmt.Fprintf(b, "<blockquote>%s</blockquote>\n", inlineHTML(strings.TrimSpace(strings.TrimPrefix(trimmed, ">"))))
+			continue
+		}
+		paragraph = append(paragraph, trimmed)
+	}
+	endParagraph()
+	endList()
+}
+
+// inlineHTML escapes text for HTML and renders its code spans, inline links
+// and bold text.
+func inlineHTML(text string) string {
+	parts := strings.Split(text, "`")
+	for i, part := range parts {
+		part = html.EscapeString(part)
+		// Every other part is inside a code span, unless the last backtick
+		// isn't closed.
+		if i%2 == 1 && i < len(parts)-1 {
+			parts[i] = "<code>" + part + "</code>"
+			continue
+		} else if i%2 == 1 {
+			part = "`" + part
+		}
+		part = inlineLinkRe.ReplaceAllStringFunc(part, func(link string) string {
+			matches := inlineLinkRe.FindStringSubmatch(link)
+			if !safeURL(html.UnescapeString(matches[2])) {
+				return matches[1]
+			}
+			return `<a href="` + matches[2] + `">` + matches[1] + `</a>`
+		})
+		parts[i] = strongRe.ReplaceAllString(part, "<strong>$1</strong>")
+	}
+	return strings.Join(parts, "")
+}
+
+// safeURL reports whether a link can be written to a page meant for sharing:
+// only http, https and mailto links and relative links are, so that a README
+// can't add e.g. a "javascript:" link.
+func safeURL(url string) bool {
+	scheme, _, found := strings.Cut(url, ":")
+	if !found || strings.ContainsAny(scheme, "/?#") {
+		return true
+	}
+	switch strings.ToLower(scheme) {
+	case "http", "https", "mailto":
+		return true
+	}
+	return false
+}
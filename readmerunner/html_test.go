@@ -0,0 +1,167 @@
+package readmerunner
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestInlineHTML(t *testing.T) {
+	tc := []struct {
+		name     string
+		text     string
+		expected string
+	}{
+		{"escaped", "a < b & c", "a &lt; b &amp; c"},
+		{"code span", "run `make <target>`", "run <code>make &lt;target&gt;</code>"},
+		{"link", "see [docs](https://example.com)", `see <a href="https://example.com">docs</a>`},
+		{"bold", "**note** this", "<strong>note</strong> this"},
+		{"link in code", "`[a](b)`", "<code>[a](b)</code>"},
+		{"relative link", "see [setup](#setup)", `see <a href="#setup">setup</a>`},
+		{"mailto link", "[mail](mailto:a@example.com)", `<a href="mailto:a@example.com">mail</a>`},
+		{"script link", "[x](javascript:alert)", "x"},
+		{"uppercase script link", " [x](JavaScript:void) ", " x "},
+		{"data link", "[x](data:text/html,hi)", "x"},
+		{"unclosed backtick", "it`s", "it`s"},
+	}
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := inlineHTML(tt.text); got != tt.expected {
+				t.Errorf("inlineHTML(%q) = %q, want %q", tt.text, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestHTMLReport(t *testing.T) {
+	defer CloseRunners()
+	mdContent := []byte("# Setup <Guide>\nInstall the **tools** first.\n\n- one\n- two\n\n1. first\n\n> Note: be careful\n[prompt]:# (name \"Your name?\" bob)\n[prompt]:# (api_token \"Token?\" abc123)\n## Run\n```bash\necho \"hello $name\"\n```\n```json\n{\"a\": 1}\n```\n```bash {danger}\n(exit 3)\n```\n")
+
+	report := &HTMLReport{}
+	opts := Options{Auto: true, OnEvent: report.Record, OnSection: report.RecordSection}
+	result, err := RunMarkdownWithOptions(mdContent, opts, &bytes.Buffer{}, fakePrompt(nil))
+	if err != nil {
+		t.Fatalf("RunMarkdownWithOptions returned error: %v", err)
+	}
+	report.AddRun(mdContent, result)
+	var buf bytes.Buffer
+	if _, err := report.WriteTo(&buf); err != nil {
+		t.Fatalf("WriteTo returned error: %v", err)
+	}
+	page := buf.String()
+	for _, want := range []string{
+		"<title>Setup &lt;Guide&gt;</title>",
+		"<h1 id=\"setup-guide\">Setup &lt;Guide&gt;</h1>",
+		"<p>Install the <strong>tools</strong> first.</p>",
+		"<ul>\n<li>one</li>\n<li>two</li>\n</ul>",
+		"<ol>\n<li>first</li>\n</ol>",
+		"<blockquote>Note: be careful</blockquote>",
+		"<p class=\"prompt\">Your name? <strong>bob</strong></p>",
+		"<p class=\"prompt\">Token? <strong>********</strong></p>",
+		"<h2 id=\"run\">Run</h2>",
+		"<pre><code class=\"language-bash\">echo &#34;hello $name&#34;</code></pre>\n<pre class=\"output\">hello bob</pre>",
+		"<pre><code class=\"language-json\">{&#34;a&#34;: 1}</code></pre>\n<pre><code",
+		"<p class=\"failed\">Exit status 3</p>",
+	} {
+		if !strings.Contains(page, want) {
+			t.Errorf("Expected the page to contain %q, got %s", want, page)
+		}
+	}
+	if strings.Contains(page, "abc123") {
+		t.Errorf("Expected the secret answer to be redacted, got %s", page)
+	}
+}
+
+func TestHTMLReportSkipped(t *testing.T) {
+	mdContent := []byte("# Skip\n```bash\necho never\n```\n")
+	report := &HTMLReport{}
+	opts := Options{OnEvent: report.Record, OnSection: report.RecordSection}
+	result, err := RunMarkdownWithOptions(mdContent, opts, &bytes.Buffer{}, fakePrompt([]string{"s"}))
+	if err != nil {
+		t.Fatalf("RunMarkdownWithOptions returned error: %v", err)
+	}
+	report.AddRun(mdContent, result)
+	var buf bytes.Buffer
+	report.WriteTo(&buf)
+	if !strings.Contains(buf.String(), "<p class=\"skipped\">Skipped</p>") || strings.Contains(buf.String(), "class=\"output\"") {
+		t.Errorf("Expected the block to be shown as skipped, got %s", buf.String())
+	}
+}
+
+func TestHTMLReportRecordsRun(t *testing.T) {
+	tc := []struct {
+		name     string
+		md       string
+		opts     Options
+		expected []string
+		absent   []string
+	}{
+		{
+			name:     "hidden by when",
+			md:       "# Setup\n[prompt]:# (mode \"Mode?\" fast)\n[when]:# (mode == slow)\nOnly when slow.\n```bash\necho slow\n```\n",
+			absent:   []string{"Only when slow", "echo slow"},
+			expected: []string{"<h1 id=\"setup\">Setup</h1>"},
+		},
+		{
+			name:     "same command",
+			md:       "# Twice\n```bash\necho $((n += 1))\n```\n```bash\necho $((n += 1))\n```\n",
+			expected: []string{"</code></pre>\n<pre class=\"output\">1</pre>\n<pre><code", "</code></pre>\n<pre class=\"output\">2</pre>\n</body>"},
+		},
+		{
+			name:     "repeat",
+			md:       "# Count\n```bash\necho $((runs += 1))\n```\n",
+			opts:     Options{Repeat: 2},
+			expected: []string{"<pre class=\"output\">1</pre>\n<h1", "<pre class=\"output\">2</pre>\n</body>"},
+		},
+		{
+			name:     "group",
+			md:       "# Group\n```bash {group}\necho one\n```\n```bash {group}\necho two\n```\n",
+			expected: []string{"echo one</code></pre>\n<pre class=\"output\">one</pre>", "echo two</code></pre>\n<pre class=\"output\">two</pre>"},
+		},
+	}
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			defer CloseRunners()
+			report := &HTMLReport{}
+			opts := tt.opts
+			opts.Auto = true
+			opts.OnEvent = report.Record
+			opts.OnSection = report.RecordSection
+			result, err := RunMarkdownWithOptions([]byte(tt.md), opts, &bytes.Buffer{}, fakePrompt(nil))
+			if err != nil {
+				t.Fatalf("RunMarkdownWithOptions returned error: %v", err)
+			}
+			report.AddRun([]byte(tt.md), result)
+			var buf bytes.Buffer
+			report.WriteTo(&buf)
+			page := buf.String()
+			for _, want := range tt.expected {
+				if !strings.Contains(page, want) {
+					t.Errorf("Expected the page to contain %q, got %s", want, page)
+				}
+			}
+			for _, unwanted := range tt.absent {
+				if strings.Contains(page, unwanted) {
+					t.Errorf("Expected the page not to contain %q, got %s", unwanted, page)
+				}
+			}
+		})
+	}
+}
+
+func TestHTMLReportColoredOutput(t *testing.T) {
+	defer CloseRunners()
+	mdContent := []byte("# Colors\n```bash\nprintf '\\033[1;31mred\\033[0m <b>\\033[2K\\n'\n```\n")
+	report := &HTMLReport{}
+	opts := Options{Auto: true, OnEvent: report.Record, OnSection: report.RecordSection}
+	result, err := RunMarkdownWithOptions(mdContent, opts, &bytes.Buffer{}, fakePrompt(nil))
+	if err != nil {
+		t.Fatalf("RunMarkdownWithOptions returned error: %v", err)
+	}
+	report.AddRun(mdContent, result)
+	var buf bytes.Buffer
+	report.WriteTo(&buf)
+	if !strings.Contains(buf.String(), "<pre class=\"output\">red &lt;b&gt;</pre>") || strings.Contains(buf.String(), "\x1b") {
+		t.Errorf("Expected the escape sequences to be stripped from the output, got %s", buf.String())
+	}
+}
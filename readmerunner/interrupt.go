@@ -0,0 +1,52 @@
+package readmerunner
+
+import (
+	"os/exec"
+	"sync"
+)
+
+// interrupts tracks the shell running a snippet so that an interrupt, e.g.
+// Ctrl-C, stops the snippet's command rather than the whole run.
+var interrupts struct {
+	sync.Mutex
+	// cmd is the shell running a snippet, or nil between snippets.
+	cmd *exec.Cmd
+	// interrupted reports whether the snippet being run was interrupted.
+	interrupted bool
+}
+
+// trackRunning records that cmd is running a snippet until the returned
+// function is called.
+func trackRunning(cmd *exec.Cmd) func() {
+	interrupts.Lock()
+	interrupts.cmd = cmd
+	interrupts.interrupted = false
+	interrupts.Unlock()
+	return func() {
+		interrupts.Lock()
+		interrupts.cmd = nil
+		interrupts.Unlock()
+	}
+}
+
+// InterruptRunning interrupts the command a persistent shell is running, and
+// its children, and reports whether there was one.  The shell itself keeps
+// running, so the run carries on.  It returns false between snippets and on
+// systems where commands can't be interrupted separately, in which case the
+// caller should handle the interrupt itself, e.g. by exiting.
+func InterruptRunning() bool {
+	interrupts.Lock()
+	defer interrupts.Unlock()
+	if interrupts.cmd == nil || interruptGroup(interrupts.cmd) != nil {
+		return false
+	}
+	interrupts.interrupted = true
+	return true
+}
+
+// wasInterrupted reports whether the last snippet run was interrupted.
+func wasInterrupted() bool {
+	interrupts.Lock()
+	defer interrupts.Unlock()
+	return interrupts.interrupted
+}
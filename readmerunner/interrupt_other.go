@@ -0,0 +1,18 @@
+//go:build !unix
+
+package readmerunner
+
+import (
+	"errors"
+	"os/exec"
+)
+
+// setProcessGroup does nothing on Windows and other platforms without unix
+// process groups, where an interrupt can't be sent to a group of processes.
+func setProcessGroup(cmd *exec.Cmd) {}
+
+// interruptGroup reports that commands can't be interrupted on platforms
+// without unix process groups, such as Windows.
+func interruptGroup(cmd *exec.Cmd) error {
+	return errors.New("interrupting a command is only supported on unix systems")
+}
@@ -0,0 +1,88 @@
+package readmerunner
+
+import (
+	"bufio"
+	"regexp"
+	"strings"
+)
+
+var (
+	// linkDefinitionRe matches reference link definitions such as
+	// "[docs]: https://example.com "Title"".
+	linkDefinitionRe = regexp.MustCompile(`^\s{0,3}\[([^\]]+)\]:\s*(\S+)(?:\s+(?:"[^"]*"|'[^']*'|\([^)]*\)))?\s*$`)
+	// imageRe matches inline and reference images such as "![logo](logo.png)"
+	// and "![logo][ref]".
+	imageRe = regexp.MustCompile(`!\[([^\]]*)\](?:\([^)]*\)|\[[^\]]*\])`)
+	// referenceLinkRe matches full, collapsed and shortcut reference links,
+	// "[text][ref]", "[text][]" and "[text]", but not inline links.
+	referenceLinkRe = regexp.MustCompile(`\[([^\]]+)\](?:\[([^\]]*)\])?(\()?`)
+)
+
+// normalizeLabel returns a link label in the form used to match references to
+// their definition, which ignores case and runs of whitespace.
+func normalizeLabel(label string) string {
+	return strings.ToLower(strings.Join(strings.Fields(label), " "))
+}
+
+// linkDefinitions returns the URLs of the reference link definitions in the
+// markdown content, keyed by normalized label.  Definitions inside code blocks
+// and directives such as "[prompt]:# (...)" are ignored.
+func linkDefinitions(mdContent []byte) map[string]string {
+	links := map[string]string{}
+	scanner := bufio.NewScanner(strings.NewReader(stripBOM(mdContent)))
+	var fences fenceTracker
+	for scanner.Scan() {
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+		if fences.inCode(strings.TrimSpace(line)) {
+			continue
+		}
+		// Directives and comments are written as definitions of "#".
+		if matches := linkDefinitionRe.FindStringSubmatch(line); matches != nil && matches[2] != "#" {
+			label := normalizeLabel(matches[1])
+			// The first definition of a label wins.
+			if _, ok := links[label]; !ok {
+				links[label] = strings.Trim(matches[2], "<>")
+			}
+		}
+	}
+	return links
+}
+
+// renderLinks returns lines with images replaced by their alt text, e.g.
+// "[image: logo]", and reference links resolved to inline links,
+// "[text](url)", so that they read the same as the rest of the document.  The
+// definitions of the references, which markdown hides, are left out.
+func renderLinks(lines []string, links map[string]string) []string {
+	rendered := make([]string, 0, len(lines))
+	for _, line := range lines {
+		if matches := linkDefinitionRe.FindStringSubmatch(line); matches != nil {
+			if _, ok := links[normalizeLabel(matches[1])]; ok {
+				continue
+			}
+		}
+		line = imageRe.ReplaceAllStringFunc(line, func(image string) string {
+			if alt := imageRe.FindStringSubmatch(image)[1]; alt != "" {
+				return "[image: " + alt + "]"
+			}
+			return "[image]"
+		})
+		line = referenceLinkRe.ReplaceAllStringFunc(line, func(link string) string {
+			matches := referenceLinkRe.FindStringSubmatch(link)
+			// Inline links are already shown as written.
+			if matches[3] != "" {
+				return link
+			}
+			label := matches[2]
+			if label == "" {
+				label = matches[1]
+			}
+			url, ok := links[normalizeLabel(label)]
+			if !ok {
+				return link
+			}
+			return "[" + matches[1] + "](" + url + ")"
+		})
+		rendered = append(rendered, line)
+	}
+	return rendered
+}
@@ -0,0 +1,59 @@
+package readmerunner
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLinkDefinitions(t *testing.T) {
+	md := []byte("See [docs].\n\n[Docs]: https://example.com/docs \"The docs\"\n[logo]: <logo.png>\n[docs]: https://example.com/other\n[prompt]:# (NAME \"Name?\")\n```markdown\n[code]: https://example.com/code\n```\n~~~markdown\n[tilde]: https://example.com/tilde\n~~~\n")
+	expected := map[string]string{"docs": "https://example.com/docs", "logo": "logo.png"}
+	if got := linkDefinitions(md); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected %v, got %v", expected, got)
+	}
+}
+
+func TestRenderLinks(t *testing.T) {
+	links := map[string]string{"docs": "https://example.com/docs", "logo": "logo.png"}
+	tc := []struct {
+		name     string
+		line     string
+		expected []string
+	}{
+		{"Image", "![The logo](logo.png)", []string{"[image: The logo]"}},
+		{"Image Without Alt", "![](logo.png)", []string{"[image]"}},
+		{"Reference Image", "![The logo][logo]", []string{"[image: The logo]"}},
+		{"Full Reference", "Read [the docs][Docs].", []string{"Read [the docs](https://example.com/docs)."}},
+		{"Collapsed Reference", "Read [docs][].", []string{"Read [docs](https://example.com/docs)."}},
+		{"Shortcut Reference", "Read [docs].", []string{"Read [docs](https://example.com/docs)."}},
+		{"Inline Link", "Read [docs](#docs).", []string{"Read [docs](#docs)."}},
+		{"Unknown Reference", "A [note] in brackets.", []string{"A [note] in brackets."}},
+		{"Definition", "[docs]: https://example.com/docs", []string{}},
+	}
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := renderLinks([]string{tt.line}, links); !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("Expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestRunMarkdownLinks(t *testing.T) {
+	mdContent := []byte("# Intro\n![Build status](https://example.com/badge.svg)\n\nSee the [install guide][guide].\n\n[guide]: https://example.com/install\n")
+	var buf bytes.Buffer
+	if _, err := RunMarkdownWithOptions(mdContent, Options{Auto: true}, &buf, fakePrompt(nil)); err != nil {
+		t.Fatalf("RunMarkdownWithOptions returned error: %v", err)
+	}
+	output := buf.String()
+	for _, expected := range []string{"[image: Build status]", "[install guide](https://example.com/install)"} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("Expected %q in output, got %q", expected, output)
+		}
+	}
+	if strings.Contains(output, "[guide]:") {
+		t.Errorf("Expected the link definition to be hidden, got %q", output)
+	}
+}
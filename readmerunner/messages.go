@@ -0,0 +1,244 @@
+package readmerunner
+
+import (
+	"reflect"
+	"strings"
+)
+
+// Messages holds the text shown to the user during a run so that it can be
+// reworded or translated, e.g. to match the tool the runner is embedded in.
+// Empty fields use the text of DefaultMessages.  Placeholders in braces, such
+// as "{section}", are replaced when the message is shown.  The responses
+// typed by the user, e.g. "r", "yes" and "exit", are the same in every
+// language.
+type Messages struct {
+	// RunCode asks whether to run a code block.
+	RunCode string
+	// Continue asks what to do after a code block has run.
+	Continue string
+	// NextSection asks to continue to the next header.  "{section}" is
+	// replaced with the text of the next header.
+	NextSection string
+	// Preview shows the first line of the paragraph under the next header
+	// ahead of NextSection.  "{text}" is replaced with the line, shortened to
+	// fit the terminal.
+	Preview string
+	// StartedAt confirms the header a run with a start anchor begins at.
+	// "{section}" is replaced with the text of the header.
+	StartedAt string
+	// RunParallel asks whether to run a group of {parallel} code blocks.
+	// "{count}" is replaced with the number of blocks.
+	RunParallel string
+	// RunGroup asks whether to run a group of {group} code blocks.  "{count}"
+	// is replaced with the number of blocks.
+	RunGroup string
+	// NoRunner reports that a code block is skipped in auto mode because its
+	// language can't be run.
+	NoRunner string
+	// MissingRunner reports, once per language, that the code blocks of a
+	// language are skipped because its interpreter couldn't be started.
+	// "{language}" is replaced with the language and "{error}" with why.
+	MissingRunner string
+	// NoRunnerPrompt reports that a code block can't be run and waits for
+	// the user.
+	NoRunnerPrompt string
+	// Danger warns about a code block marked {danger}.
+	Danger string
+	// DangerPrompt asks for "yes" before running a {danger} code block.
+	DangerPrompt string
+	// Sudo warns about a code block that runs sudo.
+	Sudo string
+	// EditLine asks for the replacement of a line when editing a code block
+	// at the prompt.  "{line}" is replaced with the line number and "{code}"
+	// with the line.
+	EditLine string
+	// Output labels the output of a code block.
+	Output string
+	// OutputOf labels the output of one of a group of {parallel} or {group}
+	// code blocks.  "{command}" is replaced with the first line of the block.
+	OutputOf string
+	// Error labels an error running a code block.
+	Error string
+	// Interrupted reports that the command a code block was running was
+	// interrupted, e.g. with Ctrl-C.
+	Interrupted string
+	// EditError labels an error editing a code block.
+	EditError string
+	// Copied confirms that a code block was copied to the clipboard.
+	Copied string
+	// CopyError labels an error copying a code block to the clipboard.
+	CopyError string
+	// UnknownAnswer warns about a supplied answer that no prompt asks for.
+	// "{name}" is replaced with the quoted variable name.
+	UnknownAnswer string
+	// PromptTimeout reports that a prompt went unanswered for too long.
+	// "{duration}" is replaced with the timeout.
+	PromptTimeout string
+	// AutoAdvance reports that the run carries on by itself after a continue
+	// prompt went unanswered.  "{duration}" is replaced with the delay.
+	AutoAdvance string
+	// LateAnswer reports that an answer typed after its prompt timed out was
+	// ignored rather than taken for the next prompt.
+	LateAnswer string
+	// SkippingSection reports a section skipped because its precondition
+	// failed.  "{command}" is replaced with the precondition.
+	SkippingSection string
+	// MaxSections reports that the run stopped at Options.MaxSections.
+	// "{count}" is replaced with the limit.
+	MaxSections string
+	// Iteration heads each pass of a run with Options.Repeat.  "{n}" is
+	// replaced with the number of the pass and "{count}" with Options.Repeat.
+	Iteration string
+	// Took follows the output of a code block with Options.Timings.
+	// "{duration}" is replaced with how long the block took to run.
+	Took string
+	// Timings heads the summary printed by Options.Timings.
+	Timings string
+	// Timing is a line of the summary printed by Options.Timings.
+	// "{duration}" is replaced with how long the block took, "{section}" with
+	// the text of its header and "{command}" with its first line.
+	Timing string
+	// Failures heads the code blocks that failed during an auto run.
+	Failures string
+	// Failure is a line under Failures.  "{section}" is replaced with the
+	// text of the header, "{command}" with the first line of the block and
+	// "{reason}" with how it failed.
+	Failure string
+	// FailedStatus tells that a code block exited with a non-zero status.
+	// "{status}" is replaced with the status.
+	FailedStatus string
+	// FailedExpected tells that a code block exited with a status other than
+	// the one it expects.  "{status}" is replaced with the status and
+	// "{expected}" with the expected one.
+	FailedExpected string
+	// FailedOutput tells that a verify block didn't print its expected
+	// output.
+	FailedOutput string
+	// Variables heads the answers printed by Options.PrintVars.
+	Variables string
+	// Complete is printed at the end of the run.
+	Complete string
+}
+
+// DefaultMessages holds the English text used when Options.Messages leaves
+// a field empty.
+var DefaultMessages = Messages{
+	RunCode:         "> Run code? (r=run, e=edit, c=copy, s=skip, x=exit) [default s]: ",
+	Continue:        "> Continue? (r=rerun, s=continue, x=exit) [default s]: ",
+	NextSection:     "> Press Enter to continue to [{section}] (or type 'exit'): ",
+	Preview:         "> Next: {text}",
+	StartedAt:       "> (started at: {section})",
+	RunParallel:     "> Run {count} code blocks in parallel? (r=run, s=skip, x=exit) [default s]: ",
+	RunGroup:        "> Run all {count} code blocks? (r=run, s=skip, x=exit) [default s]: ",
+	NoRunner:        "> No runner for this language or missing code fence language. Skipping.",
+	NoRunnerPrompt:  "> No runner for this language or missing code fence language. Press Enter to continue: ",
+	MissingRunner:   "> Skipping {language} code blocks, the interpreter couldn't be started: {error}",
+	Danger:          "> WARNING: This code block is marked as dangerous.",
+	DangerPrompt:    "> Type 'yes' to run (s=skip, x=exit) [default s]: ",
+	Sudo:            "> CAUTION: This code block uses sudo, which can't ask for a password here and may hang.",
+	EditLine:        "> Line {line}: {code}\n> Replace with (Enter to keep, - to delete): ",
+	Output:          "> Output: ",
+	OutputOf:        "> Output [{command}]: ",
+	Error:           "> Error: ",
+	Interrupted:     "> Interrupted",
+	EditError:       "> Error editing code: ",
+	Copied:          "> Copied to the clipboard",
+	CopyError:       "> Error copying code: ",
+	UnknownAnswer:   "> Warning: no prompt found for answer {name}",
+	PromptTimeout:   "> No answer after {duration}, using the default",
+	AutoAdvance:     "> Continuing after {duration}",
+	LateAnswer:      "> Ignoring an answer given after its prompt timed out",
+	SkippingSection: "> Skipping section: {command} failed",
+	MaxSections:     "> Stopped after {count} sections",
+	Iteration:       "> Iteration {n} of {count}",
+	Took:            "> (took {duration})",
+	Timings:         "> Timings:",
+	Timing:          "  {duration}  {section}: {command}",
+	Failures:        "> Failed code blocks:",
+	Failure:         "  {section}: {command} ({reason})",
+	FailedStatus:    "status {status}",
+	FailedExpected:  "status {status}, expected {expected}",
+	FailedOutput:    "output did not match",
+	Variables:       "> Variables:",
+	Complete:        "> README complete!",
+}
+
+// FrenchMessages holds the French translation of DefaultMessages.
+var FrenchMessages = Messages{
+	RunCode:         "> Exécuter le code ? (r=exécuter, e=modifier, c=copier, s=passer, x=quitter) [défaut s] : ",
+	Continue:        "> Continuer ? (r=relancer, s=continuer, x=quitter) [défaut s] : ",
+	NextSection:     "> Appuyez sur Entrée pour passer à [{section}] (ou tapez 'exit') : ",
+	Preview:         "> Ensuite : {text}",
+	StartedAt:       "> (départ à : {section})",
+	RunParallel:     "> Exécuter {count} blocs de code en parallèle ? (r=exécuter, s=passer, x=quitter) [défaut s] : ",
+	RunGroup:        "> Exécuter les {count} blocs de code ? (r=exécuter, s=passer, x=quitter) [défaut s] : ",
+	NoRunner:        "> Aucun exécuteur pour ce langage ou langage du bloc manquant. Bloc ignoré.",
+	NoRunnerPrompt:  "> Aucun exécuteur pour ce langage ou langage du bloc manquant. Appuyez sur Entrée pour continuer : ",
+	MissingRunner:   "> Blocs {language} ignorés, l'interpréteur n'a pas pu être lancé : {error}",
+	Danger:          "> ATTENTION : ce bloc de code est marqué comme dangereux.",
+	DangerPrompt:    "> Tapez 'yes' pour exécuter (s=passer, x=quitter) [défaut s] : ",
+	Sudo:            "> PRUDENCE : ce bloc de code utilise sudo, qui ne peut pas demander de mot de passe ici et risque de bloquer.",
+	EditLine:        "> Ligne {line} : {code}\n> Remplacer par (Entrée pour garder, - pour supprimer) : ",
+	Output:          "> Sortie : ",
+	OutputOf:        "> Sortie [{command}] : ",
+	Error:           "> Erreur : ",
+	Interrupted:     "> Interrompu",
+	EditError:       "> Erreur de modification du code : ",
+	Copied:          "> Copié dans le presse-papiers",
+	CopyError:       "> Erreur de copie du code : ",
+	UnknownAnswer:   "> Avertissement : aucune invite pour la réponse {name}",
+	PromptTimeout:   "> Pas de réponse après {duration}, valeur par défaut utilisée",
+	AutoAdvance:     "> Poursuite après {duration}",
+	LateAnswer:      "> Réponse ignorée, donnée après l'expiration de l'invite",
+	SkippingSection: "> Section ignorée : {command} a échoué",
+	MaxSections:     "> Arrêt après {count} sections",
+	Iteration:       "> Passage {n} sur {count}",
+	Took:            "> (durée {duration})",
+	Timings:         "> Durées :",
+	Timing:          "  {duration}  {section} : {command}",
+	Failures:        "> Blocs de code en échec :",
+	Failure:         "  {section} : {command} ({reason})",
+	FailedStatus:    "code {status}",
+	FailedExpected:  "code {status}, {expected} attendu",
+	FailedOutput:    "sortie différente de celle attendue",
+	Variables:       "> Variables :",
+	Complete:        "> README terminé !",
+}
+
+// messageSets maps language codes to their translation.
+var messageSets = map[string]Messages{
+	"en": DefaultMessages,
+	"fr": FrenchMessages,
+}
+
+// MessagesFor returns the messages translated into a language, given as a
+// code such as "fr", and whether there is a translation for it.
+func MessagesFor(lang string) (Messages, bool) {
+	m, ok := messageSets[strings.ToLower(lang)]
+	return m, ok
+}
+
+// withDefaults returns m with its empty fields set from DefaultMessages.
+func (m Messages) withDefaults() Messages {
+	v := reflect.ValueOf(&m).Elem()
+	defaults := reflect.ValueOf(DefaultMessages)
+	for i := 0; i < v.NumField(); i++ {
+		if v.Field(i).String() == "" {
+			v.Field(i).Set(defaults.Field(i))
+		}
+	}
+	return m
+}
+
+// fill replaces the placeholders of a message, given as name and value pairs.
+func fill(msg string, pairs ...string) string {
+	for i := 0; i+1 < len(pairs); i += 2 {
+		msg = strings.ReplaceAll(msg, "{"+pairs[i]+"}", pairs[i+1])
+	}
+	return msg
+}
+
+// messages returns the text used for the run.
+func (s *session) messages() Messages {
+	return s.opts.Messages.withDefaults()
+}
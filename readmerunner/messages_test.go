@@ -0,0 +1,94 @@
+package readmerunner
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRunMarkdownMessages(t *testing.T) {
+	mdContent := []byte("# One\n## Two\n```bash\necho hi\n```\n")
+	opts := Options{Messages: Messages{
+		RunCode:     "> Execute? [y/N] ",
+		NextSection: "> Next up: {section} ",
+	}}
+
+	var prompts []string
+	prompt := func(msg string) string {
+		prompts = append(prompts, msg)
+		return ""
+	}
+	if _, err := RunMarkdownWithOptions(mdContent, opts, io.Discard, prompt); err != nil {
+		t.Fatalf("RunMarkdownWithOptions returned error: %v", err)
+	}
+	expected := []string{"\n> Next up: Two ", "\n> Execute? [y/N] "}
+	if !reflect.DeepEqual(prompts, expected) {
+		t.Errorf("Expected prompts %q, got %q", expected, prompts)
+	}
+}
+
+func TestRunMarkdownFrenchMessages(t *testing.T) {
+	messages, ok := MessagesFor("fr")
+	if !ok {
+		t.Fatal("Expected a French translation")
+	}
+	var buf bytes.Buffer
+	if _, err := RunMarkdownWithOptions([]byte("# Titre\n"), Options{Auto: true, Messages: messages}, &buf, fakePrompt(nil)); err != nil {
+		t.Fatalf("RunMarkdownWithOptions returned error: %v", err)
+	}
+	if !strings.Contains(buf.String(), "> README terminé !") || strings.Contains(buf.String(), "README complete!") {
+		t.Errorf("Expected the complete message in French, got %q", buf.String())
+	}
+}
+
+func TestMessagesWithDefaults(t *testing.T) {
+	m := Messages{Complete: "> Done."}.withDefaults()
+	if m.Complete != "> Done." || m.RunCode != DefaultMessages.RunCode || m.Variables != DefaultMessages.Variables {
+		t.Errorf("Expected empty fields to use the defaults, got %+v", m)
+	}
+}
+
+func TestRunMarkdownFrenchSummaries(t *testing.T) {
+	messages, _ := MessagesFor("fr")
+	mdContent := []byte("# Titre\n```bash\n(exit 3)\n```\n")
+	var buf bytes.Buffer
+	opts := Options{Auto: true, Timings: true, Messages: messages}
+	if _, err := RunMarkdownWithOptions(mdContent, opts, &buf, fakePrompt(nil)); err != nil {
+		t.Fatalf("RunMarkdownWithOptions returned error: %v", err)
+	}
+	output := buf.String()
+	for _, expected := range []string{"> (durée ", "s  Titre : (exit 3)\n", "  Titre : (exit 3) (code 3)\n"} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("Expected output to contain %q, got %q", expected, output)
+		}
+	}
+	for _, english := range []string{"took", "status"} {
+		if strings.Contains(output, english) {
+			t.Errorf("Expected no %q in the French output, got %q", english, output)
+		}
+	}
+}
+
+func TestFailureDescribe(t *testing.T) {
+	tests := []struct {
+		name     string
+		failure  Failure
+		expected string
+	}{
+		{"status", Failure{ExitStatus: 1}, "code 1"},
+		{"expected status", Failure{ExitStatus: 0, ExpectedStatus: 2}, "code 0, 2 attendu"},
+		{"output", Failure{ExitStatus: 2, ExpectedStatus: 2}, "sortie différente de celle attendue"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.failure.describe(FrenchMessages); got != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, got)
+			}
+			if tt.failure.String() == tt.expected {
+				t.Errorf("Expected String to stay in English, got %q", tt.failure.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package readmerunner
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// ErrUnknownBlock is returned when a "[run]:#" directive names a code block
+// that no fence defines.
+var ErrUnknownBlock = errors.New("no code block named")
+
+var (
+	// runLineRe matches the start of a directive running a named code block.
+	runLineRe = regexp.MustCompile(`^\[run\]:\s*#`)
+	// runRe matches a directive running a named code block, "[run]:# (setup)".
+	runRe = regexp.MustCompile(`^\[run\]:\s*#\s*\(\s*([\w.-]+)\s*\)$`)
+)
+
+// isRunLine reports whether a trimmed line is a directive running a named
+// code block.
+func isRunLine(trimmed string) bool {
+	return runLineRe.MatchString(trimmed)
+}
+
+// parseRun returns the name of the code block a "[run]:#" directive runs.
+func parseRun(line string) (string, error) {
+	matches := runRe.FindStringSubmatch(line)
+	if matches == nil {
+		return "", fmt.Errorf("invalid run directive: %s", line)
+	}
+	return matches[1], nil
+}
+
+// namedBlocks returns the code blocks of the markdown content named with the
+// "name" attribute, e.g. "```bash {name=setup}", keyed by name.  The whole
+// document is searched, so a block can be run even when the run starts after
+// it.  The first block with a name wins.
+func namedBlocks(mdContent []byte) map[string]Section {
+	blocks := map[string]Section{}
+	for _, sec := range parseSections(mdContent, "", nil) {
+		if sec.Type != SectionCode {
+			continue
+		}
+		name := parseFence(sec.Lines[0]).Attrs["name"]
+		if _, ok := blocks[name]; name != "" && !ok {
+			blocks[name] = sec
+		}
+	}
+	return blocks
+}
+
+// resolveRun returns the named code block that a SectionRun section runs.
+func resolveRun(sec Section, blocks map[string]Section) (Section, error) {
+	name, err := parseRun(strings.TrimSpace(sec.Lines[0]))
+	if err != nil {
+		return Section{}, err
+	}
+	block, ok := blocks[name]
+	if !ok {
+		return Section{}, fmt.Errorf("%w %q, referenced on line %d", ErrUnknownBlock, name, sec.StartLine)
+	}
+	return block, nil
+}
@@ -0,0 +1,96 @@
+package readmerunner
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestParseRun(t *testing.T) {
+	tc := []struct {
+		name     string
+		line     string
+		expected string
+		wantErr  bool
+	}{
+		{"simple", "[run]:# (setup)", "setup", false},
+		{"spaced", "[run]: # ( reset-db )", "reset-db", false},
+		{"dotted", "[run]:# (build.v2)", "build.v2", false},
+		{"missing name", "[run]:# ()", "", true},
+		{"two names", "[run]:# (setup teardown)", "", true},
+	}
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseRun(tt.line)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseRun(%q) error = %v, wantErr %v", tt.line, err, tt.wantErr)
+			}
+			if got != tt.expected {
+				t.Errorf("parseRun(%q) = %q, want %q", tt.line, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestRunMarkdownNamedBlock(t *testing.T) {
+	defer CloseRunners()
+	tc := []struct {
+		name     string
+		md       string
+		opts     Options
+		expected []string
+	}{
+		{
+			name:     "run again later",
+			md:       "# Setup\n```bash {name=greet}\necho hello again\n```\n## Later\n[run]:# (greet)\n[run]:# (greet)\n",
+			opts:     Options{Auto: true},
+			expected: []string{"hello again", "hello again", "hello again"},
+		},
+		{
+			name:     "defined before start",
+			md:       "# Setup\n```bash {name=count}\necho counted\n```\n## Later\n[run]:# (count)\n",
+			opts:     Options{Auto: true, StartAnchor: "later"},
+			expected: []string{"counted"},
+		},
+		{
+			name:     "first definition wins",
+			md:       "# Setup\n```bash {name=pick}\necho first\n```\n```bash {name=pick}\necho second\n```\n[run]:# (pick)\n",
+			opts:     Options{Auto: true},
+			expected: []string{"first", "second", "first"},
+		},
+	}
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			if _, err := RunMarkdownWithOptions([]byte(tt.md), tt.opts, &out, fakePrompt(nil)); err != nil {
+				t.Fatalf("RunMarkdownWithOptions returned error: %v", err)
+			}
+			var got []string
+			for _, line := range strings.Split(out.String(), "\n") {
+				if output, ok := strings.CutPrefix(line, "> Output: "); ok {
+					got = append(got, output)
+				}
+			}
+			if strings.Join(got, ",") != strings.Join(tt.expected, ",") {
+				t.Errorf("Expected outputs %q, got %q in %s", tt.expected, got, out.String())
+			}
+		})
+	}
+}
+
+func TestRunMarkdownUnknownNamedBlock(t *testing.T) {
+	defer CloseRunners()
+	mdContent := []byte("# Setup\n```bash\necho ran\n```\n[run]:# (missing)\n```bash\necho after\n```\n")
+	var out bytes.Buffer
+	_, err := RunMarkdownWithOptions(mdContent, Options{Auto: true}, &out, fakePrompt(nil))
+	if !errors.Is(err, ErrUnknownBlock) {
+		t.Fatalf("Expected ErrUnknownBlock, got %v", err)
+	}
+	if !strings.Contains(err.Error(), `"missing"`) || !strings.Contains(err.Error(), "line 5") {
+		t.Errorf("Expected the error to name the block and its line, got %v", err)
+	}
+	if strings.Contains(out.String(), "> Output: after") {
+		t.Errorf("Expected the run to stop at the unknown block, got %s", out.String())
+	}
+}
@@ -0,0 +1,61 @@
+package readmerunner
+
+import (
+	"strconv"
+	"strings"
+)
+
+// headingNumberer assigns outline numbers such as "1", "1.1" and "2" to
+// headers in document order.
+type headingNumberer struct {
+	// levels and counts hold the header level and count of each outline
+	// position, outermost first.
+	levels []int
+	counts []int
+}
+
+// next returns the number of the next header of the given level.  Skipped
+// levels don't add positions to the number, so a "###" directly under a "#"
+// is numbered "1.1" rather than "1.0.1".
+func (n *headingNumberer) next(level int) string {
+	count := 0
+	for len(n.levels) > 0 && n.levels[len(n.levels)-1] >= level {
+		if n.levels[len(n.levels)-1] == level {
+			count = n.counts[len(n.counts)-1]
+		} else if count == 0 {
+			// A shallower header between two levels continues the count of
+			// the deeper headers it replaces.
+			count = n.counts[len(n.counts)-1]
+		}
+		n.levels = n.levels[:len(n.levels)-1]
+		n.counts = n.counts[:len(n.counts)-1]
+	}
+	n.levels = append(n.levels, level)
+	n.counts = append(n.counts, count+1)
+
+	parts := make([]string, len(n.counts))
+	for i, c := range n.counts {
+		parts[i] = strconv.Itoa(c)
+	}
+	return strings.Join(parts, ".")
+}
+
+// headingNumbers returns the outline number of every header in the markdown
+// content, keyed by the header's line number.
+func headingNumbers(mdContent []byte) map[int]string {
+	numbers := map[int]string{}
+	var n headingNumberer
+	for _, sec := range parseSections(mdContent, "", nil) {
+		if sec.Type == SectionHeader {
+			numbers[sec.StartLine] = n.next(sec.Level)
+		}
+	}
+	return numbers
+}
+
+// numberHeader inserts number in front of the text of a header line, e.g.
+// "## Setup" becomes "## 1.2 Setup".
+func numberHeader(header, number string) string {
+	text, level := getHeadingText(strings.TrimSpace(header))
+	return strings.Repeat("#", level) + " " + number + " " + text
+}
@@ -0,0 +1,61 @@
+package readmerunner
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestHeadingNumberer(t *testing.T) {
+	tc := []struct {
+		name     string
+		levels   []int
+		expected []string
+	}{
+		{"nested", []int{1, 2, 2, 1}, []string{"1", "1.1", "1.2", "2"}},
+		{"three levels", []int{1, 2, 3, 3, 2, 1, 2}, []string{"1", "1.1", "1.1.1", "1.1.2", "1.2", "2", "2.1"}},
+		{"skipped level", []int{1, 3, 3, 1}, []string{"1", "1.1", "1.2", "2"}},
+		{"shallower between levels", []int{1, 3, 2}, []string{"1", "1.1", "1.2"}},
+		{"no top level", []int{2, 3, 2}, []string{"1", "1.1", "2"}},
+	}
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			var n headingNumberer
+			var got []string
+			for _, level := range tt.levels {
+				got = append(got, n.next(level))
+			}
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("Expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestNumberHeadings(t *testing.T) {
+	mdContent := []byte("# Intro\n## Setup\n### Tools\n## Usage\n# Reference\n")
+
+	var toc bytes.Buffer
+	if err := PrintTOCWithOptions(&toc, mdContent, TOCOptions{Depth: 2, NumberHeadings: true}); err != nil {
+		t.Fatalf("PrintTOCWithOptions returned error: %v", err)
+	}
+	want := "- 1 Intro (intro)\n  - 1.1 Setup (setup)\n  - 1.2 Usage (usage)\n- 2 Reference (reference)\n"
+	if got := toc.String(); got != want {
+		t.Errorf("PrintTOCWithOptions output mismatch.\nGot:\n%s\nWant:\n%s", got, want)
+	}
+
+	var buf bytes.Buffer
+	if _, err := RunMarkdownWithOptions(mdContent, Options{Auto: true, NumberHeadings: true, StartAnchor: "setup"}, &buf, fakePrompt(nil)); err != nil {
+		t.Fatalf("RunMarkdownWithOptions returned error: %v", err)
+	}
+	output := buf.String()
+	last := -1
+	for _, header := range []string{"## 1.1 Setup", "### 1.1.1 Tools", "## 1.2 Usage", "# 2 Reference"} {
+		i := strings.Index(output, header)
+		if i < 0 || i < last {
+			t.Errorf("Expected %q after the previous header, got %q", header, output)
+		}
+		last = i
+	}
+}
@@ -0,0 +1,145 @@
+package readmerunner
+
+import "time"
+
+// Options configures how RunMarkdownWithOptions processes a README.
+type Options struct {
+	// StartAnchor is the anchor of the header where the run begins.  An empty
+	// anchor starts at the top of the document.
+	StartAnchor string
+	// StartLine skips the sections that end before this 1-based line number.
+	// Zero starts at the top of the document.
+	StartLine int
+	// Sections limits the run to the headers with these anchors and the
+	// sections nested under them.
+	Sections []string
+	// LineRanges limits the run to the headers whose section, up to the next
+	// header, overlaps one of these line ranges, e.g. the lines changed in a
+	// pull request.
+	LineRanges []LineRange
+	// Tags limits the run to sections carrying at least one of these tags.
+	Tags []string
+	// TagOrder runs the headers tagged with the first of these tags before
+	// those tagged with the second, and so on, instead of in document order.
+	// Headers with none of these tags run last.
+	TagOrder []string
+	// Theme controls how headers are rendered.  The zero value renders them
+	// as markdown.
+	Theme Theme
+	// NumberHeadings prefixes headers with their outline number, e.g. "1.2".
+	NumberHeadings bool
+	// MaxSections, when set, stops the run after this many headers, counted
+	// after the other filters, e.g. to preview the start of a long README.
+	MaxSections int
+	// Repeat, when above one, goes through the README this many times, e.g.
+	// to check that its setup steps can be run again.
+	Repeat int
+	// FreshShells starts new shells for each Repeat iteration, so that shell
+	// variables and the working directory don't carry over from the last one.
+	FreshShells bool
+	// Blocks limits running to the code blocks with these numbers, counting
+	// the runnable blocks of the document from 1 as PrintCodeBlocks does.
+	// The other blocks are still shown but are skipped.
+	Blocks []int
+	// Language limits running to code blocks of this language.  Blocks in
+	// other languages are still shown but are skipped.
+	Language string
+	// StrictLanguages ends the run with an error wrapping ErrUnknownLanguage
+	// at a code block whose language has no runner and isn't display-only,
+	// e.g. a typo such as "bsah", instead of skipping it.  Blocks without a
+	// language are still shown as output.
+	StrictLanguages bool
+	// Auto runs every runnable code block and answers prompts with their
+	// defaults without asking the user.
+	Auto bool
+	// StopOnFailure ends an auto run at the first code block that exits with
+	// a non-zero status, with an error wrapping ErrBlockFailed.  Otherwise the
+	// run carries on and the failures are listed at the end.
+	StopOnFailure bool
+	// AutoVerify runs a verify block without asking when the code block
+	// before it in the section ran, and skips it when that block was skipped.
+	AutoVerify bool
+	// OmitCompleteMessage leaves out the "README complete!" line at the end of
+	// a run, e.g. when the run is one step of a larger script.
+	OmitCompleteMessage bool
+	// Timings prints how long each code block took to run after its output,
+	// and a summary of the timings, slowest first, at the end of the run.
+	Timings bool
+	// Bell, when set, rings the terminal bell after a code block that took at
+	// least this long to run, so that the user can switch away meanwhile.
+	Bell time.Duration
+	// PrintVars prints the prompt answers at the end of the run, with the
+	// values of secret-looking variables, e.g. API_TOKEN, redacted.
+	PrintVars bool
+	// Preambles holds code to run ahead of every code block of a language,
+	// keyed by language, e.g. "set -x" for bash.  The preamble isn't shown.
+	Preambles map[string]string
+	// EchoCommands prints each command of a shell block, prefixed with "$ ",
+	// before its output, as with "set -x".
+	EchoCommands bool
+	// KeepPrompts runs shell blocks exactly as written instead of stripping
+	// leading prompt markers such as "$ " copied from a terminal session.
+	KeepPrompts bool
+	// RootPrompts also strips the "# " root prompts of shell blocks made only
+	// of "# " and "> " lines, which otherwise are left alone as comments.
+	RootPrompts bool
+	// Env holds environment variables exported to the snippets before the
+	// run starts, e.g. loaded with LoadEnvFile.
+	Env map[string]string
+	// Defaults overrides the default answer of prompts by variable name, e.g.
+	// with answers saved from a previous run.
+	Defaults map[string]string
+	// PromptTimeout, when set, answers a prompt left unanswered for this long
+	// with its default, e.g. so that a semi-automated run doesn't stall.  A
+	// prompt without a default ends the run with an error instead.
+	PromptTimeout time.Duration
+	// AutoAdvance, when set, carries on past the prompts that wait for the
+	// user to continue, e.g. to the next section, when nothing is typed for
+	// this long, for demos that play by themselves.
+	AutoAdvance time.Duration
+	// UseDefaults answers every prompt with its default, or with the answer
+	// supplied for it, without asking, while code blocks are still offered
+	// to run as usual.  Unlike FirstOptionDefault, only explicit defaults
+	// count, and the run fails before it starts, with an error wrapping
+	// ErrNoDefault, if a prompt has no default.
+	UseDefaults bool
+	// FirstOptionDefault makes the first option the default of prompts with
+	// options but no default, instead of requiring an answer.
+	FirstOptionDefault bool
+	// Answers supplies answers to prompts by variable name.  Prompts with an
+	// answer are not asked.
+	Answers map[string]string
+	// CarriedAnswers holds answers given earlier, e.g. in a previous README of
+	// the same run.  Like Answers they are used without asking, but unlike
+	// them they aren't reported when no prompt asks for them.  Answers take
+	// precedence.
+	CarriedAnswers map[string]string
+	// Runners replaces the runner of code blocks by fence language, e.g. with
+	// a fake in tests or to run a language GetRunner doesn't support.
+	// Aliases such as "console" use the entry of their language.  Languages
+	// without an entry use GetRunner.  The runner for bash, or else sh, also
+	// runs the commands of prompt options, "!" commands and the "pwd" that
+	// places prompt files, and the one for verify checks "[requires]:#"
+	// preconditions.  The caller closes these runners.
+	Runners map[string]CodeRunner
+	// Messages rewords the prompts shown during the run.  Empty fields keep
+	// the default text.
+	Messages Messages
+	// OnEvent, when set, is called for each step of the run, e.g. to write a
+	// structured log.
+	OnEvent func(Event)
+	// OnSection, when set, is called with each section as it is shown, e.g.
+	// to render the run.  A "[run]:#" directive is passed as the code block it
+	// runs.
+	OnSection func(Section)
+	// Editor, when set, is used to edit a code block before it runs.  It is
+	// given the code and returns the edited code.  Without an editor, blocks
+	// are edited line by line at the prompt.
+	Editor func(code string) (string, error)
+	// Clipboard, when set, copies a code block to the clipboard when "c" is
+	// chosen at the run prompt, e.g. to paste it into another terminal.
+	Clipboard func(text string) error
+	// Pager, when set, receives the rendered output of each text section
+	// instead of it being written directly, e.g. to page it through $PAGER.
+	Pager func(content string) error
+}
@@ -0,0 +1,163 @@
+package readmerunner
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// isParallel reports whether a section is a shell code block marked to run
+// alongside its neighbours with the {parallel} attribute.  {danger} blocks are
+// never run in parallel, so that each is confirmed on its own.
+func isParallel(sec Section) bool {
+	if sec.Type != SectionCode || len(sec.Lines) <= 2 {
+		return false
+	}
+	fence := parseFence(sec.Lines[0])
+	return fence.Has("parallel") && !fence.Has("danger") && isShellLanguage(fence.Language) && resolveLanguage(fence.Language) != "verify"
+}
+
+// parallelGroup returns the consecutive {parallel} code blocks at the start of
+// sections and the number of sections they span.  Blank text between the
+// blocks doesn't end the group.
+func parallelGroup(sections []Section) ([]Section, int) {
+	var group []Section
+	span := 0
+	for i, sec := range sections {
+		if isParallel(sec) {
+			group = append(group, sec)
+			span = i + 1
+		} else if sec.Type != SectionText || strings.TrimSpace(strings.Join(sec.Lines, "")) != "" {
+			break
+		}
+	}
+	return group, span
+}
+
+// runOnce runs a shell snippet in a shell of its own instead of the
+// persistent one, so that several snippets can run at the same time.  The
+// snippet sees exported variables but not those set by earlier blocks.
+func runOnce(language, code string) (string, int, error) {
+	shell := "bash"
+	if resolveLanguage(language) != "bash" {
+		shell = "sh"
+	}
+	cmd := exec.Command(shell, "-c", code)
+	cmd.Env = shellEnv()
+	out, err := cmd.CombinedOutput()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return string(out), exitErr.ExitCode(), nil
+	}
+	return string(out), 0, err
+}
+
+// processParallel asks once whether to run a group of {parallel} code blocks
+// and, if so, runs them together.  Each block goes through the checks of a
+// single block first.  Blocks of a language with a runner in Options.Runners
+// run through it, one at a time.  Their outputs are printed in document order
+// once they have all finished.
+func (s *session) processParallel(sections []Section) error {
+	var blocks []Section
+	for _, block := range sections {
+		s.setBlock(block)
+		_, ok, err := s.prepareBlock(block.Lines)
+		if err != nil {
+			return err
+		}
+		if ok {
+			blocks = append(blocks, block)
+			s.warnSudo(parseFence(block.Lines[0]).Language, s.scriptText(block.Lines, block.Stdin))
+		}
+	}
+	if len(blocks) == 0 {
+		return nil
+	}
+	choice := "r"
+	if !s.opts.Auto {
+		msg := "\n" + fill(s.messages().RunParallel, "count", strconv.Itoa(len(blocks)))
+		choice = strings.ToLower(strings.TrimSpace(s.promptFunc(msg)))
+	}
+	switch choice {
+	case "r":
+	case "x":
+		return ErrExit
+	default:
+		for _, block := range blocks {
+			s.setBlock(block)
+			s.skipBlock(block.Lines)
+		}
+		return nil
+	}
+
+	type result struct {
+		out    string
+		status int
+		err    error
+		took   time.Duration
+	}
+	results := make([]result, len(blocks))
+	var wg sync.WaitGroup
+	// Supplied runners aren't expected to run several snippets at once, so
+	// their blocks take turns.
+	var supplied sync.Mutex
+	for i, block := range blocks {
+		wg.Add(1)
+		go func(i int, code, stdin []string) {
+			defer wg.Done()
+			language := parseFence(code[0]).Language
+			started := time.Now()
+			var out string
+			var status int
+			var err error
+			if runner, ok := s.suppliedRunner(language); ok {
+				supplied.Lock()
+				out, status, err = runWithStatus(runner, s.scriptText(code, stdin))
+				supplied.Unlock()
+			} else {
+				out, status, err = runOnce(language, s.scriptText(code, stdin))
+			}
+			results[i] = result{out: out, status: status, err: err, took: time.Since(started)}
+		}(i, block.Lines, block.Stdin)
+	}
+	wg.Wait()
+
+	var failed error
+	for i, r := range results {
+		s.setBlock(blocks[i])
+		passed := exitedAsExpected(blocks[i].Lines, r.status)
+		if err := s.reportLabeled(blocks[i].Lines, r.out, r.status, passed, r.err, r.took); err != nil && failed == nil {
+			failed = err
+		}
+	}
+	return failed
+}
+
+// reportLabeled prints the output of one of a group of code blocks, labeled
+// with its command, and records the run and whether it passed.  It returns
+// ErrBlockFailed when the run should stop there.
+func (s *session) reportLabeled(code []string, out string, status int, passed bool, err error, took time.Duration) error {
+	s.result.Timings = append(s.result.Timings, Timing{Section: s.header, Command: blockCommand(code), Duration: took})
+	if err != nil {
+		fmt.Fprint(s.w, "\n"+s.messages().Error+err.Error())
+	}
+	if out == "" {
+		out = "(no output)\n"
+	} else if !strings.HasSuffix(out, "\n") {
+		out += "\n"
+	}
+	fmt.Fprint(s.w, "\n"+fill(s.messages().OutputOf, "command", blockCommand(code))+out)
+	if s.opts.Timings {
+		fmt.Fprintln(s.w, fill(s.messages().Took, "duration", formatDuration(took)))
+	}
+	s.ringBell(took)
+	s.result.BlocksRun++
+	s.lastChoice = "r"
+	s.emit(Event{Type: EventRun, Command: blockCommand(code), Line: s.line, ExitStatus: status, Output: out})
+	s.recordVerify(code, passed)
+	return s.recordFailure(code, status, passed)
+}
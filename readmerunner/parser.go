@@ -2,11 +2,14 @@ package readmerunner
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
 	"io"
-	"os"
 	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 	"unicode"
 )
 
@@ -19,6 +22,8 @@ const (
 	SectionCode
 	SectionPrompt
 	SectionUnknown
+	// SectionRun is a "[run]:#" directive running a named code block.
+	SectionRun
 )
 
 // Section holds a slice of lines and a type.
@@ -26,13 +31,61 @@ type Section struct {
 	Type  SectionType
 	Lines []string
 	Tags  []string
+	// Level and Anchor are the level, 1 for "#", and the anchor of the
+	// header of a SectionHeader section.
+	Level  int
+	Anchor string
+	// StartLine and EndLine are the 1-based line numbers of the first and last
+	// lines of the section in the markdown content.
+	StartLine int
+	EndLine   int
+	// Expect holds the output expected from a verify code block, declared by
+	// "[expect]:#" directives ahead of the block.
+	Expect []string
+	// Stdin holds the lines fed to the standard input of a code block,
+	// declared by "[stdin]:#" directives ahead of the block.
+	Stdin []string
+	// Block is the 1-based number of a runnable code block in the document,
+	// as listed by PrintCodeBlocks, and 0 for other sections.
+	Block int
+	// When holds the "[when]:#" directive that must hold for the section to
+	// be shown, if any.
+	When string
+	// Requires holds the "[requires]:#" directive whose command must succeed
+	// for the section to be shown, if any.
+	Requires string
 }
 
-// getHeadingText extracts the text from a header line and prints the header
-// level (number of leading #s).
-func getHeadingText(header string) (string, int) {
+// addLine appends a line found at lineNo to the section.
+func (s *Section) addLine(line string, lineNo int) {
+	if s.StartLine == 0 {
+		s.StartLine = lineNo
+	}
+	s.Lines = append(s.Lines, line)
+	s.EndLine = lineNo
+}
+
+// headingIDRe matches an explicit anchor at the end of a header, as in
+// "## Setup {#install}".
+var headingIDRe = regexp.MustCompile(`\s*\{#([^}\s]+)\}\s*$`)
+
+// splitHeadingID splits an explicit "{#id}" anchor off the end of a header and
+// returns the header without it and the id, which is empty if there is none.
+func splitHeadingID(header string) (string, string) {
+	m := headingIDRe.FindStringSubmatchIndex(header)
+	if m == nil {
+		return header, ""
+	}
+	return header[:m[0]], header[m[2]:m[3]]
+}
+
+// HeadingText extracts the text from a header line and returns the header
+// level (number of leading #s).  An explicit "{#id}" anchor isn't part of the
+// text.
+func HeadingText(header string) (string, int) {
 	// Remove all leading #s and trim whitespace.
 	clean := strings.TrimSpace(strings.TrimLeft(header, "#"))
+	clean, _ = splitHeadingID(clean)
 	// Count the number of leading #s.
 	level := 0
 	for _, r := range header {
@@ -45,10 +98,12 @@ func getHeadingText(header string) (string, int) {
 	return clean, level
 }
 
-// normalizeAnchor converts a header string into a markdown anchor.
+// NormalizeAnchor converts a header string into a markdown anchor, as used
+// for the start anchor and the sections to run.
 // It converts the text to lowercase, removes non-alphanumeric characters (except spaces),
-// and replaces spaces with dashes
-func normalizeAnchor(header string) string {
+// such as punctuation and emoji, replaces spaces with dashes and trims dashes
+// from either end.  Letters outside ASCII are kept.
+func NormalizeAnchor(header string) string {
 	lower := strings.ToLower(header)
 	var b strings.Builder
 	for _, r := range lower {
@@ -60,8 +115,44 @@ func normalizeAnchor(header string) string {
 	// Optionally, collapse multiple dashes (if needed).
 	re := regexp.MustCompile("-+")
 	anchor = re.ReplaceAllString(anchor, "-")
+	// Emoji next to a space would otherwise leave a dash at either end.
+	return strings.Trim(anchor, "-")
+}
+
+// HeadingAnchor returns the anchor of a header line: its explicit "{#id}" if
+// it has one, and otherwise its normalized text.
+func HeadingAnchor(header string) string {
+	if _, id := splitHeadingID(strings.TrimSpace(header)); id != "" {
+		return id
+	}
+	text, _ := HeadingText(header)
+	return NormalizeAnchor(text)
+}
+
+// getHeadingText is the unexported form of HeadingText.
+func getHeadingText(header string) (string, int) {
+	return HeadingText(header)
+}
+
+// normalizeAnchor is the unexported form of NormalizeAnchor.
+func normalizeAnchor(header string) string {
+	return NormalizeAnchor(header)
+}
+
+// commentRe matches authoring comments such as "[//]: # (note)" or
+// "[comment]:# (note)".
+var commentRe = regexp.MustCompile(`^\[(//|comment)\]:\s*#`)
 
-	return anchor
+// isComment reports whether a trimmed line is an authoring comment that should
+// be hidden from the rendered output.
+func isComment(trimmed string) bool {
+	return commentRe.MatchString(trimmed)
+}
+
+// stripBOM returns the markdown content as a string without a leading UTF-8
+// byte order mark, which editors on Windows often add.
+func stripBOM(mdContent []byte) string {
+	return strings.TrimPrefix(string(mdContent), "\uFEFF")
 }
 
 // parseSections reads the markdown content line‐by‐line and splits it into sections.
@@ -69,43 +160,111 @@ func normalizeAnchor(header string) string {
 // or prompt directives (lines starting with "[prompt]:#").
 func parseSections(mdContent []byte, start string, userTags []string) []Section {
 	var sections []Section
-	scanner := bufio.NewScanner(strings.NewReader(string(mdContent)))
-	current := Section{Type: SectionText, Lines: []string{}}
-	pendingTags := []string{}
+	scanner := bufio.NewScanner(strings.NewReader(stripBOM(mdContent)))
+	// Sections without tags of their own, or inherited from their parent,
+	// get the tags declared for the whole document.
+	defaultTags := documentTags(mdContent)
+	pendingTags := defaultTags
+	current := Section{Type: SectionText, Lines: []string{}, Tags: pendingTags}
+	// ownTags reports whether the current header has declared its own tags
+	// rather than inheriting those of its parent.
+	ownTags := false
+	// parents holds the enclosing headers, outermost first, so that
+	// subsections inherit their tags.
+	var parents []headerTags
+	var pendingExpect []string
+	var pendingStdin []string
+	pendingWhen := ""
+	pendingRequires := ""
+	// pending starts a section that takes the tags, condition and
+	// precondition in force at this point of the header's section.
+	pending := func(typ SectionType) Section {
+		return Section{Type: typ, Lines: []string{}, Tags: pendingTags, When: pendingWhen, Requires: pendingRequires}
+	}
 	inCodeBlock := false
-	codeFence := "```"
+	codeFence := ""
 
+	lineNo := 0
 	for scanner.Scan() {
-		line := scanner.Text()
+		// Drop the carriage return of Windows line endings.
+		line := strings.TrimSuffix(scanner.Text(), "\r")
 		trimmed := strings.TrimSpace(line)
+		lineNo++
 
 		// Check for a tags directive.
 		if strings.HasPrefix(trimmed, "[tags]:#") {
 			if tags, err := parseTags(trimmed); err == nil {
-				pendingTags = append(pendingTags, tags...)
+				// A section's own tags replace those it inherited.
+				if !ownTags {
+					pendingTags = nil
+					ownTags = true
+				}
+				pendingTags = append(append([]string{}, pendingTags...), tags...)
 				current.Tags = pendingTags
+				if len(parents) > 0 {
+					parents[len(parents)-1].tags = pendingTags
+				}
 			}
 			continue
 		}
+		if !inCodeBlock && strings.HasPrefix(trimmed, defaultTagsPrefix) {
+			continue
+		}
+
+		// A condition applies to the rest of the header's section.
+		if !inCodeBlock && strings.HasPrefix(trimmed, "[when]:#") {
+			pendingWhen = trimmed
+			current.When = pendingWhen
+			continue
+		}
+
+		// So does a precondition.
+		if !inCodeBlock && strings.HasPrefix(trimmed, "[requires]:#") {
+			pendingRequires = trimmed
+			current.Requires = pendingRequires
+			continue
+		}
 
 		// If in a code block, accumulate lines.
 		if inCodeBlock {
-			current.Lines = append(current.Lines, line)
-			if strings.HasPrefix(trimmed, codeFence) {
+			current.addLine(line, lineNo)
+			if closesFence(trimmed, codeFence) {
 				inCodeBlock = false
 				sections = append(sections, current)
-				current = Section{Type: SectionText, Lines: []string{}, Tags: pendingTags}
+				current = pending(SectionText)
 			}
 			continue
 		}
 
+		// Comments are dropped entirely without ending the current section.
+		if isComment(trimmed) {
+			continue
+		}
+
+		// Expected output is kept for the next code block.
+		if strings.HasPrefix(trimmed, "[expect]:#") {
+			pendingExpect = append(pendingExpect, parseExpect(trimmed))
+			continue
+		}
+
+		// So is input for the next code block.
+		if strings.HasPrefix(trimmed, "[stdin]:#") {
+			pendingStdin = append(pendingStdin, parseStdin(trimmed))
+			continue
+		}
+
 		// Start of a code block.
-		if strings.HasPrefix(trimmed, codeFence) {
+		if marker := fenceMarker(trimmed); marker != "" {
+			codeFence = marker
 			if len(current.Lines) > 0 {
 				sections = append(sections, current)
 			}
-			current = Section{Type: SectionCode, Lines: []string{}, Tags: pendingTags}
-			current.Lines = append(current.Lines, line)
+			current = pending(SectionCode)
+			current.Tags = withFenceTags(pendingTags, line)
+			current.Expect, current.Stdin = pendingExpect, pendingStdin
+			current.addLine(line, lineNo)
+			pendingExpect = nil
+			pendingStdin = nil
 			inCodeBlock = true
 			continue
 		}
@@ -115,35 +274,61 @@ func parseSections(mdContent []byte, start string, userTags []string) []Section
 			if len(current.Lines) > 0 {
 				sections = append(sections, current)
 			}
-			current = Section{Type: SectionHeader, Lines: []string{}, Tags: pendingTags}
-			current.Lines = append(current.Lines, line)
-			pendingTags = nil
+			_, level := getHeadingText(trimmed)
+			for len(parents) > 0 && parents[len(parents)-1].level >= level {
+				parents = parents[:len(parents)-1]
+			}
+			pendingTags = defaultTags
+			if len(parents) > 0 {
+				pendingTags = inheritableTags(parents[len(parents)-1].tags)
+			}
+			parents = append(parents, headerTags{level: level, tags: pendingTags})
+			ownTags = false
+			current = Section{Type: SectionHeader, Lines: []string{}, Tags: pendingTags, Level: level, Anchor: HeadingAnchor(line)}
+			current.addLine(line, lineNo)
+			pendingWhen = ""
+			pendingRequires = ""
 			continue
 		}
 
 		// A parameter/prompt directive.
-		if strings.HasPrefix(trimmed, "[prompt]:#") {
+		if isPromptLine(trimmed) {
+			if len(current.Lines) > 0 {
+				sections = append(sections, current)
+			}
+			directive := pending(SectionPrompt)
+			directive.addLine(line, lineNo)
+			sections = append(sections, directive)
+			current = pending(SectionText)
+			continue
+		}
+
+		// A directive running a named code block.
+		if isRunLine(trimmed) {
 			if len(current.Lines) > 0 {
 				sections = append(sections, current)
 			}
-			sections = append(sections, Section{Type: SectionPrompt, Lines: []string{line}, Tags: pendingTags})
-			current = Section{Type: SectionText, Lines: []string{}}
+			directive := pending(SectionRun)
+			directive.addLine(line, lineNo)
+			sections = append(sections, directive)
+			current = pending(SectionText)
 			continue
 		}
 
 		// Otherwise, treat as normal text.
-		current.Lines = append(current.Lines, line)
+		current.addLine(line, lineNo)
 	}
 	if len(current.Lines) > 0 {
 		sections = append(sections, current)
 	}
 
+	numberBlocks(sections)
+
 	started := start == ""
 	filtered := []Section{}
 	for _, sec := range sections {
 		if !started && sec.Type == SectionHeader {
-			header, _ := getHeadingText(sec.Lines[0])
-			if normalizeAnchor(header) == start {
+			if sec.Anchor == start {
 				started = true
 			}
 		}
@@ -169,148 +354,926 @@ func parseSections(mdContent []byte, start string, userTags []string) []Section
 	}
 }
 
+// WalkSections calls fn for each section of the markdown content in document
+// order, e.g. to render the README differently or to collect statistics.
+// Directives that configure a run, such as "[tags]:#", are applied to the
+// sections rather than passed as text.  Walking stops at the first error fn
+// returns, which WalkSections returns.
+func WalkSections(mdContent []byte, fn func(Section) error) error {
+	for _, sec := range parseSections(mdContent, "", nil) {
+		if err := fn(sec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func printLines(w io.Writer, lines []string) {
 	for _, line := range lines {
 		fmt.Fprintln(w, line)
 	}
 }
 
-func processCodeBlock(w io.Writer, promptFunc func(string) string, code []string, choice string) (err error, exit bool) {
+// printSection writes a rendered text section to w, or hands it to the pager
+// when one is configured.  Output falls back to w if the pager fails.
+func printSection(w io.Writer, pager func(string) error, lines []string) {
+	content := strings.Join(lines, "\n") + "\n"
+	if pager != nil && pager(content) == nil {
+		return
+	}
+	fmt.Fprint(w, content)
+}
+
+// ErrExit is returned while processing a section when the user chooses to
+// exit the run.
+var ErrExit = errors.New("exit")
+
+// session holds the state shared by the sections of a single README run.
+type session struct {
+	w          io.Writer
+	promptFunc func(string) string
+	opts       Options
+	result     RunResult
+	// missing holds the languages whose interpreter couldn't be started and
+	// has been reported.
+	missing map[string]bool
+	// prompts times out prompts when Options.PromptTimeout or
+	// Options.AutoAdvance is set.
+	prompts *timedPrompt
+	// answers holds the answers supplied for the run that are still to be
+	// used, keyed by variable name.
+	answers map[string]string
+	// expect holds the expected output of the code block being processed.
+	expect []string
+	// stdin holds the input of the code block being processed.
+	stdin []string
+	// block is the Block number of the code block being processed.
+	block int
+	// line is the line of the opening fence of the code block being
+	// processed.
+	line int
+	// named holds the code blocks of the document that have a name, for
+	// "[run]:#" directives to run.
+	named map[string]Section
+	// header is the text of the header of the section being processed.
+	header string
+	// requires caches the preconditions checked for the current header
+	// section.
+	requires map[string]bool
+	// lastChoice is "r" if the previous code block in the header section ran
+	// and "s" if it was skipped.
+	lastChoice string
+}
+
+// ask prompts the user with msg and returns the response.  In auto mode, and
+// when using defaults, the message is only recorded and an empty response is
+// returned.
+func (s *session) ask(msg string) string {
+	if s.opts.Auto || s.opts.UseDefaults {
+		fmt.Fprintln(s.w, msg)
+		return ""
+	}
+	return s.promptFunc(msg)
+}
+
+func (s *session) processCodeBlock(code []string, choice string) error {
 	// Empty code block, just print it.
 	if len(code) <= 2 {
-		printLines(w, code)
-		return nil, false
+		printLines(s.w, code)
+		return nil
 	}
-	// Check the language of the code block.
-	// The first line should be the fence with the language.
-	var language string
-	parts := strings.Split(code[0], "```")
-	if len(parts) > 1 {
-		language = parts[1]
+	runner, ok, err := s.prepareBlock(code)
+	if !ok {
+		return err
 	}
-	codeText := strings.Join(code[1:len(code)-1], "\n")
-	runner := GetRunner(language)
+	// The first line is the fence with the language.
+	fence := parseFence(code[0])
+	language := fence.Language
+	codeText := s.scriptText(code, s.stdin)
 
+	// A verify block checks the block before it, so it follows that block.
+	if choice == "" && s.opts.AutoVerify && resolveLanguage(language) == "verify" {
+		choice = s.lastChoice
+	}
 	if choice == "" {
-		if runner == nil {
-			promptFunc("\n> No runner for this language or missing code fence language. Press Enter to continue: ")
-			return nil, false
-		} else {
-			choice = strings.ToLower(strings.TrimSpace(promptFunc("\n> Run code? (r=run, s=skip, x=exit) [default s]: ")))
-		}
+		choice = s.confirmBlock(fence, codeText)
 	}
 	switch choice {
 	case "r":
-		out, err := runner.Run(codeText)
+		started := time.Now()
+		out, status, passed, err := execBlock(runner, code, codeText, s.expect)
+		took := time.Since(started)
+		s.result.Timings = append(s.result.Timings, Timing{Section: s.header, Command: blockCommand(code), Duration: took})
 		if err != nil {
-			fmt.Fprintf(w, "\n> Error: %s", err.Error())
+			fmt.Fprint(s.w, "\n"+s.messages().Error+err.Error())
 		}
 		if out == "" {
 			out = "(no output)\n"
+		} else if !strings.HasSuffix(out, "\n") {
+			out += "\n"
+		}
+		fmt.Fprint(s.w, "\n"+s.messages().Output+out)
+		if wasInterrupted() {
+			fmt.Fprintln(s.w, s.messages().Interrupted)
+		}
+		if s.opts.Timings {
+			fmt.Fprintln(s.w, fill(s.messages().Took, "duration", formatDuration(took)))
+		}
+		s.ringBell(took)
+		s.result.BlocksRun++
+		s.lastChoice = "r"
+		s.emit(Event{Type: EventRun, Command: blockCommand(code), Line: s.line, ExitStatus: status, Output: out})
+		s.recordVerify(code, passed)
+		if err := s.recordFailure(code, status, passed); err != nil {
+			return err
+		}
+		if s.opts.Auto {
+			return nil
 		}
-		fmt.Fprintf(w, "\n> Output: %s", out)
 
 		// Prompt after execution: continue, rerun, or exit.
-		nextChoice := strings.ToLower(strings.TrimSpace(promptFunc("\n> Continue? (r=rerun, s=continue, x=exit) [default s]: ")))
+		nextChoice := strings.ToLower(strings.TrimSpace(s.askContinue("\n" + s.messages().Continue)))
 		switch nextChoice {
 		case "r":
-			err, exit := processCodeBlock(w, promptFunc, code, "r")
-			if err != nil {
-				return err, exit
-			}
+			return s.processCodeBlock(code, "r")
 		case "x":
-			return nil, true
+			return ErrExit
 		case "s", "":
-			return nil, false
+			return nil
 		default:
-			err, exit := processCodeBlock(w, promptFunc, code, "r")
-			if err != nil {
-				return err, exit
-			}
+			return s.processCodeBlock(code, "r")
 		}
+	case "e":
+		edited, err := s.editCode(code[1 : len(code)-1])
+		if err != nil {
+			fmt.Fprintln(s.w, "\n"+s.messages().EditError+err.Error())
+			return s.processCodeBlock(code, "")
+		}
+		fmt.Fprintln(s.w, strings.Join(edited, "\n"))
+		editedCode := append(append([]string{code[0]}, edited...), code[len(code)-1])
+		return s.processCodeBlock(editedCode, "r")
+	case "c":
+		if err := s.copyCode(code); err != nil {
+			fmt.Fprintln(s.w, "\n"+s.messages().CopyError+err.Error())
+			return s.processCodeBlock(code, "")
+		}
+		fmt.Fprintln(s.w, "\n"+s.messages().Copied)
+		s.skipBlock(code)
+		return nil
 	case "x":
-		return nil, true
+		return ErrExit
 	case "s", "":
-		return nil, false
+		s.skipBlock(code)
+		return nil
+	default:
+		return s.processCodeBlock(code, "")
+	}
+}
+
+// setBlock makes sec the code block being processed.
+func (s *session) setBlock(sec Section) {
+	s.expect = sec.Expect
+	s.stdin = sec.Stdin
+	s.block = sec.Block
+	s.line = sec.StartLine
+}
+
+// prepareBlock makes the checks done before a code block is offered to run
+// and returns its runner, or false if the block isn't to be run: display-only
+// blocks, blocks left out by Options.Language or Options.Blocks and blocks
+// whose language has no runner, which are recorded as skipped.  With
+// Options.StrictLanguages, a language without a runner ends the run instead.
+func (s *session) prepareBlock(code []string) (CodeRunner, bool, error) {
+	language := parseFence(code[0]).Language
+	// Display-only blocks such as diffs and diagrams are never run.
+	if isDisplayLanguage(language) {
+		return nil, false, nil
+	}
+	runner := s.runner(language)
+	if runner == nil && s.opts.StrictLanguages && language != "" && runnerCommand(language) == "" {
+		return nil, false, fmt.Errorf("%w %q in section %q", ErrUnknownLanguage, language, s.header)
+	}
+	if _, err := expectedStatus(code); err != nil {
+		return nil, false, fmt.Errorf("%w in section %q", err, s.header)
+	}
+
+	// Blocks of other languages are shown but never run when filtering.
+	if s.opts.Language != "" && resolveLanguage(s.opts.Language) != resolveLanguage(language) {
+		s.skipBlock(code)
+		return nil, false, nil
+	}
+	if !s.blockSelected(s.block) {
+		s.skipBlock(code)
+		return nil, false, nil
+	}
+	switch {
+	case runner == nil && RunnerError(language) != nil:
+		s.reportMissingRunner(language)
+	case runner == nil && s.opts.Auto:
+		fmt.Fprintln(s.w, "\n"+s.messages().NoRunner)
+	case runner == nil:
+		s.promptFunc("\n" + s.messages().NoRunnerPrompt)
 	default:
-		err, exit := processCodeBlock(w, promptFunc, code, "")
+		return runner, true, nil
+	}
+	s.skipBlock(code)
+	return nil, false, nil
+}
+
+// confirmBlock asks whether to run a code block and returns the choice, which
+// is "r" in auto mode.  Dangerous blocks need an explicit "yes" rather than a
+// quick "r".
+func (s *session) confirmBlock(fence fenceInfo, codeText string) string {
+	s.warnSudo(fence.Language, codeText)
+	if s.opts.Auto {
+		return "r"
+	}
+	if !fence.Has("danger") {
+		return strings.ToLower(strings.TrimSpace(s.promptFunc("\n" + s.messages().RunCode)))
+	}
+	fmt.Fprintln(s.w, "\n"+colorize(colors.Danger, s.messages().Danger))
+	switch strings.ToLower(strings.TrimSpace(s.promptFunc("\n" + s.messages().DangerPrompt))) {
+	case "yes":
+		return "r"
+	case "x":
+		return "x"
+	default:
+		return "s"
+	}
+}
+
+// warnSudo warns ahead of running a shell snippet that uses sudo.
+func (s *session) warnSudo(language, codeText string) {
+	if isShellLanguage(language) && usesSudo(codeText) {
+		fmt.Fprintln(s.w, "\n"+colorize(colors.Warning, s.messages().Sudo))
+	}
+}
+
+// execBlock runs the code of a block and reports whether it passed, i.e.
+// exited with the status it expects and, for a verify block with expected
+// output, printed it.  A verify block reports Success or Failure accordingly.
+func execBlock(runner CodeRunner, code []string, codeText string, expect []string) (string, int, bool, error) {
+	if vr, ok := runner.(*VerifyRunner); ok {
+		expected, _ := expectedStatus(code)
+		return vr.check(codeText, expected, expect)
+	}
+	out, status, err := runWithStatus(runner, codeText)
+	return out, status, exitedAsExpected(code, status), err
+}
+
+// recordVerify counts a verify block that ran as passed or failed.
+func (s *session) recordVerify(code []string, passed bool) {
+	if parseFence(code[0]).Language != "verify" {
+		return
+	}
+	if passed {
+		s.result.VerifyPassed++
+	} else {
+		s.result.VerifyFailures++
+	}
+}
+
+// copyCode copies the code of a block to the clipboard with
+// Options.Clipboard, without the terminal prompts it would run without.
+func (s *session) copyCode(code []string) error {
+	if s.opts.Clipboard == nil {
+		return errors.New("no clipboard available")
+	}
+	language := parseFence(code[0]).Language
+	text := strings.Join(dedent(code[1:len(code)-1], fenceIndent(code[0])), "\n")
+	if !s.opts.KeepPrompts && isShellLanguage(language) {
+		text = stripPrompts(text, s.opts.RootPrompts)
+	}
+	return s.opts.Clipboard(text + "\n")
+}
+
+// scriptText returns the code of a code block as it should be run, with
+// the indentation of a fence nested in a list removed, terminal prompts
+// stripped, the {strict} attribute applied, the preamble of its language
+// prepended and stdin fed to it.
+func (s *session) scriptText(code, stdin []string) string {
+	fence := parseFence(code[0])
+	codeText := strings.Join(dedent(code[1:len(code)-1], fenceIndent(code[0])), "\n")
+	if !s.opts.KeepPrompts && isShellLanguage(fence.Language) {
+		codeText = stripPrompts(codeText, s.opts.RootPrompts)
+	}
+	if fence.Has("script") && isShellLanguage(fence.Language) {
+		codeText = scriptFile(codeText)
+	} else if s.opts.EchoCommands && isShellLanguage(fence.Language) && resolveLanguage(fence.Language) != "verify" {
+		codeText = echoCommands(codeText)
+	}
+	if fence.Has("strict") && isShellLanguage(fence.Language) {
+		codeText = strictScript(codeText)
+	}
+	if preamble := s.preamble(fence.Language); preamble != "" {
+		codeText = preamble + "\n" + codeText
+	}
+	if len(stdin) > 0 && isShellLanguage(fence.Language) {
+		codeText = withStdin(codeText, stdin)
+	}
+	return codeText
+}
+
+// preamble returns the code configured in Options.Preambles for a language,
+// after resolving aliases.
+func (s *session) preamble(language string) string {
+	if language == "" {
+		return ""
+	}
+	for lang, code := range s.opts.Preambles {
+		if resolveLanguage(lang) == resolveLanguage(language) {
+			return code
+		}
+	}
+	return ""
+}
+
+// fenceIndent returns the number of spaces and tabs before a code fence, e.g.
+// when the fence is nested in a list item.
+func fenceIndent(fence string) int {
+	return len(fence) - len(strings.TrimLeft(fence, " \t"))
+}
+
+// dedent removes up to n leading spaces and tabs from each line, as markdown
+// does for the lines of an indented code fence.
+func dedent(lines []string, n int) []string {
+	if n == 0 {
+		return lines
+	}
+	dedented := make([]string, len(lines))
+	for i, line := range lines {
+		j := 0
+		for j < n && j < len(line) && (line[j] == ' ' || line[j] == '\t') {
+			j++
+		}
+		dedented[i] = line[j:]
+	}
+	return dedented
+}
+
+// editCode returns the lines of a code block after letting the user change
+// them, either in the configured editor or line by line at the prompt.
+func (s *session) editCode(lines []string) ([]string, error) {
+	if s.opts.Editor != nil {
+		edited, err := s.opts.Editor(strings.Join(lines, "\n") + "\n")
 		if err != nil {
-			return err, exit
+			return nil, err
 		}
+		return strings.Split(strings.TrimSuffix(edited, "\n"), "\n"), nil
 	}
-	return nil, false
+	edited := make([]string, 0, len(lines))
+	for i, line := range lines {
+		response := s.promptFunc("\n" + fill(s.messages().EditLine, "line", strconv.Itoa(i+1), "code", line))
+		switch response {
+		case "":
+			edited = append(edited, line)
+		case "-":
+		default:
+			edited = append(edited, response)
+		}
+	}
+	return edited, nil
+}
+
+// processPromptSection asks the prompts in lines and exports the answers to
+// the environment, asking again until every answer is valid.
+func (s *session) processPromptSection(lines []string) error {
+	for {
+		kv, err := s.processPrompt(lines)
+		if err != nil {
+			// Asking again can't change an automatic answer, and
+			// nobody is there to answer a prompt that timed out.
+			if s.opts.Auto || s.opts.UseDefaults || errors.Is(err, ErrPromptTimeout) {
+				return err
+			}
+			fmt.Fprintln(s.w, err)
+			continue
+		}
+		fmt.Fprintln(s.w)
+		for k, v := range kv {
+			if err := exportVar(k, v); err != nil {
+				return err
+			}
+			s.result.Answers[k] = v
+			s.result.PromptsAnswered++
+			s.emit(Event{Type: EventAnswer, Variable: k})
+		}
+		return nil
+	}
+}
+
+// TOCFormat selects how table-of-contents entries are written.
+type TOCFormat string
+
+const (
+	// TOCText writes entries as "- Title (anchor)".
+	TOCText TOCFormat = "text"
+	// TOCMarkdown writes entries as markdown links, "- [Title](#anchor)".
+	TOCMarkdown TOCFormat = "markdown"
+)
+
+// TOCOptions configures how PrintTOCWithOptions writes a table-of-contents.
+type TOCOptions struct {
+	// Depth limits the table-of-contents to headers of this level or above.
+	// Zero includes every header.
+	Depth int
+	// Format selects the entry format.  The zero value writes plain text.
+	Format TOCFormat
+	// Numbered prefixes each entry with its 1-based position in the
+	// table-of-contents instead of a dash.
+	Numbered bool
+	// NumberHeadings prefixes each title with its outline number, e.g. "1.2",
+	// as shown by Options.NumberHeadings in run mode.
+	NumberHeadings bool
+}
+
+// TOCEntry is a header listed in a table-of-contents.
+type TOCEntry struct {
+	Title  string
+	Anchor string
+	Level  int
+	// Number is the outline number of the header, e.g. "1.2".
+	Number string
+}
+
+// TOCEntries returns the headers that PrintTOCWithOptions lists for the
+// markdown content, in document order.  Only opts.Depth is used.
+func TOCEntries(mdContent []byte, opts TOCOptions) []TOCEntry {
+	var entries []TOCEntry
+	var numbers headingNumberer
+	for _, sec := range parseSections(mdContent, "", nil) {
+		if sec.Type != SectionHeader {
+			continue
+		}
+		header, _ := getHeadingText(sec.Lines[0])
+		// Every header is numbered, even those deeper than the depth.
+		number := numbers.next(sec.Level)
+		if opts.Depth > 0 && sec.Level > opts.Depth {
+			continue
+		}
+		entries = append(entries, TOCEntry{Title: header, Anchor: sec.Anchor, Level: sec.Level, Number: number})
+	}
+	return entries
 }
 
 // PrintTOC parses the markdown content and writes a table-of-contents.
 func PrintTOC(w io.Writer, mdContent []byte) error {
-	sections := parseSections(mdContent, "", nil)
-	for _, sec := range sections {
+	return PrintTOCWithOptions(w, mdContent, TOCOptions{})
+}
+
+// PrintTOCWithOptions is like PrintTOC but takes its configuration from opts.
+func PrintTOCWithOptions(w io.Writer, mdContent []byte, opts TOCOptions) error {
+	for i, entry := range TOCEntries(mdContent, opts) {
+		indent := strings.Repeat("  ", entry.Level-1)
+		bullet := "-"
+		if opts.Numbered {
+			bullet = fmt.Sprintf("%d.", i+1)
+		}
+		title := entry.Title
+		if opts.NumberHeadings {
+			title = entry.Number + " " + title
+		}
+		if opts.Format == TOCMarkdown {
+			fmt.Fprintf(w, "%s%s [%s](#%s)\n", indent, bullet, title, entry.Anchor)
+		} else {
+			fmt.Fprintf(w, "%s%s %s (%s)\n", indent, bullet, title, entry.Anchor)
+		}
+	}
+	return nil
+}
+
+// PrintCodeBlocks writes the runnable code blocks of the markdown content,
+// numbered and labelled with their language, the anchor of the section they
+// are in and their line number.  Nothing is run.  A non-empty language limits
+// the listing to blocks of that language.
+func PrintCodeBlocks(w io.Writer, mdContent []byte, language string) error {
+	anchor := ""
+	n := 0
+	for _, sec := range parseSections(mdContent, "", nil) {
 		if sec.Type == SectionHeader {
-			// Get the anchor text.
-			header, level := getHeadingText(sec.Lines[0])
-			// Normalize the anchor.
-			anchor := normalizeAnchor(header)
-			indent := strings.Repeat("  ", level-1)
-			fmt.Fprintf(w, "%s- %s (%s)\n", indent, header, anchor)
+			anchor = sec.Anchor
+			continue
+		}
+		if sec.Type != SectionCode {
+			continue
+		}
+		lang := parseFence(sec.Lines[0]).Language
+		if !isShellLanguage(lang) {
+			continue
+		}
+		if language != "" && resolveLanguage(language) != resolveLanguage(lang) {
+			continue
 		}
+		n++
+		if anchor == "" {
+			fmt.Fprintf(w, "%d. %s (line %d)\n", n, lang, sec.StartLine)
+		} else {
+			fmt.Fprintf(w, "%d. %s (#%s, line %d)\n", n, lang, anchor, sec.StartLine)
+		}
+		printLines(w, sec.Lines)
+		fmt.Fprintln(w)
 	}
 	return nil
 }
 
-// RunMarkdownSimple processes the markdown content (without using Goldmark)
-// and prints sections until a delimiter is reached, then prompts the user.
+// RunResult summarizes a README run.
+type RunResult struct {
+	// SectionsShown counts the sections that were processed.
+	SectionsShown int
+	// BlocksRun counts the code block executions, including reruns.
+	BlocksRun int
+	// BlocksSkipped counts the code blocks that were not run.
+	BlocksSkipped int
+	// VerifyPassed counts the verify blocks that reported a success.
+	VerifyPassed int
+	// VerifyFailures counts the verify blocks that reported a failure.
+	VerifyFailures int
+	// PromptsAnswered counts the prompt answers collected.
+	PromptsAnswered int
+	// ExitedEarly reports whether the user exited before the end of the
+	// README.
+	ExitedEarly bool
+	// Answers holds the responses to the prompts, keyed by variable name.
+	Answers map[string]string
+	// Timings holds how long each code block execution took, in run order.
+	Timings []Timing
+	// Failures holds the code block executions that exited with a non-zero
+	// status, in run order.
+	Failures []Failure
+}
+
+// RunMarkdown processes the markdown content and prints sections until a
+// delimiter is reached, then prompts the user.
 func RunMarkdown(mdContent []byte, startAnchor string, tags []string, w io.Writer, promptFunc func(string) string) error {
-	sections := parseSections(mdContent, startAnchor, tags)
-	for i, sec := range sections {
-		switch sec.Type {
-		case SectionCode:
-			fmt.Fprintln(w, strings.Join(sec.Lines, "\n"))
-			err, exit := processCodeBlock(w, promptFunc, sec.Lines, "")
-			if err != nil {
-				return err
+	_, err := RunMarkdownWithOptions(mdContent, Options{StartAnchor: startAnchor, Tags: tags}, w, promptFunc)
+	return err
+}
+
+// RunMarkdownWithOptions is like RunMarkdown but takes its configuration from
+// opts and also returns a summary of the run.
+func RunMarkdownWithOptions(mdContent []byte, opts Options, w io.Writer, promptFunc func(string) string) (RunResult, error) {
+	s := &session{w: w, promptFunc: promptFunc, opts: opts, requires: map[string]bool{}}
+	s.result.Answers = map[string]string{}
+	if color := promptColor(opts.Theme); color != "" {
+		s.promptFunc = func(msg string) string {
+			return promptFunc(colorPrompt(color, msg))
+		}
+	}
+	s.timePrompts()
+	start, err := ResolveStartAnchor(mdContent, opts.StartAnchor)
+	if err != nil {
+		return s.result, err
+	}
+	s.opts.StartAnchor = start
+	s.supplyAnswers()
+	if err := s.exportEnv(); err != nil {
+		return s.result, err
+	}
+	err = s.run(mdContent)
+	if errors.Is(err, ErrExit) || errors.Is(err, ErrBlockFailed) {
+		s.result.ExitedEarly = true
+		s.emit(Event{Type: EventExit})
+		s.printTimings()
+		s.printVars()
+	}
+	if errors.Is(err, ErrExit) {
+		err = nil
+	}
+	return s.result, err
+}
+
+// exportEnv exports the variables of Options.Env to the snippets.
+func (s *session) exportEnv() error {
+	for k, v := range s.opts.Env {
+		if err := exportVar(k, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// supplyAnswers makes the answers of Options.Answers the ones still to be
+// used.
+func (s *session) supplyAnswers() {
+	s.answers = map[string]string{}
+	for k, v := range s.opts.CarriedAnswers {
+		s.answers[k] = v
+	}
+	for k, v := range s.opts.Answers {
+		s.answers[k] = v
+	}
+}
+
+// printStart confirms where a run with a start anchor begins by naming the
+// header it matched.  Nothing is printed if the anchor didn't match.
+func (s *session) printStart(sections []Section) {
+	if s.opts.StartAnchor == "" {
+		return
+	}
+	for _, sec := range sections {
+		if sec.Type == SectionHeader && sec.Anchor == s.opts.StartAnchor {
+			header, _ := getHeadingText(sec.Lines[0])
+			fmt.Fprintln(s.w, fill(s.messages().StartedAt, "section", header))
+			return
+		}
+	}
+}
+
+// skipBeforeLine drops the sections that end before line, keeping those tagged
+// "always".
+func skipBeforeLine(sections []Section, line int) []Section {
+	kept := []Section{}
+	for _, sec := range sections {
+		if sec.EndLine >= line || checkForAlwaysTag(sec.Tags) {
+			kept = append(kept, sec)
+		}
+	}
+	return kept
+}
+
+// keepSubtrees keeps the sections under the headers with the given anchors,
+// down to the next header of the same or a higher level, along with the
+// sections tagged "always".
+func keepSubtrees(sections []Section, anchors []string) []Section {
+	selected := map[string]bool{}
+	for _, anchor := range anchors {
+		selected[anchor] = true
+	}
+	kept := []Section{}
+	// level is the level of the selected header being kept, or zero.
+	level := 0
+	for _, sec := range sections {
+		if sec.Type == SectionHeader {
+			if level > 0 && sec.Level <= level {
+				level = 0
+			}
+			if level == 0 && selected[sec.Anchor] {
+				level = sec.Level
+			}
+		}
+		if level > 0 || checkForAlwaysTag(sec.Tags) {
+			kept = append(kept, sec)
+		}
+	}
+	return kept
+}
+
+// LineRange is an inclusive range of 1-based line numbers.
+type LineRange struct {
+	Start int
+	End   int
+}
+
+// keepLineRanges keeps the header sections, i.e. a header and the sections up
+// to the next header, that overlap one of ranges, along with the sections
+// tagged "always".
+func keepLineRanges(sections []Section, ranges []LineRange) []Section {
+	kept := []Section{}
+	for start := 0; start < len(sections); {
+		end := start + 1
+		for end < len(sections) && sections[end].Type != SectionHeader {
+			end++
+		}
+		// The header section runs up to the line before the next header.
+		first, last := sections[start].StartLine, sections[end-1].EndLine
+		if end < len(sections) {
+			last = sections[end].StartLine - 1
+		}
+		changed := false
+		for _, r := range ranges {
+			if r.Start <= last && r.End >= first {
+				changed = true
+				break
 			}
+		}
+		for _, sec := range sections[start:end] {
+			if changed || checkForAlwaysTag(sec.Tags) {
+				kept = append(kept, sec)
+			}
+		}
+		start = end
+	}
+	return kept
+}
 
-			if exit {
-				return nil
+// warnUnknownAnswers warns about supplied answers that don't match any of
+// the prompts in sections, e.g. because of a typo in the variable name.
+func (s *session) warnUnknownAnswers(sections []Section) {
+	prompts := map[string]bool{}
+	for _, sec := range sections {
+		if sec.Type != SectionPrompt {
+			continue
+		}
+		if pd, err := parsePrompt(strings.TrimSpace(sec.Lines[0])); err == nil {
+			prompts[pd.VarName] = true
+		}
+	}
+	names := make([]string, 0, len(s.opts.Answers))
+	for name := range s.opts.Answers {
+		if !prompts[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintln(s.w, fill(s.messages().UnknownAnswer, "name", strconv.Quote(name)))
+	}
+}
+
+// limitSections keeps the sections up to the header after the first max
+// headers and reports whether any were left out.
+func limitSections(sections []Section, max int) ([]Section, bool) {
+	headers := 0
+	for i, sec := range sections {
+		if sec.Type != SectionHeader {
+			continue
+		}
+		if headers == max {
+			return sections[:i], true
+		}
+		headers++
+	}
+	return sections, false
+}
+
+// selectSections returns the sections of the markdown content that a run with
+// opts goes through.
+func selectSections(mdContent []byte, opts Options) []Section {
+	sections := parseSections(mdContent, opts.StartAnchor, opts.Tags)
+	if opts.StartLine > 0 {
+		sections = skipBeforeLine(sections, opts.StartLine)
+	}
+	if len(opts.Sections) > 0 {
+		sections = keepSubtrees(sections, opts.Sections)
+	}
+	if len(opts.LineRanges) > 0 {
+		sections = keepLineRanges(sections, opts.LineRanges)
+	}
+	if len(opts.TagOrder) > 0 {
+		sections = orderByTags(sections, opts.TagOrder)
+	}
+	return sections
+}
+
+func (s *session) run(mdContent []byte) error {
+	sections := selectSections(mdContent, s.opts)
+	limited := false
+	if s.opts.MaxSections > 0 {
+		sections, limited = limitSections(sections, s.opts.MaxSections)
+	}
+	if s.opts.UseDefaults {
+		if err := s.checkDefaults(sections); err != nil {
+			return err
+		}
+	}
+	s.warnUnknownAnswers(sections)
+	s.printStart(sections)
+	var numbers map[int]string
+	if s.opts.NumberHeadings {
+		numbers = headingNumbers(mdContent)
+	}
+	links := linkDefinitions(mdContent)
+	s.named = namedBlocks(mdContent)
+	repeat := max(s.opts.Repeat, 1)
+	for n := 1; n <= repeat; n++ {
+		if n > 1 {
+			// Each iteration starts over with the supplied answers, which
+			// prompts use up, and checks the preconditions again.
+			s.supplyAnswers()
+			s.requires = map[string]bool{}
+			s.lastChoice = ""
+		}
+		if repeat > 1 {
+			if n > 1 && s.opts.FreshShells {
+				if err := CloseRunners(); err != nil {
+					return err
+				}
+				if err := s.exportEnv(); err != nil {
+					return err
+				}
 			}
+			fmt.Fprintln(s.w, "\n"+fill(s.messages().Iteration, "n", strconv.Itoa(n), "count", strconv.Itoa(repeat))+"\n")
+		}
+		if err := s.runSections(sections, numbers, links); err != nil {
+			return err
+		}
+	}
+	if limited {
+		fmt.Fprintln(s.w, "\n"+fill(s.messages().MaxSections, "count", strconv.Itoa(s.opts.MaxSections)))
+	}
+	s.printTimings()
+	s.printFailures()
+	s.printVars()
+	s.emit(Event{Type: EventComplete})
+	if !s.opts.OmitCompleteMessage {
+		fmt.Fprintln(s.w, "\n"+s.messages().Complete)
+	}
+	return nil
+}
+
+// runSections shows the sections in turn, running their code blocks and
+// asking their prompts.  numbers holds the outline numbers of the headers, by
+// line, and links the URLs of the reference links.
+func (s *session) runSections(sections []Section, numbers map[int]string, links map[string]string) error {
+	// next is the index of the first section not yet handled as part of a
+	// group of parallel or grouped code blocks.
+	next := 0
+	for i, sec := range sections {
+		if i < next {
 			continue
-		case SectionPrompt:
-			for ok := false; !ok; {
-				kv, err := processPrompt(promptFunc, sec.Lines)
+		}
+		// Preconditions are checked again for each header section.
+		if sec.Type == SectionHeader {
+			s.requires = map[string]bool{}
+			s.lastChoice = ""
+		}
+		if ok, err := s.sectionShown(sec); err != nil {
+			return err
+		} else if !ok {
+			continue
+		}
+		s.result.SectionsShown++
+		switch sec.Type {
+		case SectionCode:
+			if group, span := parallelGroup(sections[i:]); len(group) > 1 {
+				next = i + span
+				blocks, err := s.showGroup(sections[i:next])
 				if err != nil {
-					fmt.Fprintln(w, err)
-					continue
-				} else {
-					fmt.Fprintln(w)
-					ok = true
+					return err
+				}
+				if err := s.processParallel(blocks); err != nil {
+					return err
+				}
+				continue
+			}
+			if group, span := blockGroup(sections[i:]); len(group) > 1 {
+				next = i + span
+				blocks, err := s.showGroup(sections[i:next])
+				if err != nil {
+					return err
 				}
-				for k, v := range kv {
-					os.Setenv(k, v)
+				if err := s.processGroup(blocks); err != nil {
+					return err
 				}
+				continue
+			}
+			s.showSection(sec)
+			fmt.Fprintln(s.w, strings.Join(renderCode(sec.Lines), "\n"))
+			s.setBlock(sec)
+			if err := s.processCodeBlock(sec.Lines, ""); err != nil {
+				return err
+			}
+			continue
+		case SectionPrompt:
+			s.showSection(sec)
+			if err := s.processPromptSection(sec.Lines); err != nil {
+				return err
+			}
+			continue
+		case SectionRun:
+			block, err := resolveRun(sec, s.named)
+			if err != nil {
+				return err
+			}
+			s.showSection(block)
+			fmt.Fprintln(s.w, strings.Join(renderCode(block.Lines), "\n"))
+			s.setBlock(block)
+			if err := s.processCodeBlock(block.Lines, ""); err != nil {
+				return err
 			}
 			continue
 		case SectionHeader:
-			fmt.Fprintln(w, strings.Join(sec.Lines, "\n"))
+			s.header, _ = getHeadingText(sec.Lines[0])
+			s.emit(Event{Type: EventSection})
+			s.showSection(sec)
+			header := sec.Lines[0]
+			if number, ok := numbers[sec.StartLine]; ok {
+				header = numberHeader(header, number)
+			}
+			lines := append(colorLines(colors.Header, renderHeader(header, s.opts.Theme)), renderBlockquotes(renderLinks(sec.Lines[1:], links))...)
+			printSection(s.w, s.opts.Pager, lines)
 			if i < len(sections)-1 {
 				nextSection := sections[i+1]
-				if nextSection.Type == SectionHeader {
+				if nextSection.Type == SectionHeader && s.opts.Auto {
+					fmt.Fprintln(s.w)
+				} else if nextSection.Type == SectionHeader {
 					// If the next section is a header, get its text.
 					heading := nextSection.Lines[0]
 					nextHeaderText, _ := getHeadingText(heading)
-					promptMsg := fmt.Sprintf("\n> Press Enter to continue to [%s] (or type 'exit'): ", nextHeaderText)
-					if strings.ToLower(promptFunc(promptMsg)) == "exit" {
-						return nil
+					promptMsg := "\n" + s.previewLine(nextSection) + fill(s.messages().NextSection, "section", nextHeaderText)
+					if strings.ToLower(s.askContinue(promptMsg)) == "exit" {
+						return ErrExit
 					} else {
-						fmt.Fprintln(w)
+						fmt.Fprintln(s.w)
 					}
 				} else {
 					continue
 				}
 			}
 		case SectionText:
-			fmt.Fprintln(w, strings.Join(sec.Lines, "\n"))
+			s.showSection(sec)
+			printSection(s.w, s.opts.Pager, renderBlockquotes(renderLinks(sec.Lines, links)))
 		}
 	}
-	fmt.Fprintln(w, "\n> README complete!")
 	return nil
 }
@@ -1,7 +1,10 @@
 package readmerunner
 
 import (
+	"bytes"
+	"errors"
 	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -84,3 +87,239 @@ func TestParseSections(t *testing.T) {
 		})
 	}
 }
+
+func TestWalkSections(t *testing.T) {
+	counts := map[SectionType]int{}
+	err := WalkSections([]byte(markdown), func(sec Section) error {
+		counts[sec.Type]++
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("WalkSections returned error: %v", err)
+	}
+	expected := map[SectionType]int{SectionText: 1, SectionHeader: 3, SectionCode: 1, SectionPrompt: 1}
+	if !reflect.DeepEqual(counts, expected) {
+		t.Errorf("Expected section counts %v, got %v", expected, counts)
+	}
+
+	stop := errors.New("stop")
+	visited := 0
+	err = WalkSections([]byte(markdown), func(sec Section) error {
+		visited++
+		if sec.Type == SectionCode {
+			return stop
+		}
+		return nil
+	})
+	if !errors.Is(err, stop) {
+		t.Errorf("Expected the callback's error, got %v", err)
+	}
+	if visited != 3 {
+		t.Errorf("Expected the walk to stop at the code block, visited %d sections", visited)
+	}
+}
+
+func TestParseSectionsHeadings(t *testing.T) {
+	md := "Intro\n# Readme Runner\n## Getting Started {#start}\n```bash\n# not a header\n```\n### Step 1: Install!\n#### Deep\n"
+	tc := []struct {
+		level  int
+		anchor string
+	}{
+		{1, "readme-runner"},
+		{2, "start"},
+		{3, "step-1-install"},
+		{4, "deep"},
+	}
+	var headers []Section
+	for _, sec := range parseSections([]byte(md), "", nil) {
+		if sec.Type == SectionHeader {
+			headers = append(headers, sec)
+		} else if sec.Level != 0 || sec.Anchor != "" {
+			t.Errorf("Expected no heading metadata on %v", sec.Lines)
+		}
+	}
+	if len(headers) != len(tc) {
+		t.Fatalf("Expected %d headers, got %d", len(tc), len(headers))
+	}
+	for i, tt := range tc {
+		t.Run(tt.anchor, func(t *testing.T) {
+			if headers[i].Level != tt.level || headers[i].Anchor != tt.anchor {
+				t.Errorf("Expected level %d and anchor %q, got %d and %q", tt.level, tt.anchor, headers[i].Level, headers[i].Anchor)
+			}
+		})
+	}
+}
+
+func TestParseSectionsComments(t *testing.T) {
+	md := "# Title\n[//]: # (authoring note)\nsome content\n[comment]:# (another note)\nmore content\n```bash\n[//]: # (kept in code)\n```\n"
+	expected := []Section{
+		{Type: SectionHeader, Lines: []string{"# Title", "some content", "more content"}},
+		{Type: SectionCode, Lines: []string{"```bash", "[//]: # (kept in code)", "```"}},
+	}
+
+	sections := parseSections([]byte(md), "", nil)
+	if len(sections) != len(expected) {
+		t.Fatalf("Expected %v sections, got %v", len(expected), len(sections))
+	}
+	for i, sec := range sections {
+		if sec.Type != expected[i].Type {
+			t.Errorf("Expected type %v, got %v", expected[i].Type, sec.Type)
+		}
+		if !reflect.DeepEqual(sec.Lines, expected[i].Lines) {
+			t.Errorf("Expected lines %v, got %v", expected[i].Lines, sec.Lines)
+		}
+	}
+}
+
+func TestParseSectionsFenceTags(t *testing.T) {
+	md := "# Title\n[tags]:# (setup)\n```bash {tags=linux,gpu}\necho gpu\n```\n```bash\necho any\n```\n"
+
+	sections := parseSections([]byte(md), "", nil)
+	if len(sections) != 3 {
+		t.Fatalf("Expected 3 sections, got %v", len(sections))
+	}
+	if want := []string{"setup", "linux", "gpu"}; !reflect.DeepEqual(sections[1].Tags, want) {
+		t.Errorf("Expected tags %v, got %v", want, sections[1].Tags)
+	}
+	if want := []string{"setup"}; !reflect.DeepEqual(sections[2].Tags, want) {
+		t.Errorf("Expected fence tags not to carry over, got %v", sections[2].Tags)
+	}
+
+	// Filtering by tags drops the blocks tagged for something else.
+	md = "# Title\n```bash {tags=gpu}\necho gpu\n```\n```bash {tags=linux}\necho linux\n```\n"
+	sections = parseSections([]byte(md), "", []string{"linux"})
+	if len(sections) != 1 || sections[0].Lines[1] != "echo linux" {
+		t.Errorf("Expected only the linux block, got %v", sections)
+	}
+}
+
+func TestParseSectionsCRLF(t *testing.T) {
+	crlf := strings.ReplaceAll(markdown, "\n", "\r\n")
+
+	sections := parseSections([]byte(crlf), "", nil)
+	expected := parseSections([]byte(markdown), "", nil)
+	if !reflect.DeepEqual(sections, expected) {
+		t.Errorf("Expected CRLF markdown to parse like LF markdown.\nGot:  %+v\nWant: %+v", sections, expected)
+	}
+	if len(sections) < 3 || sections[0].Type != SectionHeader || sections[2].Type != SectionCode {
+		t.Errorf("Expected headers and code fences to be recognized, got %+v", sections)
+	}
+}
+
+func TestNormalizeAnchor(t *testing.T) {
+	tc := []struct {
+		header   string
+		expected string
+	}{
+		{"Getting Started", "getting-started"},
+		{"What's new?", "whats-new"},
+		{"Step 1: Install (macOS)", "step-1-install-macos"},
+		{"pre-commit hooks", "pre-commit-hooks"},
+		{"Go🚀Fast", "gofast"},
+		{"🚀 Launch", "launch"},
+		{"Ship it ✨", "ship-it"},
+		{"Café Menu", "café-menu"},
+		{"Über Größe", "über-größe"},
+		{"安装 指南", "安装-指南"},
+	}
+	for _, tt := range tc {
+		t.Run(tt.header, func(t *testing.T) {
+			if got := NormalizeAnchor(tt.header); got != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, got)
+			}
+			if got := normalizeAnchor(tt.header); got != tt.expected {
+				t.Errorf("Expected normalizeAnchor to return %q, got %q", tt.expected, got)
+			}
+			if got, level := HeadingText("## " + tt.header); got != tt.header || level != 2 {
+				t.Errorf("Expected %q at level 2, got %q at level %d", tt.header, got, level)
+			}
+		})
+	}
+}
+
+func TestHeadingAnchor(t *testing.T) {
+	tc := []struct {
+		header string
+		text   string
+		anchor string
+	}{
+		{"## Setup", "Setup", "setup"},
+		{"## Setup {#install}", "Setup", "install"},
+		{"### Step 1: Build {#build-step}  ", "Step 1: Build", "build-step"},
+		{"## Use {braces}", "Use {braces}", "use-braces"},
+	}
+	for _, tt := range tc {
+		t.Run(tt.header, func(t *testing.T) {
+			if got, _ := HeadingText(tt.header); got != tt.text {
+				t.Errorf("Expected text %q, got %q", tt.text, got)
+			}
+			if got := HeadingAnchor(tt.header); got != tt.anchor {
+				t.Errorf("Expected anchor %q, got %q", tt.anchor, got)
+			}
+		})
+	}
+}
+
+func TestParseSectionsListFence(t *testing.T) {
+	md := "# Steps\n1. Do this:\n\n   ```bash\n   cat <<EOF\n   hi\n   EOF\n   ```\n2. Then this.\n"
+
+	sections := parseSections([]byte(md), "", nil)
+	if len(sections) != 3 || sections[1].Type != SectionCode {
+		t.Fatalf("Expected the indented fence to be a code section, got %+v", sections)
+	}
+	if sections[2].Type != SectionText || sections[2].Lines[0] != "2. Then this." {
+		t.Errorf("Expected the list to continue after the fence, got %+v", sections[2])
+	}
+
+	var buf bytes.Buffer
+	if _, err := RunMarkdownWithOptions([]byte(md), Options{Auto: true}, &buf, fakePrompt(nil)); err != nil {
+		t.Fatalf("RunMarkdownWithOptions returned error: %v", err)
+	}
+	if !strings.Contains(buf.String(), "> Output: hi\n") {
+		t.Errorf("Expected the fence's indentation to be removed before running, got %q", buf.String())
+	}
+}
+
+func TestDedent(t *testing.T) {
+	tc := []struct {
+		name     string
+		lines    []string
+		n        int
+		expected []string
+	}{
+		{"none", []string{"  a"}, 0, []string{"  a"}},
+		{"fence indent", []string{"   a", "     b"}, 3, []string{"a", "  b"}},
+		{"less indented", []string{" a", "b"}, 3, []string{"a", "b"}},
+	}
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := dedent(tt.lines, tt.n); !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("Expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestParseSectionsBOM(t *testing.T) {
+	sections := parseSections([]byte("\uFEFF"+markdown), "", nil)
+	if len(sections) == 0 || sections[0].Type != SectionHeader {
+		t.Fatalf("Expected first section to be a header, got %+v", sections)
+	}
+	if strings.HasPrefix(sections[0].Lines[0], "\uFEFF") {
+		t.Errorf("Expected BOM to be stripped, got %q", sections[0].Lines[0])
+	}
+}
+
+func TestParseSectionsLineNumbers(t *testing.T) {
+	expected := [][2]int{{1, 4}, {5, 8}, {9, 11}, {12, 12}, {13, 14}, {16, 16}}
+
+	sections := parseSections([]byte(markdown), "", nil)
+	if len(sections) != len(expected) {
+		t.Fatalf("Expected %v sections, got %v", len(expected), len(sections))
+	}
+	for i, sec := range sections {
+		if sec.StartLine != expected[i][0] || sec.EndLine != expected[i][1] {
+			t.Errorf("Section %d: expected lines %d-%d, got %d-%d", i, expected[i][0], expected[i][1], sec.StartLine, sec.EndLine)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package readmerunner
+
+import (
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// defaultWidth is the terminal width assumed when neither the terminal nor
+// $COLUMNS tells it.
+const defaultWidth = 80
+
+// terminalWidth returns the width of the terminal w writes to.  When w isn't
+// a terminal, or its size can't be asked for, the width exported by the shell
+// in $COLUMNS is used.
+func terminalWidth(w io.Writer) int {
+	if f, ok := w.(*os.File); ok {
+		if width, ok := consoleWidth(f); ok {
+			return width
+		}
+	}
+	if width, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && width > 0 {
+		return width
+	}
+	return defaultWidth
+}
+
+// sectionPreview returns the first line of the paragraph under a header, or
+// "" if the header is followed by something else, e.g. a code block.
+// Link definitions, which aren't shown, are passed over.
+func sectionPreview(sec Section) string {
+	for _, line := range sec.Lines[1:] {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || linkDefinitionRe.MatchString(trimmed) {
+			continue
+		}
+		return trimmed
+	}
+	return ""
+}
+
+// truncate shortens text to at most width characters, ending it with "..."
+// when anything was cut.
+func truncate(text string, width int) string {
+	if utf8.RuneCountInString(text) <= width {
+		return text
+	}
+	if width <= 3 {
+		return string([]rune(text)[:max(width, 0)])
+	}
+	return strings.TrimRight(string([]rune(text)[:width-3]), " ") + "..."
+}
+
+// previewLine returns the line shown ahead of the prompt to continue to a
+// header, previewing its first paragraph within the terminal width, or "" if
+// there's nothing to preview.
+func (s *session) previewLine(sec Section) string {
+	preview := sectionPreview(sec)
+	if preview == "" {
+		return ""
+	}
+	msg := s.messages().Preview
+	room := terminalWidth(s.w) - utf8.RuneCountInString(fill(msg, "text", ""))
+	return fill(msg, "text", truncate(preview, room)) + "\n"
+}
@@ -0,0 +1,79 @@
+package readmerunner
+
+import (
+	"io"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestTruncate(t *testing.T) {
+	tc := []struct {
+		name     string
+		text     string
+		width    int
+		expected string
+	}{
+		{"fits", "Install the tools", 20, "Install the tools"},
+		{"exact", "Install", 7, "Install"},
+		{"cut", "Install the tools first", 14, "Install the..."},
+		{"multibyte", "Déjà installé", 8, "Déjà..."},
+		{"narrow", "Install", 2, "In"},
+	}
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := truncate(tt.text, tt.width); got != tt.expected {
+				t.Errorf("truncate(%q, %d) = %q, want %q", tt.text, tt.width, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestRunMarkdownNextSectionPreview(t *testing.T) {
+	t.Setenv("COLUMNS", "40")
+	mdContent := []byte("# One\n## Two\n\n[docs]: https://example.com\nThis section installs every tool the project needs to build.\nMore text.\n## Three\n```bash\necho hi\n```\n")
+
+	var prompts []string
+	prompt := func(msg string) string {
+		prompts = append(prompts, msg)
+		return "s"
+	}
+	if _, err := RunMarkdownWithOptions(mdContent, Options{}, io.Discard, prompt); err != nil {
+		t.Fatalf("RunMarkdownWithOptions returned error: %v", err)
+	}
+	expected := []string{
+		"\n> Next: This section installs every t...\n> Press Enter to continue to [Two] (or type 'exit'): ",
+		"\n> Press Enter to continue to [Three] (or type 'exit'): ",
+		"\n" + DefaultMessages.RunCode,
+	}
+	if !reflect.DeepEqual(prompts, expected) {
+		t.Errorf("Expected prompts %q, got %q", expected, prompts)
+	}
+}
+
+func TestTerminalWidth(t *testing.T) {
+	file, err := os.CreateTemp(t.TempDir(), "output")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	tc := []struct {
+		name     string
+		w        io.Writer
+		columns  string
+		expected int
+	}{
+		{"columns", io.Discard, "120", 120},
+		{"not a terminal", file, "100", 100},
+		{"unset", io.Discard, "", defaultWidth},
+		{"invalid", file, "wide", defaultWidth},
+	}
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("COLUMNS", tt.columns)
+			if got := terminalWidth(tt.w); got != tt.expected {
+				t.Errorf("terminalWidth() = %d, want %d", got, tt.expected)
+			}
+		})
+	}
+}
@@ -1,79 +1,154 @@
 package readmerunner
 
 import (
+	"errors"
 	"fmt"
+	"os"
+	"path/filepath"
 	"regexp"
 	"strings"
 )
 
+// ErrNoDefault is returned before a run with Options.UseDefaults starts when
+// a prompt has neither a default nor a supplied answer.
+var ErrNoDefault = errors.New("no default")
+
 type Prompt struct {
-	VarName string   // the variable name to save the value into
-	Text    string   // the prompt to display to the user
-	Options []string // optional valid options (if provided)
-	Default string   // optional default value
+	VarName    string   // the variable name to save the value into
+	Text       string   // the prompt to display to the user
+	Options    []string // optional valid options (if provided)
+	OptionsCmd string   // optional command whose output lines are the options
+	Confirm    bool     // whether this is a yes/no prompt answered with true/false
+	Multiline  bool     // whether the answer is several lines ended by an empty line
+	File       string   // optional file the answer is also written to
+	Default    string   // optional default value
+}
+
+// promptLineRe matches the start of a prompt directive.  Spaces are allowed
+// around the "#", as in "[prompt]: # (...)".
+var promptLineRe = regexp.MustCompile(`^\[prompt\]:\s*#`)
+
+// isPromptLine reports whether a trimmed line is a prompt directive.
+func isPromptLine(trimmed string) bool {
+	return promptLineRe.MatchString(trimmed)
 }
 
-// parsePrompt parses a single prompt line.
-// Example line:
+// promptTextUnescaper undoes the escaping of quotes and backslashes in the
+// text of a prompt.
+var promptTextUnescaper = strings.NewReplacer(`\"`, `"`, `\\`, `\`)
+
+// parsePrompt parses a single prompt line.  Any amount of spaces or tabs may
+// separate its parts, and options may be separated by commas.
+// Example lines:
 // [prompt]:# (eggs "How many eggs?"  [0,1,2,3,4,5,6] 6)
+// [prompt]:# (branch "Which branch?" $(git branch --format='%(refname:short)'))
+// [prompt]:# (proceed "Continue?" confirm yes)
+// [prompt]:# (config "Paste config" multiline >config.yaml)
 func parsePrompt(line string) (*Prompt, error) {
 	// This regex matches:
 	//   Group 1: variable name (alphanumeric and underscore)
-	//   Group 2: prompt text inside double quotes
-	//   Group 3: optional options list (including square brackets)
-	//   Group 4: optional default value (non-space token)
-	re := regexp.MustCompile(`^\[prompt\]:#\s*\(\s*(\w+)\s+"([^"]+)"\s*(\[[^\]]*\])?\s*(\S+)?\s*\)$`)
+	//   Group 2: prompt text inside double quotes, where \" is a quote
+	//   Group 3: optional options list (including square brackets), a
+	//            command substitution, $(...), producing the options, or the
+	//            confirm keyword for a yes/no prompt, or the multiline
+	//            keyword for an answer of several lines
+	//   Group 4: optional file the answer is written to, after a ">"
+	//   Group 5: optional default value (non-space token)
+	re := regexp.MustCompile(`^\[prompt\]:\s*#\s*\(\s*(\w+)\s*"((?:[^"\\]|\\.)+)"\s*(\[[^\]]*\]|\$\(.*\)|confirm\b|multiline\b)?\s*(?:>\s*(\S+))?\s*(\S+)?\s*\)$`)
 	matches := re.FindStringSubmatch(line)
 	if matches == nil || len(matches) < 3 {
 		return nil, fmt.Errorf("invalid prompt format: %s", line)
 	}
 	pd := &Prompt{
 		VarName: matches[1],
-		Text:    matches[2],
+		Text:    promptTextUnescaper.Replace(matches[2]),
 	}
-	if len(matches) > 3 && matches[3] != "" {
-		// Remove brackets and split by spaces
+	if len(matches) > 3 && matches[3] == "confirm" {
+		pd.Confirm = true
+	} else if len(matches) > 3 && matches[3] == "multiline" {
+		pd.Multiline = true
+	} else if len(matches) > 3 && strings.HasPrefix(matches[3], "$(") {
+		pd.OptionsCmd = strings.TrimSuffix(strings.TrimPrefix(matches[3], "$("), ")")
+	} else if len(matches) > 3 && matches[3] != "" {
+		// Remove brackets and split by spaces and commas.
 		optionsStr := strings.Trim(matches[3], "[]")
-		opts := strings.Fields(optionsStr)
-		// opts := strings.Split(optionsStr, ",")
-		for i, opt := range opts {
-			opts[i] = strings.TrimSpace(opt)
-		}
-		pd.Options = opts
+		pd.Options = strings.FieldsFunc(optionsStr, isListSeparator)
 	}
-	if len(matches) > 4 && matches[4] != "" {
-		pd.Default = matches[4]
+	if len(matches) > 4 {
+		pd.File = matches[4]
+	}
+	if len(matches) > 5 && matches[5] != "" {
+		pd.Default = matches[5]
 	}
 	return pd, nil
 }
 
-// processPrompts scans the markdown content for prompt s,
+// processPrompt scans the prompt lines for prompt directives,
 // prompts the user accordingly, validates responses if options are provided,
 // and returns a map of variable names to responses.
-func processPrompt(promptFunc func(string) string, prompt []string) (map[string]string, error) {
+func (s *session) processPrompt(prompt []string) (map[string]string, error) {
 	varMap := make(map[string]string)
 	for _, line := range prompt {
 		line = strings.TrimSpace(line)
-		if strings.HasPrefix(line, "[prompt]:#") {
+		if isPromptLine(line) {
 			pd, err := parsePrompt(line)
 			if err != nil {
 				return nil, err
 			}
+			// Defaults supplied for the run take precedence over the directive.
+			if def, ok := s.opts.Defaults[pd.VarName]; ok {
+				pd.Default = def
+			}
 			// Build a full prompt message.
 			fullPrompt := pd.Text
+			if pd.OptionsCmd != "" {
+				opts, err := s.loadOptions(pd.OptionsCmd)
+				if err != nil {
+					// Fall back to a free-form answer rather than blocking the run.
+					fullPrompt += fmt.Sprintf(" (could not load options: %v)", err)
+				}
+				pd.Options = opts
+			}
+			if pd.Default == "" && len(pd.Options) > 0 && s.opts.FirstOptionDefault && !s.opts.UseDefaults {
+				pd.Default = pd.Options[0]
+			}
 			if len(pd.Options) > 0 {
 				fullPrompt += " (options: " + strings.Join(pd.Options, ", ") + ")"
 			}
+			if pd.Confirm {
+				fullPrompt += " (y/n)"
+			}
+			if pd.Multiline {
+				fullPrompt += " (end with an empty line)"
+			}
 			if pd.Default != "" {
 				fullPrompt += fmt.Sprintf(" [default: %s]", pd.Default)
 			}
 			fullPrompt += ": "
 
-			response := promptFunc("\n" + fullPrompt)
+			// Answers supplied for the run are used without asking.
+			response, preset := s.answers[pd.VarName]
+			if !preset && pd.Multiline {
+				response = s.askLines("\n" + fullPrompt)
+			} else if !preset {
+				response = s.ask("\n" + fullPrompt)
+			}
 
 			// If no response and a default is provided, use default.
 			if response == "" && pd.Default != "" {
 				response = pd.Default
+			} else if response == "" && s.promptTimedOut() {
+				return nil, fmt.Errorf("%w for %s within %s and it has no default", ErrPromptTimeout, pd.VarName, s.opts.PromptTimeout)
+			}
+
+			// Confirmations are stored as booleans.
+			if pd.Confirm {
+				confirmed, ok := parseConfirm(response)
+				if !ok {
+					delete(s.answers, pd.VarName)
+					return nil, fmt.Errorf("invalid response for %s. Must be yes or no", pd.VarName)
+				}
+				response = confirmed
 			}
 
 			// Ensure response is a valid option if options are provided.
@@ -86,11 +161,108 @@ func processPrompt(promptFunc func(string) string, prompt []string) (map[string]
 					}
 				}
 				if !valid {
+					// Ask the user next time rather than repeating a bad answer.
+					delete(s.answers, pd.VarName)
 					return nil, fmt.Errorf("invalid response for %s. Must be one of %v", pd.VarName, pd.Options)
 				}
 			}
+			if pd.File != "" {
+				if err := s.writePromptFile(pd.File, response); err != nil {
+					return nil, err
+				}
+			}
 			varMap[pd.VarName] = response
 		}
 	}
 	return varMap, nil
 }
+
+// checkDefaults returns an error wrapping ErrNoDefault that names the prompts
+// of sections with neither a default nor a supplied answer, which a run with
+// Options.UseDefaults can't answer.
+func (s *session) checkDefaults(sections []Section) error {
+	var missing []string
+	for _, sec := range sections {
+		if sec.Type != SectionPrompt {
+			continue
+		}
+		pd, err := parsePrompt(strings.TrimSpace(sec.Lines[0]))
+		if err != nil || pd.Default != "" {
+			continue
+		}
+		if _, ok := s.opts.Defaults[pd.VarName]; ok {
+			continue
+		}
+		if _, ok := s.answers[pd.VarName]; ok {
+			continue
+		}
+		missing = append(missing, pd.VarName)
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("%w for %s", ErrNoDefault, strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// askLines asks for an answer of several lines, ended by an empty line, and
+// returns the lines joined by newlines.
+func (s *session) askLines(msg string) string {
+	var lines []string
+	for line := s.ask(msg); line != ""; line = s.ask("") {
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// writePromptFile writes the answer to a prompt to the file named by its
+// directive.  A relative path is taken from the directory of the shell the
+// code blocks run in, which they may have changed.
+func (s *session) writePromptFile(path, answer string) error {
+	if !filepath.IsAbs(path) {
+		if dir, status, err := s.shellRun("pwd"); err == nil && status == 0 {
+			path = filepath.Join(strings.TrimSpace(dir), path)
+		}
+	}
+	if answer != "" && !strings.HasSuffix(answer, "\n") {
+		answer += "\n"
+	}
+	if err := os.WriteFile(path, []byte(answer), 0644); err != nil {
+		return fmt.Errorf("writing answer to %s: %w", path, err)
+	}
+	return nil
+}
+
+// parseConfirm converts a yes/no answer to "true" or "false".  It reports
+// false if the answer is neither.
+func parseConfirm(response string) (string, bool) {
+	switch strings.ToLower(strings.TrimSpace(response)) {
+	case "y", "yes", "true":
+		return "true", true
+	case "n", "no", "false":
+		return "false", true
+	}
+	return "", false
+}
+
+// loadOptions runs cmd where the shell code blocks run and returns each
+// non-empty line of its output as an option.
+func (s *session) loadOptions(cmd string) ([]string, error) {
+	// Discard stderr so error messages aren't mistaken for options.
+	out, status, err := s.shellRun("{ " + cmd + "\n} 2>/dev/null")
+	if err != nil {
+		return nil, err
+	}
+	if status != 0 {
+		return nil, fmt.Errorf("%q exited with status %d", cmd, status)
+	}
+	var opts []string
+	for _, line := range strings.Split(out, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			opts = append(opts, line)
+		}
+	}
+	if len(opts) == 0 {
+		return nil, fmt.Errorf("%q returned no options", cmd)
+	}
+	return opts, nil
+}
@@ -1,7 +1,13 @@
 package readmerunner
 
 import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -20,6 +26,21 @@ func TestParsePrompt(t *testing.T) {
 		{"wrong order 1", "[prompt]:# (name \"What is your name?\" alice [alice, bob])", nil, true},
 		{"wrong order 2", "[prompt]:# (\"What is your name?\" name)", nil, true},
 		{"omit options", "[prompt]:# (name \"What is your name?\" alice)", &Prompt{VarName: "name", Text: "What is your name?", Default: "alice"}, false},
+		{"command options", "[prompt]:# (branch \"Which branch?\" $(git branch --format='%(refname:short)'))", &Prompt{VarName: "branch", Text: "Which branch?", OptionsCmd: "git branch --format='%(refname:short)'"}, false},
+		{"confirm", "[prompt]:# (proceed \"Continue?\" confirm)", &Prompt{VarName: "proceed", Text: "Continue?", Confirm: true}, false},
+		{"confirm with default", "[prompt]:# (proceed \"Continue?\" confirm yes)", &Prompt{VarName: "proceed", Text: "Continue?", Confirm: true, Default: "yes"}, false},
+		{"default starting with confirm", "[prompt]:# (mode \"Mode?\" confirmed)", &Prompt{VarName: "mode", Text: "Mode?", Default: "confirmed"}, false},
+		{"tabs", "[prompt]:#\t(name\t\"Name?\"\t[a\tb]\ta)", &Prompt{VarName: "name", Text: "Name?", Options: []string{"a", "b"}, Default: "a"}, false},
+		{"extra spaces", "[prompt]:#   (  name   \"Name?\"   [ a  b ]   a  )", &Prompt{VarName: "name", Text: "Name?", Options: []string{"a", "b"}, Default: "a"}, false},
+		{"space before hash", "[prompt]: # (name \"Name?\")", &Prompt{VarName: "name", Text: "Name?"}, false},
+		{"no space before text", "[prompt]:#(name\"Name?\")", &Prompt{VarName: "name", Text: "Name?"}, false},
+		{"comma options", "[prompt]:# (eggs \"How many?\" [0, 1,2] 1)", &Prompt{VarName: "eggs", Text: "How many?", Options: []string{"0", "1", "2"}, Default: "1"}, false},
+		{"command options with default", "[prompt]:# (branch \"Which branch?\" $(git branch) main)", &Prompt{VarName: "branch", Text: "Which branch?", OptionsCmd: "git branch", Default: "main"}, false},
+		{"escaped quotes", `[prompt]:# (q "What's your \"name\"?" bob)`, &Prompt{VarName: "q", Text: `What's your "name"?`, Default: "bob"}, false},
+		{"escaped backslash", `[prompt]:# (dir "Folder (e.g. C:\\Temp\\)?")`, &Prompt{VarName: "dir", Text: `Folder (e.g. C:\Temp\)?`}, false},
+		{"multiline to file", "[prompt]:# (config \"Paste config\" multiline >config.yaml)", &Prompt{VarName: "config", Text: "Paste config", Multiline: true, File: "config.yaml"}, false},
+		{"file with default", "[prompt]:# (name \"Name?\" > name.txt alice)", &Prompt{VarName: "name", Text: "Name?", File: "name.txt", Default: "alice"}, false},
+		{"options to file", "[prompt]:# (env \"Env?\" [dev prod] >env.txt dev)", &Prompt{VarName: "env", Text: "Env?", Options: []string{"dev", "prod"}, File: "env.txt", Default: "dev"}, false},
 	}
 	for _, tt := range tc {
 		t.Run(tt.name, func(t *testing.T) {
@@ -45,6 +66,22 @@ func TestParsePrompt(t *testing.T) {
 					t.Errorf("Expected %v, got %v", tt.expected.Options, prompt.Options)
 				}
 
+				if prompt.OptionsCmd != tt.expected.OptionsCmd {
+					t.Errorf("Expected %q, got %q", tt.expected.OptionsCmd, prompt.OptionsCmd)
+				}
+
+				if prompt.Confirm != tt.expected.Confirm {
+					t.Errorf("Expected confirm %v, got %v", tt.expected.Confirm, prompt.Confirm)
+				}
+
+				if prompt.Multiline != tt.expected.Multiline {
+					t.Errorf("Expected multiline %v, got %v", tt.expected.Multiline, prompt.Multiline)
+				}
+
+				if prompt.File != tt.expected.File {
+					t.Errorf("Expected file %q, got %q", tt.expected.File, prompt.File)
+				}
+
 				if prompt.Default != tt.expected.Default {
 					t.Errorf("Expected %q, got %q", tt.expected.Default, prompt.Default)
 				}
@@ -53,6 +90,103 @@ func TestParsePrompt(t *testing.T) {
 	}
 }
 
+func TestProcessPromptFile(t *testing.T) {
+	dir := t.TempDir()
+	tc := []struct {
+		name      string
+		prompt    string
+		responses []string
+		file      string
+		expected  string
+	}{
+		{"Multiline", `[prompt]:# (config "Paste config" multiline >` + filepath.Join(dir, "config.yaml") + `)`, []string{"a: 1", "b: 2", ""}, "config.yaml", "a: 1\nb: 2\n"},
+		{"Default", `[prompt]:# (name "Name?" >` + filepath.Join(dir, "name.txt") + ` alice)`, []string{""}, "name.txt", "alice\n"},
+	}
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &session{promptFunc: fakePrompt(tt.responses)}
+			if _, err := s.processPrompt([]string{tt.prompt}); err != nil {
+				t.Fatalf("processPrompt returned error: %v", err)
+			}
+			content, err := os.ReadFile(filepath.Join(dir, tt.file))
+			if err != nil {
+				t.Fatalf("Expected %s to be written: %v", tt.file, err)
+			}
+			if string(content) != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, content)
+			}
+		})
+	}
+}
+
+func TestRunMarkdownPromptFileRelative(t *testing.T) {
+	dir := t.TempDir()
+	defer CloseRunners()
+	mdContent := []byte("```bash\ncd " + dir + "\n```\n[prompt]:# (config \"Paste config\" multiline >config.yaml)\n")
+	opts := Options{Auto: true, Answers: map[string]string{"config": "key: value"}}
+	if _, err := RunMarkdownWithOptions(mdContent, opts, io.Discard, fakePrompt(nil)); err != nil {
+		t.Fatalf("RunMarkdownWithOptions returned error: %v", err)
+	}
+	content, err := os.ReadFile(filepath.Join(dir, "config.yaml"))
+	if err != nil {
+		t.Fatalf("Expected config.yaml in the shell's directory: %v", err)
+	}
+	if string(content) != "key: value\n" {
+		t.Errorf("Expected %q, got %q", "key: value\n", content)
+	}
+}
+
+func TestProcessPromptFirstOptionDefault(t *testing.T) {
+	tc := []struct {
+		name     string
+		prompt   string
+		expected string
+	}{
+		{"options", "[prompt]:# (name \"What is your name?\" [Alice Bob])", "Alice"},
+		{"explicit default", "[prompt]:# (name \"What is your name?\" [Alice Bob] Bob)", "Bob"},
+		{"command options", `[prompt]:# (pick "Pick one" $(printf 'a\nb\n'))`, "a"},
+	}
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			var msg string
+			s := &session{opts: Options{FirstOptionDefault: true}, promptFunc: func(m string) string {
+				msg = m
+				return ""
+			}}
+			res, err := s.processPrompt([]string{tt.prompt})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			for k, v := range res {
+				if v != tt.expected {
+					t.Errorf("Expected %s=%q, got %q", k, tt.expected, v)
+				}
+			}
+			if !strings.Contains(msg, "[default: "+tt.expected+"]") {
+				t.Errorf("Expected the default to be shown, got %q", msg)
+			}
+		})
+	}
+}
+
+func TestProcessPromptEscapedQuotes(t *testing.T) {
+	var msg string
+	s := &session{promptFunc: func(m string) string {
+		msg = m
+		return "Bob"
+	}}
+	res, err := s.processPrompt([]string{`[prompt]:# (name "What's your \"name\"?")`})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if res["name"] != "Bob" {
+		t.Errorf("Expected name=%q, got %q", "Bob", res["name"])
+	}
+	if want := "\nWhat's your \"name\"?: "; msg != want {
+		t.Errorf("Expected prompt %q, got %q", want, msg)
+	}
+}
+
 func TestProcessPrompt(t *testing.T) {
 	tc := []struct {
 		name      string
@@ -68,11 +202,21 @@ func TestProcessPrompt(t *testing.T) {
 		{"missing response", []string{"[prompt]:# (name \"What is your name?\" [Alice Bob] Alice)"}, []string{""}, map[string]string{"name": "Alice"}, false},
 		{"missing default", []string{"[prompt]:# (name \"What is your name?\" [Alice Bob])"}, []string{""}, nil, true},
 		{"missing options", []string{"[prompt]:# (name \"What is your name?\")"}, []string{"Alice"}, map[string]string{"name": "Alice"}, false},
+		{"command options", []string{`[prompt]:# (pick "Pick one" $(echo -e "a\nb"))`}, []string{"b"}, map[string]string{"pick": "b"}, false},
+		{"invalid command option", []string{`[prompt]:# (pick "Pick one" $(echo -e "a\nb"))`}, []string{"c"}, nil, true},
+		{"confirm yes", []string{`[prompt]:# (proceed "Continue?" confirm)`}, []string{"Y"}, map[string]string{"proceed": "true"}, false},
+		{"confirm no", []string{`[prompt]:# (proceed "Continue?" confirm)`}, []string{"no"}, map[string]string{"proceed": "false"}, false},
+		{"confirm default", []string{`[prompt]:# (proceed "Continue?" confirm yes)`}, []string{""}, map[string]string{"proceed": "true"}, false},
+		{"confirm missing default", []string{`[prompt]:# (proceed "Continue?" confirm)`}, []string{""}, nil, true},
+		{"confirm invalid", []string{`[prompt]:# (proceed "Continue?" confirm)`}, []string{"maybe"}, nil, true},
+		{"failed command", []string{`[prompt]:# (pick "Pick one" $(false))`}, []string{"c"}, map[string]string{"pick": "c"}, false},
+		{"loose whitespace", []string{"  [prompt]: #\t( name  \"Name?\"\t[Alice, Bob]  Alice )"}, []string{"Bob"}, map[string]string{"name": "Bob"}, false},
+		{"multiline", []string{`[prompt]:# (config "Paste config" multiline)`}, []string{"a: 1", "b: 2", ""}, map[string]string{"config": "a: 1\nb: 2"}, false},
 	}
 	for _, tt := range tc {
 		t.Run(tt.name, func(t *testing.T) {
-			responses := fakePrompt(tt.responses)
-			res, err := processPrompt(responses, tt.prompt)
+			s := &session{promptFunc: fakePrompt(tt.responses)}
+			res, err := s.processPrompt(tt.prompt)
 			if err != nil {
 				if !tt.expectErr {
 					t.Fatalf("Unexpected error: %v", err)
@@ -89,3 +233,63 @@ func TestProcessPrompt(t *testing.T) {
 		})
 	}
 }
+
+func TestRunMarkdownUseDefaults(t *testing.T) {
+	tc := []struct {
+		name     string
+		markdown string
+		opts     Options
+		expected map[string]string
+		wantErr  bool
+	}{
+		{
+			"Defaults",
+			"# Setup\n[prompt]:# (region \"Which region?\" [eu us] us)\n[prompt]:# (proceed \"Proceed?\" confirm yes)\n[prompt]:# (name \"Name?\" bob)\n",
+			Options{UseDefaults: true},
+			map[string]string{"region": "us", "proceed": "true", "name": "bob"},
+			false,
+		},
+		{
+			"Supplied Defaults And Answers",
+			"# Setup\n[prompt]:# (region \"Which region?\" [eu us])\n[prompt]:# (name \"Name?\")\n",
+			Options{UseDefaults: true, Defaults: map[string]string{"region": "eu"}, Answers: map[string]string{"name": "alice"}},
+			map[string]string{"region": "eu", "name": "alice"},
+			false,
+		},
+		{
+			"Missing Default",
+			"# Setup\n[prompt]:# (region \"Which region?\" [eu us])\n[prompt]:# (name \"Name?\")\n[prompt]:# (team \"Team?\" core)\n",
+			Options{UseDefaults: true, FirstOptionDefault: true},
+			nil,
+			true,
+		},
+	}
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			prompt := func(msg string) string {
+				t.Errorf("Unexpected prompt %q", msg)
+				return ""
+			}
+			result, err := RunMarkdownWithOptions([]byte(tt.markdown), tt.opts, &buf, prompt)
+			if tt.wantErr {
+				if !errors.Is(err, ErrNoDefault) {
+					t.Fatalf("Expected ErrNoDefault, got %v", err)
+				}
+				if !strings.Contains(err.Error(), "region, name") {
+					t.Errorf("Expected the error to name the prompts, got %v", err)
+				}
+				if strings.Contains(buf.String(), "# Setup") {
+					t.Errorf("Expected the run to fail before it starts, got %q", buf.String())
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("RunMarkdownWithOptions returned error: %v", err)
+			}
+			if !reflect.DeepEqual(result.Answers, tt.expected) {
+				t.Errorf("Expected answers %v, got %v", tt.expected, result.Answers)
+			}
+		})
+	}
+}
@@ -2,12 +2,15 @@ package readmerunner
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
 	"io"
-	"log"
+	"os"
 	"os/exec"
+	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 )
 
 // CodeRunner defines a standard interface to run code snippets.
@@ -27,6 +30,7 @@ type runnerIO struct {
 
 func newRunnerIO(command string) (*runnerIO, error) {
 	cmd := exec.Command(command)
+	cmd.Env = shellEnv()
 	stdin, err := cmd.StdinPipe()
 	if err != nil {
 		return nil, err
@@ -37,38 +41,67 @@ func newRunnerIO(command string) (*runnerIO, error) {
 	}
 	// Merge stderr into stdout so errors are captured.
 	cmd.Stderr = cmd.Stdout
+	setProcessGroup(cmd)
 	if err := cmd.Start(); err != nil {
 		return nil, err
 	}
 	scanner := bufio.NewScanner(stdout)
-	return &runnerIO{
+	r := &runnerIO{
 		cmd:     cmd,
 		stdin:   stdin,
 		stdout:  stdout,
 		scanner: scanner,
-	}, nil
+	}
+	// An interrupt should only stop the command it was sent to, not the
+	// shell.  Commands started by the shell still get the default handling.
+	if _, _, err := r.runStatus("trap : INT"); err != nil {
+		return nil, err
+	}
+	return r, nil
 }
 
 // Run executes the provided code in the persistent shell.
 func (r *runnerIO) Run(code string) (string, error) {
+	output, _, err := r.RunStatus(code)
+	return output, err
+}
+
+// RunStatus executes the provided code in the persistent shell and also returns
+// the exit status of the last command in the snippet.  The snippet can be
+// interrupted with InterruptRunning.
+func (r *runnerIO) RunStatus(code string) (string, int, error) {
+	defer trackRunning(r.cmd)()
+	return r.runStatus(code)
+}
+
+// runStatus is RunStatus without tracking the snippet for interrupts.
+func (r *runnerIO) runStatus(code string) (string, int, error) {
 	marker := "__END_OF_SNIPPET__"
-	// Append marker so we know when the output for this snippet is done.
-	command := code + "\necho " + marker + "\n"
+	// Append marker so we know when the output for this snippet is done.  The
+	// marker carries the exit status of the snippet and is preceded by a
+	// newline in case the snippet's output didn't end with one.
+	command := code + "\nprintf '\\n%s %s\\n' " + marker + " \"$?\"\n"
 	if _, err := r.stdin.Write([]byte(command)); err != nil {
-		return "", err
+		return "", 0, err
 	}
 	var output strings.Builder
+	status := -1
 	for r.scanner.Scan() {
 		line := r.scanner.Text()
-		if line == marker {
+		if parts := strings.Fields(line); len(parts) == 2 && parts[0] == marker {
+			status, _ = strconv.Atoi(parts[1])
 			break
 		}
 		output.WriteString(line + "\n")
 	}
 	if err := r.scanner.Err(); err != nil {
-		return output.String(), err
+		return output.String(), status, err
 	}
-	return output.String(), nil
+	if status < 0 {
+		return output.String(), status, fmt.Errorf("shell exited before the snippet completed")
+	}
+	// Drop the newline that was added before the marker.
+	return strings.TrimSuffix(output.String(), "\n"), status, nil
 }
 
 // Close terminates the shell and cleans up resources.
@@ -125,23 +158,193 @@ type VerifyRunner struct {
 // verifyRunner is a singleton instance of VerifyRunner.
 var verifyRunner *VerifyRunner
 
+// runners guards the singleton runners and runnerErrs, which CloseRunners
+// can reset from another goroutine, e.g. when the program is interrupted.
+var runners sync.Mutex
+
+// persistentShell returns the shell shared by the README's snippets, preferring
+// bash over sh.  If no shell exists then it starts a new bash shell.
+func persistentShell() (*runnerIO, error) {
+	runners.Lock()
+	defer runners.Unlock()
+	return sharedShell()
+}
+
+// sharedShell is persistentShell for callers holding runners.
+func sharedShell() (*runnerIO, error) {
+	if bashRunner != nil {
+		return &bashRunner.runnerIO, nil
+	} else if shellRunner != nil {
+		return &shellRunner.runnerIO, nil
+	}
+	b, err := NewBashRunner()
+	if err != nil {
+		return nil, err
+	}
+	bashRunner = b
+	return &b.runnerIO, nil
+}
+
+// runningShells returns the persistent shells that have been started.  The
+// verify runner shares one of these rather than having its own.
+func runningShells() []*runnerIO {
+	runners.Lock()
+	defer runners.Unlock()
+	var shells []*runnerIO
+	if bashRunner != nil {
+		shells = append(shells, &bashRunner.runnerIO)
+	}
+	if shellRunner != nil {
+		shells = append(shells, &shellRunner.runnerIO)
+	}
+	return shells
+}
+
+// CloseRunners stops the persistent shells so that no child processes outlive
+// the run, even if a snippet is still running.  Later calls to GetRunner start
+// new shells, which no longer get the variables set with exportVar.
+func CloseRunners() error {
+	var errs []error
+	shells := runningShells()
+	runners.Lock()
+	bashRunner, shellRunner, verifyRunner = nil, nil, nil
+	runnerErrs = map[string]error{}
+	runners.Unlock()
+	exports.Lock()
+	exported = map[string]string{}
+	exports.Unlock()
+	for _, shell := range shells {
+		shell.stdin.Close()
+		if err := shell.cmd.Process.Kill(); err != nil && !errors.Is(err, os.ErrProcessDone) {
+			errs = append(errs, err)
+		}
+		// The shell was killed, so its exit status isn't interesting.
+		_ = shell.cmd.Wait()
+	}
+	return errors.Join(errs...)
+}
+
+// cleanEnv reports whether new shells start with a minimal environment, as
+// set by SetCleanEnv.
+var cleanEnv bool
+
+// essentialEnv lists the variables of the environment that shells started
+// with a clean environment still inherit.
+var essentialEnv = []string{"PATH", "HOME", "USER", "LOGNAME", "SHELL", "TERM", "LANG", "TMPDIR"}
+
+// exported holds the variables set with exportVar since the shells were last
+// closed, which shells started with a clean environment also get.  It is
+// guarded by exports rather than runners, which is held while shells start.
+var (
+	exports  sync.Mutex
+	exported = map[string]string{}
+)
+
+// SetCleanEnv makes the shells started afterwards, e.g. after CloseRunners,
+// inherit only PATH and a few essentials such as HOME and TERM instead of the
+// whole environment, so that local settings don't change what the snippets
+// do.  Variables from Options.Env are still exported.
+func SetCleanEnv(clean bool) {
+	cleanEnv = clean
+}
+
+// shellEnv returns the environment of a new shell, or nil for the whole
+// environment of the process.
+func shellEnv() []string {
+	if !cleanEnv {
+		return nil
+	}
+	exports.Lock()
+	defer exports.Unlock()
+	env := []string{}
+	for _, name := range essentialEnv {
+		if _, ok := exported[name]; ok {
+			continue
+		}
+		if value, ok := os.LookupEnv(name); ok {
+			env = append(env, name+"="+value)
+		}
+	}
+	for name, value := range exported {
+		env = append(env, name+"="+value)
+	}
+	return env
+}
+
+// exportVar sets an environment variable for the snippets, both for shells
+// that are started later and for the persistent shells already running.
+func exportVar(name, value string) error {
+	if err := os.Setenv(name, value); err != nil {
+		return err
+	}
+	exports.Lock()
+	exported[name] = value
+	exports.Unlock()
+	for _, shell := range runningShells() {
+		if _, err := shell.Run("export " + name + "=" + shellQuote(value)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// shellQuote quotes s as a single word for the shell.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
 // NewVerifyRunner attaches to an existing shell to access variables for potential
 // verification.  If no shell exists then it creates a new one.
 func NewVerifyRunner() (*VerifyRunner, error) {
-	if bashRunner != nil {
-		return &VerifyRunner{runnerIO: bashRunner.runnerIO}, nil
-	} else if shellRunner != nil {
-		return &VerifyRunner{runnerIO: shellRunner.runnerIO}, nil
-	} else {
-		b, _ := NewBashRunner()
-		bashRunner = b
-		return &VerifyRunner{runnerIO: b.runnerIO}, nil
+	shell, err := persistentShell()
+	if err != nil {
+		return nil, err
 	}
+	return &VerifyRunner{runnerIO: *shell}, nil
 }
 
 // Run executes the provided code in the persistent shell, returning "Success" or
 // "Failure" based on the exit code.
 func (r *VerifyRunner) Run(code string) (string, error) {
+	output, _, err := r.RunStatus(code)
+	return output, err
+}
+
+// RunStatus is like Run but also returns the exit code of the snippet.  A
+// failure is followed by what the snippet printed, to help find out why.
+func (r *VerifyRunner) RunStatus(code string) (string, int, error) {
+	out, exitCode, _, err := r.check(code, 0, nil)
+	return out, exitCode, err
+}
+
+// verifySuccess is the result reported for a passing verify block.
+func verifySuccess() string {
+	return colorize(colors.Success, "Success") + "\n"
+}
+
+// verifyFailure is the result reported for a failing verify block.
+func verifyFailure(reason string) string {
+	return colorize(colors.Failure, "Failure ["+reason+"]") + "\n"
+}
+
+// exitFailure is the result reported for a verify block that exited with
+// another status than expected, followed by the output of the block if it
+// printed any.
+func exitFailure(status, expected int, out string) string {
+	reason := fmt.Sprintf("command exited with status %d", status)
+	if expected != 0 {
+		reason += fmt.Sprintf(", expected %d", expected)
+	}
+	failure := verifyFailure(reason)
+	if lines := outputLines(out); len(lines) > 0 {
+		failure += strings.Join(lines, "\n") + "\n"
+	}
+	return failure
+}
+
+// RunOutput runs the snippet like RunStatus but returns what it printed
+// instead of a Success or Failure message.
+func (r *VerifyRunner) RunOutput(code string) (string, int, error) {
 	marker := "__END_OF_SNIPPET__"
 	exitMarker := "__EXIT_CODE__"
 
@@ -153,12 +356,13 @@ func (r *VerifyRunner) Run(code string) (string, error) {
 }
 __run_snippet
 exitCode=$?
-echo %s
+printf '\n%%s\n' %s
 echo %s $exitCode
 `, code, marker, exitMarker)
 
+	defer trackRunning(r.cmd)()
 	if _, err := r.stdin.Write([]byte(wrappedCode)); err != nil {
-		return "", err
+		return "", 0, err
 	}
 
 	var output strings.Builder
@@ -178,54 +382,330 @@ echo %s $exitCode
 	}
 	parts := strings.Fields(exitLine)
 	if len(parts) != 2 || parts[0] != exitMarker {
-		return "", fmt.Errorf("failed to parse exit code, got: %s", exitLine)
+		return "", 0, fmt.Errorf("failed to parse exit code, got: %s", exitLine)
 	}
 	exitCode, err := strconv.Atoi(parts[1])
 	if err != nil {
-		return "", fmt.Errorf("invalid exit code: %s", parts[1])
+		return "", 0, fmt.Errorf("invalid exit code: %s", parts[1])
 	}
-	if exitCode != 0 {
-		return fmt.Sprintf("\033[31mFailure [command exited with status %d]\033[0m\n", exitCode), nil
+	// Drop the newline printed ahead of the marker.
+	return strings.TrimSuffix(output.String(), "\n"), exitCode, nil
+}
+
+// statusRunner is implemented by runners that can report the exit status of
+// the snippet they ran.
+type statusRunner interface {
+	RunStatus(code string) (string, int, error)
+}
+
+// runWithStatus runs code and returns its output and exit status.  Runners that
+// can't report a status are considered successful unless they return an error.
+func runWithStatus(runner CodeRunner, code string) (string, int, error) {
+	if sr, ok := runner.(statusRunner); ok {
+		return sr.RunStatus(code)
 	}
-	return "\033[32mSuccess\033[0m\n", nil
+	out, err := runner.Run(code)
+	if err != nil {
+		return out, 1, err
+	}
+	return out, 0, nil
+}
+
+// languageAliases maps common fence languages onto the language whose runner
+// should handle them.
+var languageAliases = map[string]string{
+	"console":       "bash",
+	"terminal":      "bash",
+	"shell-session": "bash",
+	"bash-session":  "bash",
+	"py3":           "python",
+	"python3":       "python",
+}
+
+// SetLanguageAlias makes fences written in alias use the runner for language,
+// replacing any existing alias.  It returns a function that puts back the
+// alias it replaced, so that callers can scope the alias to a run.
+func SetLanguageAlias(alias, language string) (restore func()) {
+	alias = strings.ToLower(alias)
+	previous, had := languageAliases[alias]
+	languageAliases[alias] = language
+	return func() {
+		if had {
+			languageAliases[alias] = previous
+		} else {
+			delete(languageAliases, alias)
+		}
+	}
+}
+
+// resolveLanguage returns the runner language for a fence language.
+func resolveLanguage(lang string) string {
+	if target, ok := languageAliases[strings.ToLower(lang)]; ok {
+		return target
+	}
+	return lang
+}
+
+// displayLanguages are the fence languages of blocks that are only meant to
+// be read, e.g. diagrams, data and patches.
+var displayLanguages = map[string]bool{
+	"diff":      true,
+	"patch":     true,
+	"mermaid":   true,
+	"json":      true,
+	"yaml":      true,
+	"yml":       true,
+	"toml":      true,
+	"xml":       true,
+	"markdown":  true,
+	"md":        true,
+	"text":      true,
+	"txt":       true,
+	"plaintext": true,
+}
+
+// isDisplayLanguage reports whether blocks of the fence language are shown
+// without offering to run them.
+func isDisplayLanguage(lang string) bool {
+	return displayLanguages[strings.ToLower(lang)]
+}
+
+// isShellLanguage reports whether the fence language runs in a shell.
+func isShellLanguage(lang string) bool {
+	switch resolveLanguage(lang) {
+	case "bash", "sh", "shell", "verify":
+		return true
+	}
+	return false
+}
+
+// strictScript wraps a shell snippet so that it stops at the first failing
+// command, as with "set -eo pipefail", while still running in the persistent
+// shell so that the directory, exports and variables it sets are kept.
+// errexit would end the shell itself, so the snippet runs in a function that
+// an ERR trap returns from at the first failure instead, and the options and
+// ERR trap of the shell are restored afterwards.  An unset variable isn't an
+// error, since the shell would exit on it too.  Shells without an ERR trap,
+// e.g. dash, run the snippet in a subshell with "set -eu" instead.
+func strictScript(code string) string {
+	return "__readme_runner_strict() {\n" + code + "\n}\n" +
+		"if (trap : ERR) 2>/dev/null; then\n" +
+		"__readme_runner_opts=$(set +o)\n" +
+		"__readme_runner_err=$(trap -p ERR)\n" +
+		"set -E -o pipefail\n" +
+		"trap '__readme_runner_status=$?; trap - ERR; return $__readme_runner_status' ERR\n" +
+		"__readme_runner_strict\n" +
+		"__readme_runner_status=$?\n" +
+		"eval \"$__readme_runner_opts\"\n" +
+		"eval \"${__readme_runner_err:-trap - ERR}\"\n" +
+		"else\n" +
+		"( (set -o pipefail) 2>/dev/null && set -o pipefail; set -eu; __readme_runner_strict )\n" +
+		"__readme_runner_status=$?\n" +
+		"fi\n" +
+		"unset -f __readme_runner_strict\n" +
+		"(exit $__readme_runner_status)"
+}
+
+// echoCommands wraps a shell snippet so that each command is printed with a
+// "$ " prefix before it runs, using the shell's xtrace option, so that its
+// output can be told apart from that of the other commands.  Commands are
+// printed as the shell runs them, with variables expanded.  The exit status of
+// the snippet is kept.
+func echoCommands(code string) string {
+	return "__readme_runner_ps4=$PS4; PS4='$ '; set -x\n" + code + "\n" +
+		"{ __readme_runner_status=$?; set +x; PS4=$__readme_runner_ps4; } 2>/dev/null; (exit $__readme_runner_status)"
+}
+
+// scriptDelimiter ends the here-document holding a {script} code block.
+const scriptDelimiter = "__README_RUNNER_SCRIPT__"
+
+// scriptFile wraps a shell snippet so that it is written to an executable
+// temporary file and run from there, so that the interpreter named by its
+// shebang line, e.g. "#!/usr/bin/env python3", runs it rather than the
+// persistent shell.  The script sees exported variables, but variables it
+// sets are not kept.
+func scriptFile(code string) string {
+	return `__readme_runner_script=$(mktemp) && cat > "$__readme_runner_script" <<'` + scriptDelimiter + "'\n" + code + "\n" + scriptDelimiter + "\n" +
+		`chmod +x "$__readme_runner_script" && "$__readme_runner_script"; __readme_runner_status=$?; rm -f "$__readme_runner_script"; (exit $__readme_runner_status)`
+}
+
+// stripPrompts removes the leading prompt markers from a shell snippet copied
+// from a terminal session, e.g. "$ echo hello".  A snippet with a line
+// starting with "$ " is a user session, whose "# " lines are comments and are
+// left alone.  A snippet whose every line starts with "# " or "> " reads the
+// same as commented-out commands, so it is only taken as a root session with
+// "# " prompts when root is set.
+func stripPrompts(code string, root bool) string {
+	lines := strings.Split(code, "\n")
+	user := false
+	for _, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "$ ") {
+			user = true
+		}
+		if trimmed != "" && !strings.HasPrefix(trimmed, "# ") && !strings.HasPrefix(trimmed, "> ") {
+			root = false
+		}
+	}
+	var prefixes []string
+	switch {
+	case user:
+		prefixes = []string{"$ ", "> "}
+	case root:
+		prefixes = []string{"# ", "> "}
+	default:
+		return code
+	}
+	for i, line := range lines {
+		trimmed := strings.TrimLeft(line, " \t")
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(trimmed, prefix) {
+				lines[i] = strings.TrimPrefix(trimmed, prefix)
+				break
+			}
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// sudoRe matches a line of a shell snippet that runs a command with sudo.
+var sudoRe = regexp.MustCompile(`(?m)^\s*sudo(\s|$)`)
+
+// usesSudo reports whether a shell snippet runs a command with sudo.  The
+// persistent shell has no terminal, so sudo can't ask for a password.
+func usesSudo(code string) bool {
+	return sudoRe.MatchString(code)
 }
 
 // GetRunner returns a CodeRunner based on the provided language.
 // For now only "bash" is supported, but this can be extended, e.g. Python, Ruby.
-// Fences without a language will be ignored.
+// Aliases such as "console" resolve to the runner for their language.
+// Fences without a language will be ignored.  When the interpreter of a
+// language can't be started, e.g. because it isn't installed, GetRunner
+// returns nil without trying again until CloseRunners is called, and
+// RunnerError reports why.
 func GetRunner(lang string) CodeRunner {
-	switch lang {
-	case "bash":
+	language := resolveLanguage(lang)
+	command, ok := interpreters[language]
+	if !ok {
+		return nil
+	}
+	runners.Lock()
+	defer runners.Unlock()
+	if runnerErrs[language] != nil {
+		return nil
+	}
+	switch {
+	case language == "verify":
+		if verifyRunner == nil {
+			shell, err := sharedShell()
+			if err != nil {
+				return runnerFailed(language, err)
+			}
+			verifyRunner = &VerifyRunner{runnerIO: *shell}
+		}
+		return verifyRunner
+	case command == "bash":
 		if bashRunner == nil {
 			runner, err := NewBashRunner()
 			if err != nil {
-				log.Printf("Error starting bash runner: %v\n", err)
-				return nil
+				return runnerFailed(language, err)
 			}
 			bashRunner = runner
 		}
 		return bashRunner
-	case "sh", "shell":
+	default:
 		if shellRunner == nil {
 			runner, err := NewShellRunner()
 			if err != nil {
-				log.Printf("Error starting shell runner: %v\n", err)
-				return nil
+				return runnerFailed(language, err)
 			}
 			shellRunner = runner
 		}
 		return shellRunner
-	case "verify":
-		if verifyRunner == nil {
-			runner, err := NewVerifyRunner()
-			if err != nil {
-				log.Printf("Error starting verify runner: %v\n", err)
-				return nil
-			}
-			verifyRunner = runner
+	}
+}
+
+// interpreters maps the languages GetRunner has a runner for onto the
+// interpreter the runner starts.  Verify blocks run in the persistent bash
+// shell.
+var interpreters = map[string]string{
+	"bash":   "bash",
+	"sh":     "sh",
+	"shell":  "sh",
+	"verify": "bash",
+}
+
+// runnerCommand returns the interpreter GetRunner starts for the fence
+// language, or "" if the language has no runner.
+func runnerCommand(lang string) string {
+	return interpreters[resolveLanguage(lang)]
+}
+
+// runnerErrs holds why the interpreter of a language couldn't be started,
+// keyed by resolved language.
+var runnerErrs = map[string]error{}
+
+// runnerFailed records that the interpreter of a language couldn't be
+// started and returns the nil runner.  The caller holds runners.
+func runnerFailed(language string, err error) CodeRunner {
+	runnerErrs[language] = err
+	return nil
+}
+
+// reportMissingRunner tells the user, once per language, that the blocks of a
+// language are skipped because its interpreter couldn't be started.
+func (s *session) reportMissingRunner(language string) {
+	language = resolveLanguage(language)
+	if s.missing[language] {
+		return
+	}
+	if s.missing == nil {
+		s.missing = map[string]bool{}
+	}
+	s.missing[language] = true
+	fmt.Fprintln(s.w, "\n"+fill(s.messages().MissingRunner, "language", language, "error", RunnerError(language).Error()))
+}
+
+// RunnerError returns why GetRunner couldn't start the interpreter of a
+// language, or nil if it hasn't failed to.
+func RunnerError(lang string) error {
+	runners.Lock()
+	defer runners.Unlock()
+	return runnerErrs[resolveLanguage(lang)]
+}
+
+// runner returns the runner for a code block language, preferring the ones
+// supplied in Options.Runners.
+func (s *session) runner(lang string) CodeRunner {
+	if runner, ok := s.suppliedRunner(lang); ok {
+		return runner
+	}
+	return GetRunner(lang)
+}
+
+// suppliedRunner returns the runner Options.Runners supplies for a code block
+// language, if any.
+func (s *session) suppliedRunner(lang string) (CodeRunner, bool) {
+	if runner, ok := s.opts.Runners[lang]; ok {
+		return runner, true
+	}
+	runner, ok := s.opts.Runners[resolveLanguage(lang)]
+	return runner, ok
+}
+
+// shellRun runs a command of the run itself, e.g. one loading the options of
+// a prompt, where the shell code blocks run: in the runner supplied for bash
+// or sh, or else in the persistent shell.
+func (s *session) shellRun(code string) (string, int, error) {
+	for _, lang := range []string{"bash", "sh"} {
+		if runner, ok := s.suppliedRunner(lang); ok {
+			return runWithStatus(runner, code)
 		}
-		return verifyRunner
-	default:
-		return nil
 	}
+	shell, err := persistentShell()
+	if err != nil {
+		return "", 0, err
+	}
+	return shell.RunStatus(code)
 }
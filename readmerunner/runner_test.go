@@ -2,8 +2,14 @@ package readmerunner
 
 import (
 	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
 	"strings"
 	"testing"
+	"time"
 )
 
 // fakePrompt returns predetermined responses from a slice.
@@ -41,6 +47,109 @@ func TestGetRunner(t *testing.T) {
 	}
 }
 
+func TestRunMarkdownMissingInterpreter(t *testing.T) {
+	// Without a PATH to find them in, the shells can't be started.
+	CloseRunners()
+	defer CloseRunners()
+	t.Setenv("PATH", t.TempDir())
+
+	mdContent := []byte("# One\n```bash\necho one\n```\n# Two\n```console\n$ echo two\n```\n```bash\necho three\n```\n")
+	var buf bytes.Buffer
+	result, err := RunMarkdownWithOptions(mdContent, Options{Auto: true}, &buf, fakePrompt(nil))
+	if err != nil {
+		t.Fatalf("RunMarkdownWithOptions returned error: %v", err)
+	}
+	if result.BlocksRun != 0 || result.BlocksSkipped != 3 {
+		t.Errorf("Expected all 3 blocks skipped, got %d run and %d skipped", result.BlocksRun, result.BlocksSkipped)
+	}
+	output := buf.String()
+	if count := strings.Count(output, "> Skipping bash code blocks, the interpreter couldn't be started: "); count != 1 {
+		t.Errorf("Expected a single message about the missing interpreter, got %d in %q", count, output)
+	}
+	if RunnerError("bash") == nil {
+		t.Error("Expected RunnerError to report why bash couldn't be started")
+	}
+}
+
+func TestRunMarkdownStrictLanguages(t *testing.T) {
+	tc := []struct {
+		name     string
+		markdown string
+		strict   bool
+		wantErr  bool
+	}{
+		{"Typo", "# Setup\n```bsah\necho hi\n```\n", true, true},
+		{"Typo Not Strict", "# Setup\n```bsah\necho hi\n```\n", false, false},
+		{"Display Only", "# Setup\n```json\n{}\n```\n```\nplain output\n```\n", true, false},
+		{"Alias", "# Setup\n```console\n$ echo hi\n```\n", true, false},
+	}
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			_, err := RunMarkdownWithOptions([]byte(tt.markdown), Options{Auto: true, StrictLanguages: tt.strict}, &buf, fakePrompt(nil))
+			if tt.wantErr {
+				if !errors.Is(err, ErrUnknownLanguage) {
+					t.Fatalf("Expected ErrUnknownLanguage, got %v", err)
+				}
+				if !strings.Contains(err.Error(), `"bsah" in section "Setup"`) {
+					t.Errorf("Expected the error to name the language and section, got %v", err)
+				}
+			} else if err != nil {
+				t.Fatalf("RunMarkdownWithOptions returned error: %v", err)
+			}
+		})
+	}
+}
+
+func TestGetRunnerAliases(t *testing.T) {
+	tc := []struct {
+		alias    string
+		language string
+	}{
+		{"console", "bash"},
+		{"terminal", "bash"},
+		{"shell-session", "bash"},
+		{"bash-session", "bash"},
+		{"Console", "bash"},
+		{"py3", "python"},
+	}
+	for _, tt := range tc {
+		t.Run(tt.alias, func(t *testing.T) {
+			if got := resolveLanguage(tt.alias); got != tt.language {
+				t.Errorf("resolveLanguage(%q) = %q, want %q", tt.alias, got, tt.language)
+			}
+			if runner := GetRunner(tt.language); runner != nil && GetRunner(tt.alias) != runner {
+				t.Errorf("GetRunner(%q) did not return the %s runner", tt.alias, tt.language)
+			}
+		})
+	}
+}
+
+func TestSetLanguageAlias(t *testing.T) {
+	tc := []struct {
+		name     string
+		alias    string
+		language string
+		restored string
+	}{
+		{"new alias", "zsh", "sh", "zsh"},
+		{"replaced alias", "Console", "sh", "bash"},
+	}
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			restore := SetLanguageAlias(tt.alias, tt.language)
+			if got := resolveLanguage(tt.alias); got != tt.language {
+				restore()
+				t.Fatalf("resolveLanguage(%q) = %q, want %q", tt.alias, got, tt.language)
+			}
+			restore()
+			if got := resolveLanguage(tt.alias); got != tt.restored {
+				t.Errorf("resolveLanguage(%q) after restore = %q, want %q", tt.alias, got, tt.restored)
+			}
+		})
+	}
+}
+
 func TestBashRunnerRun(t *testing.T) {
 	br, _ := NewBashRunner()
 	output, err := br.Run("echo hello")
@@ -53,6 +162,266 @@ func TestBashRunnerRun(t *testing.T) {
 	}
 }
 
+func TestBashRunnerNoTrailingNewline(t *testing.T) {
+	br, _ := NewBashRunner()
+	output, err := br.Run(`printf "no newline"`)
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if output != "no newline" {
+		t.Errorf("Expected %q, got %q", "no newline", output)
+	}
+	// The shell should still be in sync for the next snippet.
+	output, err = br.Run("echo next")
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if output != "next\n" {
+		t.Errorf("Expected %q, got %q", "next\n", output)
+	}
+}
+
+func TestRunMarkdownOutputNewline(t *testing.T) {
+	defer CloseRunners()
+	tc := []struct {
+		name     string
+		md       string
+		expected string
+	}{
+		{"single block", "# A\n```bash\nprintf done\n```\n", "> Output: done\n> (took "},
+		{"grouped block", "# A\n```bash {group}\nprintf done\n```\n", "done\n> (took "},
+	}
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if _, err := RunMarkdownWithOptions([]byte(tt.md), Options{Auto: true, Timings: true}, &buf, fakePrompt(nil)); err != nil {
+				t.Fatalf("RunMarkdownWithOptions returned error: %v", err)
+			}
+			if !strings.Contains(buf.String(), tt.expected) {
+				t.Errorf("Expected output to contain %q, got %q", tt.expected, buf.String())
+			}
+		})
+	}
+}
+
+func TestBashRunnerRunStatus(t *testing.T) {
+	br, _ := NewBashRunner()
+	output, status, err := br.RunStatus("echo hello\nfalse")
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if output != "hello\n" {
+		t.Errorf("Expected %q, got %q", "hello\n", output)
+	}
+	if status != 1 {
+		t.Errorf("Expected status 1, got %d", status)
+	}
+}
+
+func TestStripPrompts(t *testing.T) {
+	tc := []struct {
+		name     string
+		code     string
+		root     bool
+		expected string
+	}{
+		{"plain", "echo hello", false, "echo hello"},
+		{"comments only", "# install\necho hello", false, "# install\necho hello"},
+		{"user prompt", "$ echo hello", false, "echo hello"},
+		{"session", "$ cd /tmp\n> echo done", false, "cd /tmp\necho done"},
+		{"comment in session", "# install\n$ echo hello", false, "# install\necho hello"},
+		{"commented-out commands", "# cd /tmp\n# whoami", false, "# cd /tmp\n# whoami"},
+		{"root session", "# cd /tmp\n# whoami \\\n> --help", true, "cd /tmp\nwhoami \\\n--help"},
+		{"root with comments", "# install\necho hello", true, "# install\necho hello"},
+		{"indented", "  $ echo hello", false, "echo hello"},
+		{"quoted markers", "$ echo '$ hello'", false, "echo '$ hello'"},
+	}
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := stripPrompts(tt.code, tt.root); got != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestRunMarkdownCommentOnlyBlock(t *testing.T) {
+	defer CloseRunners()
+	mdContent := []byte("# Notes\n```bash\n# echo ran\n```\n")
+	tc := []struct {
+		name string
+		opts Options
+		ran  bool
+	}{
+		{"comments", Options{Auto: true}, false},
+		{"root prompts", Options{Auto: true, RootPrompts: true}, true},
+	}
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if _, err := RunMarkdownWithOptions(mdContent, tt.opts, &buf, fakePrompt(nil)); err != nil {
+				t.Fatalf("RunMarkdownWithOptions returned error: %v", err)
+			}
+			if strings.Contains(buf.String(), "> Output: ran") != tt.ran {
+				t.Errorf("Expected the command to run: %v, got %q", tt.ran, buf.String())
+			}
+		})
+	}
+}
+
+func TestUsesSudo(t *testing.T) {
+	tc := []struct {
+		name     string
+		code     string
+		expected bool
+	}{
+		{"sudo", "sudo apt update", true},
+		{"later line", "cd /tmp\n  sudo make install", true},
+		{"bare", "sudo", true},
+		{"no sudo", "apt list --installed", false},
+		{"mentioned", "echo 'run sudo first'", false},
+		{"prefix", "sudoedit /etc/hosts", false},
+	}
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := usesSudo(tt.code); got != tt.expected {
+				t.Errorf("Expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestProcessCodeBlockSudo(t *testing.T) {
+	var buf bytes.Buffer
+	s := &session{w: &buf, promptFunc: fakePrompt([]string{"s"})}
+	if err := s.processCodeBlock([]string{"```bash", "sudo apt update", "```"}, ""); err != nil {
+		t.Fatalf("processCodeBlock returned error: %v", err)
+	}
+	if !strings.Contains(buf.String(), "CAUTION: This code block uses sudo") {
+		t.Errorf("Expected a sudo warning, got %q", buf.String())
+	}
+}
+
+func TestExportVarLiveShell(t *testing.T) {
+	// Start the shell before the variable is exported.
+	runner := GetRunner("bash")
+	if err := exportVar("RR_EXPORT_TEST", "it's here"); err != nil {
+		t.Fatalf("exportVar returned error: %v", err)
+	}
+	output, err := runner.Run("echo \"$RR_EXPORT_TEST\"")
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if output != "it's here\n" {
+		t.Errorf("Expected %q, got %q", "it's here\n", output)
+	}
+}
+
+func TestRunMarkdownCleanEnv(t *testing.T) {
+	t.Setenv("RR_PARENT_VAR", "from the parent")
+	mdContent := []byte("# Env\n```bash\necho \"parent=${RR_PARENT_VAR-unset} kept=${RR_CLEAN_KEPT-unset} path=${PATH:+set}\"\n```\n")
+	tc := []struct {
+		name     string
+		clean    bool
+		expected string
+	}{
+		{"Clean", true, "parent=unset kept=yes path=set"},
+		{"Inherited", false, "parent=from the parent kept=yes path=set"},
+	}
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			CloseRunners()
+			defer CloseRunners()
+			SetCleanEnv(tt.clean)
+			defer SetCleanEnv(false)
+
+			var buf bytes.Buffer
+			opts := Options{Auto: true, Env: map[string]string{"RR_CLEAN_KEPT": "yes"}}
+			if _, err := RunMarkdownWithOptions(mdContent, opts, &buf, fakePrompt(nil)); err != nil {
+				t.Fatalf("RunMarkdownWithOptions returned error: %v", err)
+			}
+			if !strings.Contains(buf.String(), "> Output: "+tt.expected+"\n") {
+				t.Errorf("Expected output %q, got %q", tt.expected, buf.String())
+			}
+		})
+	}
+}
+
+func TestRunMarkdownCleanEnvExports(t *testing.T) {
+	CloseRunners()
+	defer CloseRunners()
+	SetCleanEnv(true)
+	defer SetCleanEnv(false)
+
+	mdContent := []byte("# Env\n```bash\necho \"leaked=${RR_LEAKED-unset} kept=${RR_CLEAN_KEPT-unset}\"\n```\n")
+	tc := []struct {
+		name     string
+		opts     Options
+		expected []string
+	}{
+		{"earlier exports", Options{Auto: true}, []string{"leaked=unset kept=unset"}},
+		{"fresh shells", Options{Auto: true, Repeat: 2, FreshShells: true, Env: map[string]string{"RR_CLEAN_KEPT": "yes"}}, []string{"leaked=unset kept=yes", "leaked=unset kept=yes"}},
+	}
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			// Restore the process environment exportVar changes.
+			t.Setenv("RR_LEAKED", "")
+			if err := exportVar("RR_LEAKED", "yes"); err != nil {
+				t.Fatalf("exportVar returned error: %v", err)
+			}
+			if err := CloseRunners(); err != nil {
+				t.Fatalf("CloseRunners returned error: %v", err)
+			}
+			var buf bytes.Buffer
+			if _, err := RunMarkdownWithOptions(mdContent, tt.opts, &buf, fakePrompt(nil)); err != nil {
+				t.Fatalf("RunMarkdownWithOptions returned error: %v", err)
+			}
+			for _, want := range tt.expected {
+				if strings.Count(buf.String(), "> Output: "+want+"\n") != len(tt.expected) {
+					t.Errorf("Expected %d outputs %q, got %q", len(tt.expected), want, buf.String())
+				}
+			}
+			CloseRunners()
+		})
+	}
+}
+
+func TestCloseRunners(t *testing.T) {
+	runner := GetRunner("bash").(*BashRunner)
+	if err := CloseRunners(); err != nil {
+		t.Fatalf("CloseRunners returned error: %v", err)
+	}
+	if runner.cmd.ProcessState == nil {
+		t.Errorf("Expected the bash shell to have exited")
+	}
+	if bashRunner != nil || shellRunner != nil || verifyRunner != nil {
+		t.Errorf("Expected runners to be reset")
+	}
+	// A new shell is started on demand.
+	output, err := GetRunner("bash").Run("echo again")
+	if err != nil || output != "again\n" {
+		t.Errorf("Expected a new shell to run, got %q, %v", output, err)
+	}
+}
+
+func TestCloseRunnersConcurrent(t *testing.T) {
+	defer CloseRunners()
+	// CloseRunners is called when the program is interrupted, while the run
+	// may still be getting runners.  Run with -race to check.
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 20; i++ {
+			GetRunner("bash")
+			RunnerError("bash")
+		}
+	}()
+	for i := 0; i < 20; i++ {
+		CloseRunners()
+	}
+	<-done
+}
+
 func TestVerifyRunner(t *testing.T) {
 	tc := []struct {
 		name       string
@@ -61,9 +430,11 @@ func TestVerifyRunner(t *testing.T) {
 	}{
 		{"Explicit Success", "exit 0", "\x1b[32mSuccess\x1b[0m\n"},
 		{"Inferred Success", "echo hello", "\x1b[32mSuccess\x1b[0m\n"},
+		{"Success Output", "echo hello; true", "\x1b[32mSuccess\x1b[0m\n"},
 		{"Exit Error Code", "exit 1", "\x1b[31mFailure [command exited with status 1]\x1b[0m\n"},
 		{"Return Error Code", "return 1", "\x1b[31mFailure [command exited with status 1]\x1b[0m\n"},
-		{"Could Not Run", "unknown-command", "\x1b[31mFailure [command exited with status 127]\x1b[0m\n"},
+		{"Could Not Run", "unknown-command 2>/dev/null", "\x1b[31mFailure [command exited with status 127]\x1b[0m\n"},
+		{"Failure Output", "echo 'disk is full' >&2; exit 2", "\x1b[31mFailure [command exited with status 2]\x1b[0m\ndisk is full\n"},
 	}
 	for _, tt := range tc {
 		t.Run(tt.name, func(t *testing.T) {
@@ -107,6 +478,85 @@ More text.
 	}
 }
 
+func TestPrintTOCDepth(t *testing.T) {
+	mdContent := []byte(`# Title
+## Section One
+### Subsection
+#### Deep Section
+## Section Two
+`)
+	var buf bytes.Buffer
+	err := PrintTOCWithOptions(&buf, mdContent, TOCOptions{Depth: 2})
+	if err != nil {
+		t.Fatalf("PrintTOCWithOptions returned error: %v", err)
+	}
+	want := "- Title (title)\n  - Section One (section-one)\n  - Section Two (section-two)\n"
+	if got := buf.String(); got != want {
+		t.Errorf("PrintTOCWithOptions output mismatch.\nGot:\n%s\nWant:\n%s", got, want)
+	}
+}
+
+func TestPrintTOCNumbered(t *testing.T) {
+	mdContent := []byte(`# Title
+## Section One
+## Section Two
+`)
+	var buf bytes.Buffer
+	err := PrintTOCWithOptions(&buf, mdContent, TOCOptions{Numbered: true})
+	if err != nil {
+		t.Fatalf("PrintTOCWithOptions returned error: %v", err)
+	}
+	want := "1. Title (title)\n  2. Section One (section-one)\n  3. Section Two (section-two)\n"
+	if got := buf.String(); got != want {
+		t.Errorf("PrintTOCWithOptions output mismatch.\nGot:\n%s\nWant:\n%s", got, want)
+	}
+}
+
+func TestPrintCodeBlocks(t *testing.T) {
+	mdContent := []byte("```sh\necho preamble\n```\n# Install\n```bash\nmake install\n```\n```go\nfmt.Println()\n```\n## Check\n```verify\ntest -f out\n```\n")
+	tc := []struct {
+		name     string
+		language string
+		want     string
+	}{
+		{
+			"all", "",
+			"1. sh (line 1)\n```sh\necho preamble\n```\n\n" +
+				"2. bash (#install, line 5)\n```bash\nmake install\n```\n\n" +
+				"3. verify (#check, line 12)\n```verify\ntest -f out\n```\n\n",
+		},
+		{"language", "verify", "1. verify (#check, line 12)\n```verify\ntest -f out\n```\n\n"},
+	}
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := PrintCodeBlocks(&buf, mdContent, tt.language); err != nil {
+				t.Fatalf("PrintCodeBlocks returned error: %v", err)
+			}
+			if got := buf.String(); got != tt.want {
+				t.Errorf("PrintCodeBlocks output mismatch.\nGot:\n%s\nWant:\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPrintTOCMarkdown(t *testing.T) {
+	mdContent := []byte(`# Title
+## Section One
+### Sub-section: Details
+## Section Two
+`)
+	var buf bytes.Buffer
+	err := PrintTOCWithOptions(&buf, mdContent, TOCOptions{Format: TOCMarkdown})
+	if err != nil {
+		t.Fatalf("PrintTOCWithOptions returned error: %v", err)
+	}
+	want := "- [Title](#title)\n  - [Section One](#section-one)\n    - [Sub-section: Details](#sub-section-details)\n  - [Section Two](#section-two)\n"
+	if got := buf.String(); got != want {
+		t.Errorf("PrintTOCWithOptions output mismatch.\nGot:\n%s\nWant:\n%s", got, want)
+	}
+}
+
 func TestRunMarkdownCodeBlock(t *testing.T) {
 	// Markdown with a code block that should run.
 	mdContent := []byte("# Code Run Test\n```bash\necho hello world\n```")
@@ -140,60 +590,147 @@ func TestRunMarkdownCodeBlock(t *testing.T) {
 	}
 }
 
-func TestProcessCodeBlock(t *testing.T) {
+// fakeRunner records the code it is given instead of running it.
+type fakeRunner struct {
+	ran []string
+	// reply, when set, gives the output of a snippet instead of "faked".
+	reply func(code string) string
+}
+
+func (f *fakeRunner) Run(code string) (string, error) {
+	f.ran = append(f.ran, code)
+	if f.reply != nil {
+		return f.reply(code), nil
+	}
+	return "faked\n", nil
+}
+
+func (f *fakeRunner) Close() error { return nil }
+
+func TestProcessCodeBlockRunners(t *testing.T) {
 	tc := []struct {
-		name            string
-		mdContent       []string
-		promptResponses []string
-		expectedOutput  string
+		name     string
+		code     []string
+		expected []string
 	}{
-		{"Run Code Block", []string{"```bash", "echo hello", "```"}, []string{"r"}, "Output: hello"},
-		{"Unknown Language", []string{"```unknown", "echo hello", "```"}, []string{"r"}, ""},
-		{"Missing Language", []string{"```", "echo hello", "```"}, []string{"r"}, ""},
-		{"Skip Code Block", []string{"```bash", "echo hello", "```"}, []string{"s"}, ""},
-		{"Exit Code Block", []string{"```bash", "echo hello", "```"}, []string{"x"}, ""},
-		{"Rerun Code Block", []string{"```bash", "echo hello", "```"}, []string{"r", "r"}, "\n> Output: hello\n\n> Output: hello\n"},
+		{"Language", []string{"```bash", "echo hello", "```"}, []string{"echo hello"}},
+		{"Alias", []string{"```console", "$ echo hello", "```"}, []string{"echo hello"}},
+		{"Other Language", []string{"```sh", "echo hello", "```"}, nil},
+	}
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			fake := &fakeRunner{}
+			s := &session{w: &buf, promptFunc: fakePrompt([]string{"r"}), opts: Options{Runners: map[string]CodeRunner{"bash": fake}}}
+			if err := s.processCodeBlock(tt.code, ""); err != nil {
+				t.Fatalf("processCodeBlock returned error: %v", err)
+			}
+			if !reflect.DeepEqual(fake.ran, tt.expected) {
+				t.Errorf("Expected fake runner to run %q, got %q", tt.expected, fake.ran)
+			}
+			if tt.expected != nil && !strings.Contains(buf.String(), "> Output: faked") {
+				t.Errorf("Expected fake output, got %q", buf.String())
+			}
+		})
 	}
+}
 
+func TestRunMarkdownSuppliedRunnerCommands(t *testing.T) {
+	dir := t.TempDir()
+	tc := []struct {
+		name     string
+		md       string
+		opts     Options
+		prompts  []string
+		expected string
+	}{
+		{
+			name:     "requires",
+			md:       "# A\n[requires]:# (command -v tool)\n```bash\necho hi\n```\n",
+			opts:     Options{Auto: true},
+			expected: "{ command -v tool\n} >/dev/null 2>&1",
+		},
+		{
+			name:     "prompt options",
+			md:       "[prompt]:# (PICK \"Pick?\" $(list-things))\n",
+			opts:     Options{Auto: true, Answers: map[string]string{"PICK": "faked"}},
+			expected: "{ list-things\n} 2>/dev/null",
+		},
+		{
+			name:     "prompt file",
+			md:       "[prompt]:# (NAME \"Name?\" >name.txt world)\n",
+			opts:     Options{Auto: true},
+			expected: "pwd",
+		},
+		{
+			name:     "typed command",
+			md:       "# A\n```bash\necho hi\n```\n",
+			prompts:  []string{"r", "!whoami", ""},
+			expected: "whoami",
+		},
+		{
+			name:     "parallel",
+			md:       "# A\n```bash {parallel}\necho one\n```\n```bash {parallel}\necho two\n```\n",
+			opts:     Options{Auto: true},
+			expected: "echo two",
+		},
+	}
 	for _, tt := range tc {
 		t.Run(tt.name, func(t *testing.T) {
+			fake := &fakeRunner{reply: func(code string) string {
+				if code == "pwd" {
+					return dir + "\n"
+				}
+				return "faked\n"
+			}}
+			opts := tt.opts
+			opts.Runners = map[string]CodeRunner{"bash": fake, "verify": fake}
 			var buf bytes.Buffer
-			prompt := fakePrompt(tt.promptResponses)
-			err, _ := processCodeBlock(&buf, prompt, tt.mdContent, "")
-			if err != nil {
-				t.Errorf("processCodeBlock returned error: %v", err)
+			if _, err := RunMarkdownWithOptions([]byte(tt.md), opts, &buf, fakePrompt(tt.prompts)); err != nil {
+				t.Fatalf("RunMarkdownWithOptions returned error: %v", err)
 			}
-			output := buf.String()
-			if !strings.Contains(output, tt.expectedOutput) {
-				t.Errorf("Expected output to contain %q, but got %q", tt.expectedOutput, output)
+			found := false
+			for _, code := range fake.ran {
+				found = found || code == tt.expected
+			}
+			if !found {
+				t.Errorf("Expected the supplied runner to run %q, got %q", tt.expected, fake.ran)
 			}
 		})
 	}
+	if _, err := os.Stat(filepath.Join(dir, "name.txt")); err != nil {
+		t.Errorf("Expected the answer to be written in the supplied runner's directory: %v", err)
+	}
 }
 
-func TestRunMarkdownMultiplePrompts(t *testing.T) {
-	mdContent := []byte(`# Heading One
-Paragraph one.
-## Heading Two
-Paragraph two.
-`)
+func TestProcessCodeBlock(t *testing.T) {
 	tc := []struct {
 		name            string
+		mdContent       []string
 		promptResponses []string
 		expectedOutput  string
+		expectedErr     error
 	}{
-		{"Exit After One", []string{"exit"}, "# Heading One\nParagraph one."},
-		{"Exit After Two", []string{"", "exit"}, "# Heading One\nParagraph one.\n\n## Heading Two\nParagraph two."},
-		{"Continue to End", []string{"", "", ""}, "# Heading One\nParagraph one.\n\n## Heading Two\nParagraph two.\n\n> README complete!\n"},
+		{"Run Code Block", []string{"```bash", "echo hello", "```"}, []string{"r"}, "Output: hello", nil},
+		{"Unknown Language", []string{"```unknown", "echo hello", "```"}, []string{"r"}, "", nil},
+		{"Missing Language", []string{"```", "echo hello", "```"}, []string{"r"}, "", nil},
+		{"Skip Code Block", []string{"```bash", "echo hello", "```"}, []string{"s"}, "", nil},
+		{"Exit Code Block", []string{"```bash", "echo hello", "```"}, []string{"x"}, "", ErrExit},
+		{"Rerun Code Block", []string{"```bash", "echo hello", "```"}, []string{"r", "r"}, "\n> Output: hello\n\n> Output: hello\n", nil},
+		{"Exit After Rerun", []string{"```bash", "echo hello", "```"}, []string{"r", "r", "x"}, "\n> Output: hello\n\n> Output: hello\n", ErrExit},
+		{"Prompt Prefixed Code Block", []string{"```console", "$ echo hello", "```"}, []string{"r"}, "Output: hello", nil},
+		{"Copy Without Clipboard", []string{"```bash", "echo hello", "```"}, []string{"c", "s"}, "> Error copying code: no clipboard available", nil},
+		{"Edit Code Block Inline", []string{"```bash", "echo hello", "echo world", "```"}, []string{"e", "echo edited", "-"}, "Output: edited\n", nil},
 	}
 
 	for _, tt := range tc {
 		t.Run(tt.name, func(t *testing.T) {
 			var buf bytes.Buffer
 			prompt := fakePrompt(tt.promptResponses)
-			err := RunMarkdown(mdContent, "", nil, &buf, prompt)
-			if err != nil {
-				t.Errorf("RunMarkdown returned error: %v", err)
+			s := &session{w: &buf, promptFunc: prompt}
+			err := s.processCodeBlock(tt.mdContent, "")
+			if !errors.Is(err, tt.expectedErr) {
+				t.Errorf("Expected error %v, got %v", tt.expectedErr, err)
 			}
 			output := buf.String()
 			if !strings.Contains(output, tt.expectedOutput) {
@@ -203,15 +740,478 @@ Paragraph two.
 	}
 }
 
-func TestRunMarkdownWithStartAnchor(t *testing.T) {
-	mdContent := []byte(`# Title
-Paragraph one.
-## Section One
-Paragraph two.
-## Subsection
-Paragraph three.
-## Subsection
-Oh no, a match!
+func TestRunMarkdownInterrupt(t *testing.T) {
+	mdContent := []byte("# Slow\n```bash\necho started; sleep 10\n```\n```bash\necho next\n```\n")
+
+	// Interrupt until the run ends, in case the first interrupt arrives before
+	// sleep has started.
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case <-time.After(200 * time.Millisecond):
+				InterruptRunning()
+			}
+		}
+	}()
+	var buf bytes.Buffer
+	started := time.Now()
+	result, err := RunMarkdownWithOptions(mdContent, Options{Auto: true}, &buf, fakePrompt(nil))
+	close(done)
+	if err != nil {
+		t.Fatalf("RunMarkdownWithOptions returned error: %v", err)
+	}
+	if took := time.Since(started); took > 5*time.Second {
+		t.Errorf("Expected the command to be interrupted, took %v", took)
+	}
+	output := buf.String()
+	if !strings.Contains(output, "> Output: started\n> Interrupted\n") {
+		t.Errorf("Expected the interruption to be reported, got %q", output)
+	}
+	if !strings.Contains(output, "> Output: next\n") {
+		t.Errorf("Expected the run to carry on after the interruption, got %q", output)
+	}
+	if len(result.Failures) != 1 || result.Failures[0].ExitStatus != 130 {
+		t.Errorf("Expected the interrupted block to fail with status 130, got %+v", result.Failures)
+	}
+	if InterruptRunning() {
+		t.Error("Expected nothing to interrupt between snippets")
+	}
+}
+
+func TestRunMarkdownPreambles(t *testing.T) {
+	mdContent := []byte("# Preamble\n```bash\ngreet world\n```\n```sh\necho plain\n```\n")
+
+	var buf bytes.Buffer
+	opts := Options{Auto: true, Preambles: map[string]string{"bash": "greet() { echo \"hello $1\"; }"}}
+	if _, err := RunMarkdownWithOptions(mdContent, opts, &buf, fakePrompt(nil)); err != nil {
+		t.Fatalf("RunMarkdownWithOptions returned error: %v", err)
+	}
+	output := buf.String()
+	if !strings.Contains(output, "> Output: hello world\n") {
+		t.Errorf("Expected the preamble's function to be defined, got %q", output)
+	}
+	if strings.Contains(output, "greet()") {
+		t.Errorf("Expected the preamble not to be shown, got %q", output)
+	}
+	if !strings.Contains(output, "> Output: plain\n") {
+		t.Errorf("Expected blocks of other languages to run without the preamble, got %q", output)
+	}
+}
+
+func TestRunMarkdownScript(t *testing.T) {
+	tc := []struct {
+		name     string
+		code     string
+		expected string
+		failures int
+	}{
+		{"Shebang Interpreter", "#!/bin/cat\nhello from cat", "#!/bin/cat\nhello from cat\n", 0},
+		{"Exported Variables", "#!/bin/sh\necho \"$GREETING from sh\"", "hello from sh\n", 0},
+		{"Exit Status", "#!/bin/sh\necho failing\nexit 3", "failing\n", 1},
+	}
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			mdContent := []byte("```bash\nexport GREETING=hello\n```\n```bash {script}\n" + tt.code + "\n```\n")
+			var buf bytes.Buffer
+			result, err := RunMarkdownWithOptions(mdContent, Options{Auto: true}, &buf, fakePrompt(nil))
+			if err != nil {
+				t.Fatalf("RunMarkdownWithOptions returned error: %v", err)
+			}
+			if !strings.Contains(buf.String(), "> Output: "+tt.expected) {
+				t.Errorf("Expected output %q, got %q", tt.expected, buf.String())
+			}
+			if len(result.Failures) != tt.failures {
+				t.Errorf("Expected %d failures, got %+v", tt.failures, result.Failures)
+			}
+		})
+	}
+}
+
+func TestRunMarkdownEchoCommands(t *testing.T) {
+	tc := []struct {
+		name     string
+		code     string
+		expected string
+		failures int
+	}{
+		{"Bash", "```bash\necho one\necho two\n```", "> Output: $ echo one\none\n$ echo two\ntwo\n", 0},
+		{"Sh", "```sh\necho one\n```", "> Output: $ echo one\none\n", 0},
+		{"Exit Status", "```bash\necho failing\nfalse\n```", "> Output: $ echo failing\nfailing\n$ false\n", 1},
+	}
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			result, err := RunMarkdownWithOptions([]byte(tt.code+"\n"), Options{Auto: true, EchoCommands: true}, &buf, fakePrompt(nil))
+			if err != nil {
+				t.Fatalf("RunMarkdownWithOptions returned error: %v", err)
+			}
+			if !strings.Contains(buf.String(), tt.expected) {
+				t.Errorf("Expected %q, got %q", tt.expected, buf.String())
+			}
+			if len(result.Failures) != tt.failures {
+				t.Errorf("Expected %d failures, got %+v", tt.failures, result.Failures)
+			}
+		})
+	}
+}
+
+func TestRunMarkdownStrict(t *testing.T) {
+	defer CloseRunners()
+	mdContent := []byte("# Strict\n```bash {strict}\nSTRICT_VAR=kept\necho one\ntrue | false\necho two\n```\n```bash\nfalse\necho still running $STRICT_VAR\nset -o | grep -E 'errexit|pipefail'\n```\n")
+
+	var buf bytes.Buffer
+	result, err := RunMarkdownWithOptions(mdContent, Options{Auto: true}, &buf, fakePrompt(nil))
+	if err != nil {
+		t.Fatalf("RunMarkdownWithOptions returned error: %v", err)
+	}
+	output := buf.String()
+	if !strings.Contains(output, "> Output: one\n```bash\n") {
+		t.Errorf("Expected strict block to stop at the failure, got %q", output)
+	}
+	if result.Timings[0].Command != "STRICT_VAR=kept" {
+		t.Errorf("Expected the block's own first line as its command, got %q", result.Timings[0].Command)
+	}
+	if !strings.Contains(output, "still running kept") {
+		t.Errorf("Expected variables set by the strict block to be kept, got %q", output)
+	}
+	if !regexp.MustCompile(`errexit\s+off`).MatchString(output) || !regexp.MustCompile(`pipefail\s+off`).MatchString(output) {
+		t.Errorf("Expected later blocks to run without strict mode, got %q", output)
+	}
+	if len(result.Failures) != 1 || result.Failures[0].ExitStatus != 1 {
+		t.Errorf("Expected the strict block to fail with status 1, got %+v", result.Failures)
+	}
+}
+
+func TestRunMarkdownParallel(t *testing.T) {
+	mdContent := []byte("# Setup\n```bash {parallel}\nsleep 0.5\necho first\n```\n\n```bash {parallel}\nsleep 0.5\necho second\n```\n")
+
+	var buf bytes.Buffer
+	started := time.Now()
+	result, err := RunMarkdownWithOptions(mdContent, Options{Auto: true}, &buf, fakePrompt(nil))
+	if err != nil {
+		t.Fatalf("RunMarkdownWithOptions returned error: %v", err)
+	}
+	if took := time.Since(started); took >= time.Second {
+		t.Errorf("Expected parallel blocks to take less than serial time, took %v", took)
+	}
+	if result.BlocksRun != 2 {
+		t.Errorf("Expected 2 blocks run, got %d", result.BlocksRun)
+	}
+	output := buf.String()
+	first := strings.Index(output, "> Output [sleep 0.5]: first\n")
+	second := strings.Index(output, "> Output [sleep 0.5]: second\n")
+	if first < 0 || second < first {
+		t.Errorf("Expected both outputs in document order, got %q", output)
+	}
+}
+
+func TestRunMarkdownParallelChecks(t *testing.T) {
+	tc := []struct {
+		name      string
+		md        string
+		opts      Options
+		responses []string
+		blocksRun int
+		skipped   int
+		absent    string
+	}{
+		{
+			name:      "when per block",
+			md:        "# Setup\n[prompt]:# (mode \"Mode?\" fast)\n```bash {parallel}\necho first\n```\n```bash {parallel}\necho second\n```\n[when]:# (mode == slow)\n```bash {parallel}\necho third\n```\n",
+			opts:      Options{Auto: true},
+			blocksRun: 2,
+			absent:    "echo third",
+		},
+		{
+			name:    "language filter",
+			md:      "# Setup\n```bash {parallel}\necho first\n```\n```bash {parallel}\necho second\n```\n",
+			opts:    Options{Auto: true, Language: "sh"},
+			skipped: 2,
+			absent:  "Output",
+		},
+		{
+			name:      "danger not parallel",
+			md:        "# Setup\n```bash {parallel}\necho first\n```\n```bash {parallel}\necho second\n```\n```bash {parallel danger}\necho destroyed\n```\n",
+			responses: []string{"r", "r"},
+			blocksRun: 2,
+			skipped:   1,
+			absent:    "Output: destroyed",
+		},
+	}
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			result, err := RunMarkdownWithOptions([]byte(tt.md), tt.opts, &buf, fakePrompt(tt.responses))
+			if err != nil {
+				t.Fatalf("RunMarkdownWithOptions returned error: %v", err)
+			}
+			if result.BlocksRun != tt.blocksRun || result.BlocksSkipped != tt.skipped {
+				t.Errorf("Expected %d blocks run and %d skipped, got %+v", tt.blocksRun, tt.skipped, result)
+			}
+			if strings.Contains(buf.String(), tt.absent) {
+				t.Errorf("Expected no %q in %q", tt.absent, buf.String())
+			}
+		})
+	}
+}
+
+func TestRunMarkdownGroup(t *testing.T) {
+	mdContent := []byte("# Setup\n```bash {group}\nGREETING=hello\n```\n\n```bash {group}\necho \"$GREETING one\"\n```\n```bash {group}\necho two\n```\n")
+	tc := []struct {
+		name      string
+		responses []string
+		blocksRun int
+	}{
+		{"Run All", []string{"r"}, 3},
+		{"Skip All", []string{"s"}, 0},
+	}
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			prompts := 0
+			respond := fakePrompt(tt.responses)
+			promptFunc := func(msg string) string {
+				if strings.Contains(msg, "Run all 3 code blocks?") {
+					prompts++
+				}
+				return respond(msg)
+			}
+			var buf bytes.Buffer
+			result, err := RunMarkdownWithOptions(mdContent, Options{}, &buf, promptFunc)
+			if err != nil {
+				t.Fatalf("RunMarkdownWithOptions returned error: %v", err)
+			}
+			if prompts != 1 {
+				t.Errorf("Expected a single prompt for the group, got %d", prompts)
+			}
+			if result.BlocksRun != tt.blocksRun {
+				t.Errorf("Expected %d blocks run, got %d", tt.blocksRun, result.BlocksRun)
+			}
+			output := buf.String()
+			labeled := strings.Contains(output, "> Output [GREETING=hello]: (no output)\n") &&
+				strings.Contains(output, "> Output [echo \"$GREETING one\"]: hello one\n") &&
+				strings.Contains(output, "> Output [echo two]: two\n")
+			if labeled != (tt.blocksRun > 0) {
+				t.Errorf("Expected labeled outputs: %v, got %q", tt.blocksRun > 0, output)
+			}
+		})
+	}
+}
+
+func TestRunMarkdownGroupChecks(t *testing.T) {
+	tc := []struct {
+		name      string
+		md        string
+		opts      Options
+		responses []string
+		blocksRun int
+		expected  []string
+		absent    []string
+	}{
+		{
+			name:      "danger not grouped",
+			md:        "# Setup\n```bash {group}\necho one\n```\n```bash {group}\necho two\n```\n```bash {group danger}\necho destroyed\n```\n",
+			responses: []string{"r", "r"},
+			blocksRun: 2,
+			expected:  []string{"> Output [echo two]: two", "WARNING"},
+			absent:    []string{"Output: destroyed"},
+		},
+		{
+			name:     "language filter",
+			md:       "# Setup\n```bash {group}\necho one\n```\n```bash {group}\necho two\n```\n",
+			opts:     Options{Auto: true, Language: "sh"},
+			absent:   []string{"Output"},
+			expected: []string{"```bash {group}"},
+		},
+		{
+			name:      "sudo warning",
+			md:        "# Setup\n```bash {group}\nif false; then\nsudo true\nfi\n```\n```bash {group}\necho two\n```\n",
+			opts:      Options{Auto: true},
+			blocksRun: 2,
+			expected:  []string{DefaultMessages.Sudo},
+		},
+	}
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			defer CloseRunners()
+			var buf bytes.Buffer
+			result, err := RunMarkdownWithOptions([]byte(tt.md), tt.opts, &buf, fakePrompt(tt.responses))
+			if err != nil {
+				t.Fatalf("RunMarkdownWithOptions returned error: %v", err)
+			}
+			if result.BlocksRun != tt.blocksRun {
+				t.Errorf("Expected %d blocks run, got %d", tt.blocksRun, result.BlocksRun)
+			}
+			output := buf.String()
+			for _, want := range tt.expected {
+				if !strings.Contains(output, want) {
+					t.Errorf("Expected %q in %q", want, output)
+				}
+			}
+			for _, unwanted := range tt.absent {
+				if strings.Contains(output, unwanted) {
+					t.Errorf("Expected no %q in %q", unwanted, output)
+				}
+			}
+		})
+	}
+}
+
+func TestProcessCodeBlockDanger(t *testing.T) {
+	code := []string{"```bash {danger}", "echo destroyed", "```"}
+	tc := []struct {
+		name            string
+		promptResponses []string
+		codeExecuted    bool
+	}{
+		{"Run Is Not Enough", []string{"r"}, false},
+		{"Skip", []string{"s"}, false},
+		{"Confirmed", []string{"yes"}, true},
+	}
+
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			s := &session{w: &buf, promptFunc: fakePrompt(tt.promptResponses)}
+			err := s.processCodeBlock(code, "")
+			if err != nil {
+				t.Errorf("processCodeBlock returned error: %v", err)
+			}
+			output := buf.String()
+			if !strings.Contains(output, "WARNING") {
+				t.Errorf("Expected a danger warning, got %q", output)
+			}
+			if strings.Contains(output, "Output: destroyed") != tt.codeExecuted {
+				t.Errorf("Expected code executed: %v, got %q", tt.codeExecuted, output)
+			}
+		})
+	}
+}
+
+func TestRunMarkdownAutoVerify(t *testing.T) {
+	mdContent := []byte("# Install\n```bash\necho installed\n```\n```verify\ntrue\n```\n# Again\n```bash\necho again\n```\n```verify\ntrue\n```\n")
+
+	var prompts []string
+	responses := fakePrompt([]string{"r", "", "", "s"})
+	prompt := func(msg string) string {
+		prompts = append(prompts, msg)
+		return responses(msg)
+	}
+	var buf bytes.Buffer
+	result, err := RunMarkdownWithOptions(mdContent, Options{AutoVerify: true}, &buf, prompt)
+	if err != nil {
+		t.Fatalf("RunMarkdownWithOptions returned error: %v", err)
+	}
+	if result.VerifyPassed != 1 || result.BlocksRun != 2 || result.BlocksSkipped != 2 {
+		t.Errorf("Expected the first verify to run and the second to be skipped, got %+v", result)
+	}
+	runPrompts := 0
+	for _, msg := range prompts {
+		if strings.Contains(msg, "Run code?") {
+			runPrompts++
+		}
+	}
+	if runPrompts != 2 {
+		t.Errorf("Expected to be asked only about the bash blocks, got %q", prompts)
+	}
+}
+
+func TestRunMarkdownDisplayOnly(t *testing.T) {
+	mdContent := []byte("# Patch\n```diff\n-old\n+new\n```\n```mermaid\ngraph TD; A-->B\n```\n")
+
+	var prompts []string
+	prompt := func(msg string) string {
+		prompts = append(prompts, msg)
+		return ""
+	}
+	var buf bytes.Buffer
+	result, err := RunMarkdownWithOptions(mdContent, Options{}, &buf, prompt)
+	if err != nil {
+		t.Fatalf("RunMarkdownWithOptions returned error: %v", err)
+	}
+	if len(prompts) != 0 {
+		t.Errorf("Expected no prompts for display-only blocks, got %q", prompts)
+	}
+	output := buf.String()
+	if !strings.Contains(output, "\033[31m-old\033[0m\n\033[32m+new\033[0m") {
+		t.Errorf("Expected colored diff lines, got %q", output)
+	}
+	if strings.Contains(output, "No runner") || result.BlocksSkipped != 0 {
+		t.Errorf("Expected display-only blocks not to be treated as skipped, got %q", output)
+	}
+}
+
+func TestRunMarkdownLanguageFilter(t *testing.T) {
+	mdContent := []byte("# Mixed\n```bash\necho from bash\n```\n```verify\necho from verify\n```\n```console\n$ echo from console\n```\n")
+
+	var buf bytes.Buffer
+	_, err := RunMarkdownWithOptions(mdContent, Options{Language: "verify", Auto: true}, &buf, fakePrompt(nil))
+	if err != nil {
+		t.Errorf("RunMarkdownWithOptions returned error: %v", err)
+	}
+	output := buf.String()
+	if strings.Count(output, "Output:") != 1 || !strings.Contains(output, "Output: \x1b[32mSuccess") {
+		t.Errorf("Expected only the verify block to run, got %q", output)
+	}
+	if !strings.Contains(output, "echo from bash") {
+		t.Errorf("Expected skipped blocks to be displayed, got %q", output)
+	}
+
+	buf.Reset()
+	_, err = RunMarkdownWithOptions(mdContent, Options{Language: "bash", Auto: true}, &buf, fakePrompt(nil))
+	if err != nil {
+		t.Errorf("RunMarkdownWithOptions returned error: %v", err)
+	}
+	output = buf.String()
+	// console is an alias of bash, so both blocks run.
+	if !strings.Contains(output, "Output: from bash") || !strings.Contains(output, "Output: from console") || strings.Contains(output, "Success") {
+		t.Errorf("Expected only bash blocks to run, got %q", output)
+	}
+}
+
+func TestRunMarkdownMultiplePrompts(t *testing.T) {
+	mdContent := []byte(`# Heading One
+Paragraph one.
+## Heading Two
+Paragraph two.
+`)
+	tc := []struct {
+		name            string
+		promptResponses []string
+		expectedOutput  string
+	}{
+		{"Exit After One", []string{"exit"}, "# Heading One\nParagraph one."},
+		{"Exit After Two", []string{"", "exit"}, "# Heading One\nParagraph one.\n\n## Heading Two\nParagraph two."},
+		{"Continue to End", []string{"", "", ""}, "# Heading One\nParagraph one.\n\n## Heading Two\nParagraph two.\n\n> README complete!\n"},
+	}
+
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			prompt := fakePrompt(tt.promptResponses)
+			err := RunMarkdown(mdContent, "", nil, &buf, prompt)
+			if err != nil {
+				t.Errorf("RunMarkdown returned error: %v", err)
+			}
+			output := buf.String()
+			if !strings.Contains(output, tt.expectedOutput) {
+				t.Errorf("Expected output to contain %q, but got %q", tt.expectedOutput, output)
+			}
+		})
+	}
+}
+
+func TestRunMarkdownWithStartAnchor(t *testing.T) {
+	mdContent := []byte(`# Title
+Paragraph one.
+## Section One
+Paragraph two.
+## Subsection
+Paragraph three.
+## Subsection
+Oh no, a match!
 `)
 
 	tc := []struct {
@@ -246,6 +1246,129 @@ Oh no, a match!
 	}
 }
 
+func TestRunMarkdownStartLine(t *testing.T) {
+	mdContent := []byte(`# Title
+[tags]:# (always)
+Paragraph one.
+## Section One
+[tags]:# (one)
+Paragraph two.
+## Section Two
+[tags]:# (two)
+Paragraph three.
+`)
+	tc := []struct {
+		name       string
+		startLine  int
+		contain    string
+		notContain string
+	}{
+		{"Start Of Section", 4, "# Title\nParagraph one.\n\n## Section One\nParagraph two.\n", ""},
+		{"Middle Of Section", 6, "# Title\nParagraph one.\n\n## Section One\nParagraph two.\n", ""},
+		{"Later Section", 7, "# Title\nParagraph one.\n\n## Section Two\nParagraph three.\n", "## Section One"},
+	}
+
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			_, err := RunMarkdownWithOptions(mdContent, Options{StartLine: tt.startLine}, &buf, fakePrompt(nil))
+			if err != nil {
+				t.Errorf("RunMarkdownWithOptions returned error: %v", err)
+			}
+			output := buf.String()
+			if !strings.Contains(output, tt.contain) {
+				t.Errorf("Expected output to contain %q, but got %q", tt.contain, output)
+			}
+			if tt.notContain != "" && strings.Contains(output, tt.notContain) {
+				t.Errorf("Expected output to not contain %q, but got %q", tt.notContain, output)
+			}
+		})
+	}
+}
+
+func TestRunMarkdownLineRanges(t *testing.T) {
+	mdContent := []byte(`# Title
+[tags]:# (always)
+Paragraph one.
+## Section One
+Paragraph two.
+## Section Two
+Paragraph three.
+
+## Section Three
+Paragraph four.
+`)
+	tc := []struct {
+		name       string
+		ranges     []LineRange
+		contain    []string
+		notContain []string
+	}{
+		{"Single Line", []LineRange{{5, 5}}, []string{"# Title", "## Section One"}, []string{"## Section Two", "## Section Three"}},
+		{"Trailing Blank Line", []LineRange{{8, 8}}, []string{"## Section Two"}, []string{"## Section One", "## Section Three"}},
+		{"Spanning Sections", []LineRange{{7, 9}}, []string{"## Section Two", "## Section Three"}, []string{"## Section One"}},
+	}
+
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			_, err := RunMarkdownWithOptions(mdContent, Options{Auto: true, LineRanges: tt.ranges}, &buf, fakePrompt(nil))
+			if err != nil {
+				t.Errorf("RunMarkdownWithOptions returned error: %v", err)
+			}
+			output := buf.String()
+			for _, s := range tt.contain {
+				if !strings.Contains(output, s) {
+					t.Errorf("Expected output to contain %q, but got %q", s, output)
+				}
+			}
+			for _, s := range tt.notContain {
+				if strings.Contains(output, s) {
+					t.Errorf("Expected output to not contain %q, but got %q", s, output)
+				}
+			}
+		})
+	}
+}
+
+func TestRunMarkdownResult(t *testing.T) {
+	mdContent := []byte(`# Title
+[prompt]:# (result_name "Name?" [a b] a)
+` + "```bash\necho one\n```" + `
+` + "```bash\necho two\n```" + `
+` + "```verify\nexit 0\n```" + `
+` + "```verify\nexit 1\n```" + `
+## Never Reached
+`)
+	// Answer the prompt, run, skip, run, then run and exit after the last block.
+	responses := []string{"b", "r", "", "s", "r", "", "r", "x"}
+
+	var buf bytes.Buffer
+	result, err := RunMarkdownWithOptions(mdContent, Options{}, &buf, fakePrompt(responses))
+	if err != nil {
+		t.Fatalf("RunMarkdownWithOptions returned error: %v", err)
+	}
+	expected := RunResult{
+		SectionsShown:   6,
+		BlocksRun:       3,
+		BlocksSkipped:   1,
+		VerifyPassed:    1,
+		VerifyFailures:  1,
+		PromptsAnswered: 1,
+		ExitedEarly:     true,
+		Answers:         map[string]string{"result_name": "b"},
+		Failures:        []Failure{{Section: "Title", Command: "exit 1", ExitStatus: 1}},
+	}
+	// Durations vary between runs, so only the number of timings is checked.
+	if len(result.Timings) != expected.BlocksRun {
+		t.Errorf("Expected %d timings, got %d", expected.BlocksRun, len(result.Timings))
+	}
+	result.Timings = nil
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, result)
+	}
+}
+
 func TestComplexMarkdown(t *testing.T) {
 	mdContent := []byte(`# Title
 - item1
@@ -276,3 +1399,400 @@ No newline.
 		t.Errorf("RunMarkdown output mismatch.\nGot:\n%s\nWant:\n%s", got, want)
 	}
 }
+
+func TestRunMarkdownBlockquote(t *testing.T) {
+	// The line-based parser prints blockquotes as written, so paragraphs and
+	// lists nested in a quote keep their "> " prefix.
+	quote := []string{
+		"> First paragraph.",
+		">",
+		"> Second paragraph:",
+		"> - item one",
+		">   - nested item",
+	}
+	mdContent := []byte("# Title\n" + strings.Join(quote, "\n") + "\n")
+
+	var buf bytes.Buffer
+	if err := RunMarkdown(mdContent, "", nil, &buf, fakePrompt(nil)); err != nil {
+		t.Fatalf("RunMarkdown returned error: %v", err)
+	}
+	if !strings.Contains(buf.String(), strings.Join(quote, "\n")+"\n") {
+		t.Errorf("Expected every blockquote line to keep its prefix, got %q", buf.String())
+	}
+}
+
+func TestRunMarkdownCompleteMessage(t *testing.T) {
+	tc := []struct {
+		name string
+		omit bool
+		want bool
+	}{
+		{"default", false, true},
+		{"omitted", true, false},
+	}
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			_, err := RunMarkdownWithOptions([]byte("# Title\nText.\n"), Options{OmitCompleteMessage: tt.omit}, &buf, fakePrompt(nil))
+			if err != nil {
+				t.Fatalf("RunMarkdownWithOptions returned error: %v", err)
+			}
+			if got := strings.Contains(buf.String(), "README complete!"); got != tt.want {
+				t.Errorf("Expected complete message: %v, got %q", tt.want, buf.String())
+			}
+		})
+	}
+}
+
+func TestRunMarkdownPager(t *testing.T) {
+	mdContent := []byte("# Title\nParagraph one.\n")
+	var paged []string
+	opts := Options{Pager: func(content string) error {
+		paged = append(paged, content)
+		return nil
+	}}
+
+	var buf bytes.Buffer
+	_, err := RunMarkdownWithOptions(mdContent, opts, &buf, fakePrompt(nil))
+	if err != nil {
+		t.Errorf("RunMarkdownWithOptions returned error: %v", err)
+	}
+	if len(paged) != 1 || paged[0] != "# Title\nParagraph one.\n" {
+		t.Errorf("Expected section to be paged, got %q", paged)
+	}
+	if strings.Contains(buf.String(), "Paragraph one.") {
+		t.Errorf("Expected paged section to be omitted from writer, got %q", buf.String())
+	}
+}
+
+func TestRunMarkdownStopOnFailure(t *testing.T) {
+	mdContent := []byte("# One\n```bash\necho first; false\n```\n# Two\n```bash\n(exit 3)\n```\n# Three\n```bash\necho last\n```\n")
+	tc := []struct {
+		name     string
+		stop     bool
+		failures []Failure
+		ran      bool
+	}{
+		{"keep going", false, []Failure{{"One", "echo first; false", 1, 0}, {"Two", "(exit 3)", 3, 0}}, true},
+		{"stop", true, []Failure{{"One", "echo first; false", 1, 0}}, false},
+	}
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			result, err := RunMarkdownWithOptions(mdContent, Options{Auto: true, StopOnFailure: tt.stop}, &buf, fakePrompt(nil))
+			if tt.stop != errors.Is(err, ErrBlockFailed) {
+				t.Errorf("Unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(result.Failures, tt.failures) {
+				t.Errorf("Expected failures %+v, got %+v", tt.failures, result.Failures)
+			}
+			output := buf.String()
+			if strings.Contains(output, "Output: last") != tt.ran {
+				t.Errorf("Expected later blocks to run: %v, got %q", tt.ran, output)
+			}
+			if tt.ran && !strings.Contains(output, "> Failed code blocks:\n  One: echo first; false (status 1)\n  Two: (exit 3) (status 3)\n") {
+				t.Errorf("Expected a summary of the failures, got %q", output)
+			}
+		})
+	}
+}
+
+func TestRunMarkdownExpectExit(t *testing.T) {
+	tc := []struct {
+		name     string
+		code     string
+		failures []Failure
+	}{
+		{"Fails As Expected", "(exit 1)", nil},
+		{"Succeeds Unexpectedly", "true", []Failure{{"Broken", "true", 0, 1}}},
+		{"Fails Differently", "(exit 2)", []Failure{{"Broken", "(exit 2)", 2, 1}}},
+	}
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			mdContent := []byte("# Broken\n```bash {expect-exit=1}\n" + tt.code + "\n```\n")
+			var buf bytes.Buffer
+			result, err := RunMarkdownWithOptions(mdContent, Options{Auto: true, StopOnFailure: true}, &buf, fakePrompt(nil))
+			if (tt.failures != nil) != errors.Is(err, ErrBlockFailed) {
+				t.Errorf("Unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(result.Failures, tt.failures) {
+				t.Errorf("Expected failures %+v, got %+v", tt.failures, result.Failures)
+			}
+		})
+	}
+}
+
+func TestRunMarkdownVerifyExpectExit(t *testing.T) {
+	tc := []struct {
+		name     string
+		code     string
+		passed   int
+		expected string
+	}{
+		{"Fails As Expected", "(exit 1)", 1, "Success"},
+		{"Succeeds Unexpectedly", "true", 0, "Failure [command exited with status 0, expected 1]"},
+	}
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			defer CloseRunners()
+			mdContent := []byte("# Check\n```verify {expect-exit=1}\n" + tt.code + "\n```\n")
+			var buf bytes.Buffer
+			result, err := RunMarkdownWithOptions(mdContent, Options{Auto: true}, &buf, fakePrompt(nil))
+			if err != nil {
+				t.Fatalf("RunMarkdownWithOptions returned error: %v", err)
+			}
+			if result.VerifyPassed != tt.passed || result.VerifyFailures != 1-tt.passed || len(result.Failures) != 1-tt.passed {
+				t.Errorf("Expected %d verify blocks passed, got %+v", tt.passed, result)
+			}
+			if !strings.Contains(buf.String(), tt.expected) {
+				t.Errorf("Expected %q, got %q", tt.expected, buf.String())
+			}
+		})
+	}
+}
+
+func TestRunMarkdownInvalidExpectExit(t *testing.T) {
+	mdContent := []byte("# Broken\n```bash {expect-exit=one}\necho never\n```\n")
+	var buf bytes.Buffer
+	_, err := RunMarkdownWithOptions(mdContent, Options{Auto: true}, &buf, fakePrompt(nil))
+	if err == nil || !strings.Contains(err.Error(), "{expect-exit=one}") {
+		t.Errorf("Expected an error about the exit status, got %v", err)
+	}
+	if strings.Contains(buf.String(), "Output: never") {
+		t.Errorf("Expected the block not to run, got %q", buf.String())
+	}
+}
+
+func TestRunMarkdownUnknownAnswers(t *testing.T) {
+	defer CloseRunners()
+	mdContent := []byte("[prompt]:# (NAME \"Name?\" world)\n# Hi\n```bash\necho \"hello $NAME\"\n```\n")
+	tc := []struct {
+		name   string
+		opts   Options
+		warned bool
+		output string
+	}{
+		{"supplied", Options{Auto: true, Answers: map[string]string{"OTHER": "x"}}, true, "hello world"},
+		{"carried over", Options{Auto: true, CarriedAnswers: map[string]string{"OTHER": "x", "NAME": "bob"}}, false, "hello bob"},
+		{"supplied wins", Options{Auto: true, Answers: map[string]string{"NAME": "ann"}, CarriedAnswers: map[string]string{"NAME": "bob"}}, false, "hello ann"},
+	}
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if _, err := RunMarkdownWithOptions(mdContent, tt.opts, &buf, fakePrompt(nil)); err != nil {
+				t.Fatalf("RunMarkdownWithOptions returned error: %v", err)
+			}
+			if strings.Contains(buf.String(), "no prompt found") != tt.warned {
+				t.Errorf("Expected a warning: %v, got %q", tt.warned, buf.String())
+			}
+			if !strings.Contains(buf.String(), "> Output: "+tt.output) {
+				t.Errorf("Expected output %q, got %q", tt.output, buf.String())
+			}
+		})
+	}
+}
+
+func TestRunMarkdownRepeatAnswers(t *testing.T) {
+	defer CloseRunners()
+	mdContent := []byte("[prompt]:# (NAME \"Name?\" world)\n# Hi\n```bash\necho \"hello $NAME\"\n```\n")
+	var buf bytes.Buffer
+	opts := Options{Auto: true, Repeat: 2, Answers: map[string]string{"NAME": "bob"}}
+	if _, err := RunMarkdownWithOptions(mdContent, opts, &buf, fakePrompt(nil)); err != nil {
+		t.Fatalf("RunMarkdownWithOptions returned error: %v", err)
+	}
+	if got := strings.Count(buf.String(), "> Output: hello bob"); got != 2 {
+		t.Errorf("Expected the supplied answer in both iterations, got %q", buf.String())
+	}
+	if len(opts.Answers) != 1 {
+		t.Errorf("Expected the supplied answers to be left alone, got %v", opts.Answers)
+	}
+}
+
+func TestRunMarkdownMaxSections(t *testing.T) {
+	mdContent := []byte("Intro text\n# One\n[tags]:# (keep)\n```bash\necho one\n```\n# Two\n# Three\n[tags]:# (keep)\n# Four\n[tags]:# (keep)\n")
+	tc := []struct {
+		name     string
+		opts     Options
+		expected []string
+		limited  bool
+	}{
+		{"Limit", Options{MaxSections: 2}, []string{"# One", "# Two"}, true},
+		{"After Start", Options{MaxSections: 2, StartAnchor: "two"}, []string{"# Two", "# Three"}, true},
+		{"After Tags", Options{MaxSections: 2, Tags: []string{"keep"}}, []string{"# One", "# Three"}, true},
+		{"Above Count", Options{MaxSections: 10}, []string{"# One", "# Two", "# Three", "# Four"}, false},
+	}
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.opts.Auto = true
+			var buf bytes.Buffer
+			if _, err := RunMarkdownWithOptions(mdContent, tt.opts, &buf, fakePrompt(nil)); err != nil {
+				t.Fatalf("RunMarkdownWithOptions returned error: %v", err)
+			}
+			output := buf.String()
+			var headers []string
+			for _, line := range strings.Split(output, "\n") {
+				if strings.HasPrefix(line, "# ") {
+					headers = append(headers, line)
+				}
+			}
+			if !reflect.DeepEqual(headers, tt.expected) {
+				t.Errorf("Expected headers %q, got %q", tt.expected, headers)
+			}
+			if strings.Contains(output, "> Stopped after 2 sections") != tt.limited {
+				t.Errorf("Expected stop note: %v, got %q", tt.limited, output)
+			}
+		})
+	}
+}
+
+func TestRunMarkdownTagOrder(t *testing.T) {
+	mdContent := []byte("# Deploy\n[tags]:# (main)\n```bash\necho deploy\n```\n# Install\n[tags]:# (prereq)\n```bash\necho install\n```\n# Verify\n[tags]:# (main)\n```bash\necho verify\n```\n# Configure\n[tags]:# (prereq)\n```bash\necho configure\n```\n# Notes\n")
+	tc := []struct {
+		name     string
+		order    []string
+		expected []string
+	}{
+		{"Prereq First", []string{"prereq", "main"}, []string{"install", "configure", "deploy", "verify"}},
+		{"Main First", []string{"main", "prereq"}, []string{"deploy", "verify", "install", "configure"}},
+		{"Document Order", nil, []string{"deploy", "install", "verify", "configure"}},
+	}
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			opts := Options{Auto: true, Tags: []string{"prereq", "main"}, TagOrder: tt.order}
+			if _, err := RunMarkdownWithOptions(mdContent, opts, &buf, fakePrompt(nil)); err != nil {
+				t.Fatalf("RunMarkdownWithOptions returned error: %v", err)
+			}
+			var ran []string
+			for _, line := range strings.Split(buf.String(), "\n") {
+				if out, ok := strings.CutPrefix(line, "> Output: "); ok {
+					ran = append(ran, out)
+				}
+			}
+			if !reflect.DeepEqual(ran, tt.expected) {
+				t.Errorf("Expected blocks to run in order %q, got %q", tt.expected, ran)
+			}
+		})
+	}
+}
+
+func TestRunMarkdownRepeat(t *testing.T) {
+	defer CloseRunners()
+	mdContent := []byte("# Count\n```bash\necho \"count=${REPEAT_COUNT:-0}\"; REPEAT_COUNT=$(( ${REPEAT_COUNT:-0} + 1 ))\n```\n")
+	tc := []struct {
+		name     string
+		opts     Options
+		expected []string
+	}{
+		{"Keep Shell", Options{Repeat: 2}, []string{"count=0", "count=1"}},
+		{"Fresh Shells", Options{Repeat: 2, FreshShells: true}, []string{"count=0", "count=0"}},
+		{"Once", Options{}, []string{"count=0"}},
+	}
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			CloseRunners()
+			tt.opts.Auto = true
+			var buf bytes.Buffer
+			if _, err := RunMarkdownWithOptions(mdContent, tt.opts, &buf, fakePrompt(nil)); err != nil {
+				t.Fatalf("RunMarkdownWithOptions returned error: %v", err)
+			}
+			output := buf.String()
+			var counts []string
+			for _, line := range strings.Split(output, "\n") {
+				if out, ok := strings.CutPrefix(line, "> Output: "); ok {
+					counts = append(counts, out)
+				}
+			}
+			if !reflect.DeepEqual(counts, tt.expected) {
+				t.Errorf("Expected outputs %q, got %q", tt.expected, counts)
+			}
+			if got := strings.Count(output, "# Count"); got != len(tt.expected) {
+				t.Errorf("Expected the README to render %d times, got %d in %q", len(tt.expected), got, output)
+			}
+			if tt.opts.Repeat > 1 && !strings.Contains(output, "> Iteration 2 of 2") {
+				t.Errorf("Expected an iteration header, got %q", output)
+			}
+			if got := strings.Count(output, "> README complete!"); got != 1 {
+				t.Errorf("Expected one complete message, got %d", got)
+			}
+		})
+	}
+}
+
+func TestRunMarkdownStartedAt(t *testing.T) {
+	mdContent := []byte("# Title\n## Section One {#one}\nText.\n## Section Two\nMore.\n")
+	tc := []struct {
+		name     string
+		start    string
+		expected string
+	}{
+		{"anchor", "section-two", "> (started at: Section Two)\n## Section Two"},
+		{"explicit anchor", "one", "> (started at: Section One)\n## Section One"},
+		{"part of a header", "two", "> (started at: Section Two)\n## Section Two"},
+		{"no match", "missing", ""},
+		{"no start", "", ""},
+	}
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if _, err := RunMarkdownWithOptions(mdContent, Options{Auto: true, StartAnchor: tt.start}, &buf, fakePrompt(nil)); err != nil {
+				t.Fatalf("RunMarkdownWithOptions returned error: %v", err)
+			}
+			output := buf.String()
+			if tt.expected == "" && strings.Contains(output, "started at") {
+				t.Errorf("Expected no start notice, got %q", output)
+			}
+			if tt.expected != "" && !strings.HasPrefix(output, tt.expected) {
+				t.Errorf("Expected output to start with %q, got %q", tt.expected, output)
+			}
+		})
+	}
+}
+
+func TestRunMarkdownShellEscape(t *testing.T) {
+	mdContent := []byte("# Intro\n# Setup\n```bash\nESCAPE_STATE=ready\n```\n")
+
+	// Run a command before advancing to the next section, then check the
+	// state left by the block at the continue prompt.
+	responses := []string{"! echo hi", "", "r", "!echo \"state is $ESCAPE_STATE\"", ""}
+	var buf bytes.Buffer
+	if _, err := RunMarkdownWithOptions(mdContent, Options{}, &buf, fakePrompt(responses)); err != nil {
+		t.Fatalf("RunMarkdownWithOptions returned error: %v", err)
+	}
+	output := buf.String()
+	hi := strings.Index(output, "> Output: hi\n")
+	if hi < 0 || hi > strings.Index(output, "# Setup") {
+		t.Errorf("Expected the command to run before advancing, got %q", output)
+	}
+	if !strings.Contains(output, "> Output: state is ready\n") {
+		t.Errorf("Expected the command to run in the persistent shell, got %q", output)
+	}
+}
+
+func TestRunMarkdownAuto(t *testing.T) {
+	mdContent := []byte("# Title\n```bash\necho auto run\n```\n## Next\n```verify\nexit 1\n```\n")
+
+	var buf bytes.Buffer
+	prompted := 0
+	prompt := func(string) string {
+		prompted++
+		return "x"
+	}
+	result, err := RunMarkdownWithOptions(mdContent, Options{Auto: true}, &buf, prompt)
+	if err != nil {
+		t.Errorf("RunMarkdownWithOptions returned error: %v", err)
+	}
+	if prompted != 0 {
+		t.Errorf("Expected no prompts in auto mode, got %d", prompted)
+	}
+	output := buf.String()
+	if !strings.Contains(output, "Output: auto run") {
+		t.Errorf("Expected code block to run, got %q", output)
+	}
+	if !strings.Contains(output, "README complete!") {
+		t.Errorf("Expected run to complete, got %q", output)
+	}
+	if result.VerifyFailures != 1 {
+		t.Errorf("Expected 1 verify failure, got %d", result.VerifyFailures)
+	}
+}
@@ -0,0 +1,21 @@
+package readmerunner
+
+import (
+	"strings"
+)
+
+// stdinDelimiter ends the here-document holding a code block's input.
+const stdinDelimiter = "__README_RUNNER_STDIN__"
+
+// parseStdin returns the input line declared by a stdin directive, e.g.
+// "[stdin]:# (hello world)".
+func parseStdin(trimmed string) string {
+	return directiveText(trimmed, "[stdin]:#")
+}
+
+// withStdin wraps a shell snippet so that the input lines are fed to its
+// standard input with a here-document.  Without it, commands reading stdin
+// would read the rest of the script from the persistent shell's pipe.
+func withStdin(code string, stdin []string) string {
+	return "{\n" + code + "\n} <<'" + stdinDelimiter + "'\n" + strings.Join(stdin, "\n") + "\n" + stdinDelimiter
+}
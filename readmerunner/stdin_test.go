@@ -0,0 +1,26 @@
+package readmerunner
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestRunMarkdownStdin(t *testing.T) {
+	mdContent := []byte("# Input\n[stdin]:# (first line)\n[stdin]:# (second line)\n```bash\ncat\nstage=done\n```\n```bash\necho $stage\n```\n")
+
+	var buf bytes.Buffer
+	if _, err := RunMarkdownWithOptions(mdContent, Options{Auto: true}, &buf, fakePrompt(nil)); err != nil {
+		t.Fatalf("RunMarkdownWithOptions returned error: %v", err)
+	}
+	output := buf.String()
+	if !strings.Contains(output, "> Output: first line\nsecond line\n") {
+		t.Errorf("Expected the block to read its stdin, got %q", output)
+	}
+	if strings.Contains(output, "[stdin]:#") {
+		t.Errorf("Expected stdin directives to be hidden, got %q", output)
+	}
+	if !strings.Contains(output, "> Output: done\n") {
+		t.Errorf("Expected variables set by the block to be kept, got %q", output)
+	}
+}
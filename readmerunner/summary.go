@@ -0,0 +1,176 @@
+package readmerunner
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// RunSummary describes what a run of a README would execute, e.g. to ask
+// before running an unfamiliar document.
+type RunSummary struct {
+	// Blocks counts the runnable code blocks by fence language.
+	Blocks map[string]int
+	// Variables lists the variables set by prompts, in document order.
+	Variables []string
+}
+
+// SummarizeRun counts the runnable code blocks and prompted variables of the
+// sections a run with opts goes through.  Nothing is run.
+func SummarizeRun(mdContent []byte, opts Options) RunSummary {
+	summary := RunSummary{Blocks: map[string]int{}}
+	seen := map[string]bool{}
+	for _, sec := range selectSections(mdContent, opts) {
+		switch sec.Type {
+		case SectionCode:
+			lang := parseFence(sec.Lines[0]).Language
+			if len(sec.Lines) <= 2 || runnerCommand(lang) == "" {
+				continue
+			}
+			if opts.Language != "" && resolveLanguage(opts.Language) != resolveLanguage(lang) {
+				continue
+			}
+			summary.Blocks[lang]++
+		case SectionPrompt:
+			pd, err := parsePrompt(strings.TrimSpace(sec.Lines[0]))
+			if err == nil && !seen[pd.VarName] {
+				seen[pd.VarName] = true
+				summary.Variables = append(summary.Variables, pd.VarName)
+			}
+		}
+	}
+	return summary
+}
+
+// String describes the summary in a sentence, e.g. "This README contains 5
+// code blocks (3 bash, 2 verify) and will set 2 environment variables."
+func (rs RunSummary) String() string {
+	total := 0
+	for _, n := range rs.Blocks {
+		total += n
+	}
+	// The most common languages come first.
+	langs := byCount(rs.Blocks)
+	counts := make([]string, len(langs))
+	for i, lang := range langs {
+		counts[i] = fmt.Sprintf("%d %s", rs.Blocks[lang], lang)
+	}
+
+	s := "This README contains " + plural(total, "code block")
+	if len(counts) > 0 {
+		s += " (" + strings.Join(counts, ", ") + ")"
+	}
+	return s + " and will set " + plural(len(rs.Variables), "environment variable") + "."
+}
+
+// DocumentSummary counts what a README is made of, for a quick overview
+// without running it.
+type DocumentSummary struct {
+	// Headings counts the headers by level.
+	Headings map[int]int
+	// Blocks counts all code blocks by fence language, including those that
+	// can't be run.  Blocks without a language are counted under "".
+	Blocks map[string]int
+	// Prompts counts the prompt directives.
+	Prompts int
+	// Tags counts the headers carrying each tag, including inherited tags.
+	Tags map[string]int
+}
+
+// SummarizeDocument counts the headers, code blocks, prompts and tags of the
+// whole markdown content.  Nothing is run.
+func SummarizeDocument(mdContent []byte) DocumentSummary {
+	summary := DocumentSummary{Headings: map[int]int{}, Blocks: map[string]int{}, Tags: map[string]int{}}
+	for _, sec := range parseSections(mdContent, "", nil) {
+		switch sec.Type {
+		case SectionHeader:
+			summary.Headings[sec.Level]++
+			for _, tag := range sec.Tags {
+				summary.Tags[tag]++
+			}
+		case SectionCode:
+			summary.Blocks[parseFence(sec.Lines[0]).Language]++
+		case SectionPrompt:
+			summary.Prompts++
+		}
+	}
+	return summary
+}
+
+// String lists the counts one per line, e.g. "Code blocks: 3 (2 bash, 1
+// json)".
+func (ds DocumentSummary) String() string {
+	sections := 0
+	levels := make([]int, 0, len(ds.Headings))
+	for level, n := range ds.Headings {
+		levels = append(levels, level)
+		sections += n
+	}
+	sort.Ints(levels)
+	headings := make([]string, len(levels))
+	for i, level := range levels {
+		headings[i] = fmt.Sprintf("%d h%d", ds.Headings[level], level)
+	}
+
+	blocks := 0
+	for _, n := range ds.Blocks {
+		blocks += n
+	}
+	languages := make([]string, 0, len(ds.Blocks))
+	for _, lang := range byCount(ds.Blocks) {
+		name := lang
+		if name == "" {
+			name = "no language"
+		}
+		languages = append(languages, fmt.Sprintf("%d %s", ds.Blocks[lang], name))
+	}
+
+	tags := make([]string, 0, len(ds.Tags))
+	for _, tag := range byCount(ds.Tags) {
+		tags = append(tags, fmt.Sprintf("%s (%d)", tag, ds.Tags[tag]))
+	}
+
+	lines := []string{
+		fmt.Sprintf("Sections: %d", sections),
+		"Headings: " + joinOrNone(headings),
+		fmt.Sprintf("Code blocks: %d", blocks),
+		fmt.Sprintf("Prompts: %d", ds.Prompts),
+		"Tags: " + joinOrNone(tags),
+	}
+	if len(languages) > 0 {
+		lines[2] += " (" + strings.Join(languages, ", ") + ")"
+	}
+	return strings.Join(lines, "\n")
+}
+
+// byCount returns the keys of counts, the largest count first and then in
+// alphabetical order.
+func byCount(counts map[string]int) []string {
+	keys := make([]string, 0, len(counts))
+	for k := range counts {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if counts[keys[i]] != counts[keys[j]] {
+			return counts[keys[i]] > counts[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+	return keys
+}
+
+// joinOrNone joins items with commas, or returns "none" when there are none.
+func joinOrNone(items []string) string {
+	if len(items) == 0 {
+		return "none"
+	}
+	return strings.Join(items, ", ")
+}
+
+// plural formats a count of things, e.g. "1 code block" or "2 code blocks".
+func plural(n int, thing string) string {
+	if n == 1 {
+		return "1 " + thing
+	}
+	return fmt.Sprintf("%d %ss", n, thing)
+}
@@ -0,0 +1,83 @@
+package readmerunner
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSummarizeDocument(t *testing.T) {
+	mdContent := []byte(`# Guide
+[tags]:# (linux)
+[prompt]:# (region "Which region?" us-east-1)
+## Install
+` + "```bash\necho one\n```\n```bash\necho two\n```\n```json\n{}\n```\n" + `## Check
+[tags]:# (ci, linux)
+[prompt]:# (zone "Which zone?" a)
+` + "```verify\ntrue\n```\n```\nplain\n```\n")
+
+	summary := SummarizeDocument(mdContent)
+	expected := DocumentSummary{
+		Headings: map[int]int{1: 1, 2: 2},
+		Blocks:   map[string]int{"bash": 2, "json": 1, "verify": 1, "": 1},
+		Prompts:  2,
+		Tags:     map[string]int{"linux": 3, "ci": 1},
+	}
+	if !reflect.DeepEqual(summary, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, summary)
+	}
+	message := "Sections: 3\nHeadings: 1 h1, 2 h2\nCode blocks: 5 (2 bash, 1 no language, 1 json, 1 verify)\nPrompts: 2\nTags: linux (3), ci (1)"
+	if got := summary.String(); got != message {
+		t.Errorf("Expected %q, got %q", message, got)
+	}
+	if got := SummarizeDocument([]byte("Just text.\n")).String(); !strings.Contains(got, "Headings: none") || !strings.Contains(got, "Tags: none") {
+		t.Errorf("Expected none for missing headings and tags, got %q", got)
+	}
+}
+
+func TestSummarizeRun(t *testing.T) {
+	mdContent := []byte(`# Setup
+[prompt]:# (region "Which region?" us-east-1)
+` + "```bash\necho one\n```\n```bash\necho two\n```\n```json\n{}\n```\n" + `[prompt]:# (region "Which region again?" us-east-1)
+## Check
+[prompt]:# (zone "Which zone?" a)
+` + "```verify\ntrue\n```\n```sh\necho three\n```\n```verify\ntrue\n```\n")
+
+	tc := []struct {
+		name      string
+		opts      Options
+		blocks    map[string]int
+		variables []string
+		message   string
+	}{
+		{
+			"all", Options{},
+			map[string]int{"bash": 2, "verify": 2, "sh": 1}, []string{"region", "zone"},
+			"This README contains 5 code blocks (2 bash, 2 verify, 1 sh) and will set 2 environment variables.",
+		},
+		{
+			"start", Options{StartAnchor: "check"},
+			map[string]int{"verify": 2, "sh": 1}, []string{"zone"},
+			"This README contains 3 code blocks (2 verify, 1 sh) and will set 1 environment variable.",
+		},
+		{
+			"language", Options{Language: "verify", StartAnchor: "check"},
+			map[string]int{"verify": 2}, []string{"zone"},
+			"This README contains 2 code blocks (2 verify) and will set 1 environment variable.",
+		},
+	}
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			summary := SummarizeRun(mdContent, tt.opts)
+			if !reflect.DeepEqual(summary.Blocks, tt.blocks) {
+				t.Errorf("Expected blocks %v, got %v", tt.blocks, summary.Blocks)
+			}
+			if !reflect.DeepEqual(summary.Variables, tt.variables) {
+				t.Errorf("Expected variables %v, got %v", tt.variables, summary.Variables)
+			}
+			if got := summary.String(); got != tt.message {
+				t.Errorf("Expected %q, got %q", tt.message, got)
+			}
+		})
+	}
+}
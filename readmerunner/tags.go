@@ -1,24 +1,142 @@
 package readmerunner
 
 import (
+	"bufio"
 	"fmt"
 	"regexp"
+	"sort"
 	"strings"
+	"unicode"
 )
 
 // parseTags parses a tag directive of the form:
 // [tags]:# (always foo bar)
+// Tags may also be separated by commas, as in "(foo, bar)".
 func parseTags(line string) ([]string, error) {
 	re := regexp.MustCompile(`^\[tags\]:#\s*\(\s*([^)]+)\s*\)$`)
 	matches := re.FindStringSubmatch(line)
 	if matches == nil {
 		return nil, fmt.Errorf("invalid tags directive format")
 	}
-	// Split by whitespace.
-	parts := strings.Fields(matches[1])
+	// Split by whitespace and commas.
+	parts := strings.FieldsFunc(matches[1], isListSeparator)
+	if len(parts) == 0 {
+		return nil, fmt.Errorf("invalid tags directive format")
+	}
 	return parts, nil
 }
 
+// defaultTagsPrefix starts the directive declaring the tags of every section
+// that doesn't declare its own, e.g. "[tags-default]:# (linux)".
+const defaultTagsPrefix = "[tags-default]:#"
+
+// documentTags returns the tags of the "[tags-default]:#" directive of the
+// markdown content, if any.  The directive applies to the whole document
+// wherever it is, though it's best kept near the top.
+func documentTags(mdContent []byte) []string {
+	scanner := bufio.NewScanner(strings.NewReader(stripBOM(mdContent)))
+	var fences fenceTracker
+	for scanner.Scan() {
+		trimmed := strings.TrimSpace(scanner.Text())
+		if fences.inCode(trimmed) {
+			continue
+		}
+		if strings.HasPrefix(trimmed, defaultTagsPrefix) {
+			tags, err := parseTags("[tags]:#" + strings.TrimPrefix(trimmed, defaultTagsPrefix))
+			if err == nil {
+				return tags
+			}
+		}
+	}
+	return nil
+}
+
+// isListSeparator reports whether r separates the items of a list in a
+// directive, which may be written "a b" or "a, b".
+func isListSeparator(r rune) bool {
+	return r == ',' || unicode.IsSpace(r)
+}
+
+// withFenceTags returns tags plus any listed in the "tags" attribute of the
+// code fence, e.g. "```bash {tags=linux,gpu}".  tags itself is not modified.
+func withFenceTags(tags []string, fenceLine string) []string {
+	fence := parseFence(fenceLine)
+	if fence.Attrs["tags"] == "" {
+		return tags
+	}
+	merged := append([]string{}, tags...)
+	for _, tag := range strings.Split(fence.Attrs["tags"], ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			merged = append(merged, tag)
+		}
+	}
+	return merged
+}
+
+// orderByTags returns the sections with each header, and the sections up to
+// the next header, moved ahead of those whose tags come later in order, e.g.
+// every "prereq" section before the "main" ones.  A header is placed by the
+// first of its tags listed in order, and headers with none of them go last.
+// Headers of equal priority, and any sections before the first header, keep
+// their place in the document.
+func orderByTags(sections []Section, order []string) []Section {
+	priority := map[string]int{}
+	for i, tag := range order {
+		if _, ok := priority[tag]; !ok {
+			priority[tag] = i
+		}
+	}
+	type chunk struct {
+		sections []Section
+		priority int
+	}
+	var lead []Section
+	var chunks []chunk
+	for _, sec := range sections {
+		if sec.Type == SectionHeader {
+			rank := len(order)
+			for _, tag := range sec.Tags {
+				if p, ok := priority[tag]; ok && p < rank {
+					rank = p
+				}
+			}
+			chunks = append(chunks, chunk{priority: rank})
+		}
+		if len(chunks) == 0 {
+			lead = append(lead, sec)
+			continue
+		}
+		last := &chunks[len(chunks)-1]
+		last.sections = append(last.sections, sec)
+	}
+	sort.SliceStable(chunks, func(i, j int) bool {
+		return chunks[i].priority < chunks[j].priority
+	})
+	ordered := append([]Section{}, lead...)
+	for _, c := range chunks {
+		ordered = append(ordered, c.sections...)
+	}
+	return ordered
+}
+
+// headerTags records the tags of a header for its subsections to inherit.
+type headerTags struct {
+	level int
+	tags  []string
+}
+
+// inheritableTags returns the tags a subsection inherits from its parent
+// header.  The "always" tag only applies to the section it is declared in.
+func inheritableTags(tags []string) []string {
+	var inherited []string
+	for _, tag := range tags {
+		if tag != "always" {
+			inherited = append(inherited, tag)
+		}
+	}
+	return inherited
+}
+
 func checkForAlwaysTag(tags []string) bool {
 	for _, tag := range tags {
 		if tag == "always" {
@@ -1,6 +1,7 @@
 package readmerunner
 
 import (
+	"reflect"
 	"testing"
 )
 
@@ -17,6 +18,10 @@ func TestParseTags(t *testing.T) {
 		{"single", "[tags]:# (foo)", []string{"foo"}, false},
 		{"reserved", "[tags]:# (always foo bar)", []string{"always", "foo", "bar"}, false},
 		{"invalid", "[tags]:# (foo bar", nil, true},
+		{"commas", "[tags]:# (foo, bar, baz)", []string{"foo", "bar", "baz"}, false},
+		{"commas without spaces", "[tags]:# (foo,bar)", []string{"foo", "bar"}, false},
+		{"trailing comma", "[tags]:# (foo bar,)", []string{"foo", "bar"}, false},
+		{"only commas", "[tags]:# (, ,)", nil, true},
 	}
 	for _, tt := range tc {
 		t.Run(tt.name, func(t *testing.T) {
@@ -63,3 +68,101 @@ func TestCheckSectionTag(t *testing.T) {
 		})
 	}
 }
+
+func TestParseSectionsTagInheritance(t *testing.T) {
+	md := []byte("# Title\n[tags]:# (always)\n## Linux\n[tags]:# (linux)\n### Install\n```bash\necho apt\n```\n### GPU\n[tags]:# (gpu)\n## Windows\n### Install\n")
+
+	var headers []string
+	for _, sec := range parseSections(md, "", []string{"linux"}) {
+		if sec.Type == SectionHeader {
+			headers = append(headers, sec.Lines[0])
+		}
+	}
+	expected := []string{"# Title", "## Linux", "### Install"}
+	if !reflect.DeepEqual(headers, expected) {
+		t.Errorf("Expected headers %v, got %v", expected, headers)
+	}
+
+	sections := parseSections(md, "", nil)
+	if tags := sections[4].Tags; !reflect.DeepEqual(tags, []string{"gpu"}) {
+		t.Errorf("Expected own tags to replace inherited ones, got %v", tags)
+	}
+	if tags := sections[6].Tags; len(tags) != 0 {
+		t.Errorf("Expected always not to be inherited, got %v", tags)
+	}
+}
+
+func TestParseSectionsPromptTags(t *testing.T) {
+	tc := []struct {
+		name string
+		md   string
+	}{
+		{"own tags", "# Setup\n[tags]:# (linux)\n[prompt]:# (NAME \"Name?\")\nText after the prompt.\n"},
+		{"default tags", "[tags-default]:# (linux)\n# Setup\n[prompt]:# (NAME \"Name?\")\nText after the prompt.\n"},
+	}
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			var text []string
+			for _, sec := range parseSections([]byte(tt.md), "", []string{"linux"}) {
+				if sec.Type == SectionText {
+					text = append(text, sec.Lines...)
+				}
+			}
+			if !reflect.DeepEqual(text, []string{"Text after the prompt."}) {
+				t.Errorf("Expected the text after the prompt to keep its tags, got %q", text)
+			}
+		})
+	}
+}
+
+func TestOrderByTags(t *testing.T) {
+	mdContent := []byte("Intro\n# A\n[tags]:# (main)\n# B\n# C\n[tags]:# (prereq)\n## D\n")
+	var headers []string
+	for _, sec := range orderByTags(parseSections(mdContent, "", nil), []string{"prereq", "main"}) {
+		if sec.Type == SectionHeader {
+			headers = append(headers, sec.Lines[0])
+		}
+	}
+	expected := []string{"# C", "## D", "# A", "# B"}
+	if !reflect.DeepEqual(headers, expected) {
+		t.Errorf("Expected headers %q, got %q", expected, headers)
+	}
+}
+
+func TestParseSectionsDefaultTags(t *testing.T) {
+	md := []byte("[tags-default]:# (linux)\n# Title\nIntro.\n## Install\n```bash\necho apt\n```\n## Windows\n[tags]:# (windows)\n### Install\n```text\n[tags-default]:# (ignored)\n```\n")
+
+	tc := []struct {
+		name     string
+		userTags []string
+		expected []string
+	}{
+		{"default tag", []string{"linux"}, []string{"# Title", "## Install"}},
+		{"own tags override", []string{"windows"}, []string{"## Windows", "### Install"}},
+	}
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			var headers []string
+			for _, sec := range parseSections(md, "", tt.userTags) {
+				if sec.Type == SectionHeader {
+					headers = append(headers, sec.Lines[0])
+				}
+				for _, line := range sec.Lines {
+					if line == "[tags-default]:# (linux)" {
+						t.Errorf("Expected the directive to be hidden, got section %q", sec.Lines)
+					}
+				}
+			}
+			if !reflect.DeepEqual(headers, tt.expected) {
+				t.Errorf("Expected headers %v, got %v", tt.expected, headers)
+			}
+		})
+	}
+	if tags := documentTags(md); !reflect.DeepEqual(tags, []string{"linux"}) {
+		t.Errorf("Expected document tags [linux], got %v", tags)
+	}
+	tilde := []byte("~~~text\n[tags-default]:# (ignored)\n~~~\n[tags-default]:# (linux)\n")
+	if tags := documentTags(tilde); !reflect.DeepEqual(tags, []string{"linux"}) {
+		t.Errorf("Expected document tags [linux] outside the ~~~ block, got %v", tags)
+	}
+}
@@ -0,0 +1,12 @@
+//go:build !unix || aix || solaris
+
+package readmerunner
+
+import "os"
+
+// consoleWidth reports that the width of the console can't be asked for on
+// this platform, e.g. Windows, where $COLUMNS is used instead.  Solaris and
+// AIX have no ioctl system call to ask with.
+func consoleWidth(f *os.File) (int, bool) {
+	return 0, false
+}
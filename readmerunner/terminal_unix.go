@@ -0,0 +1,22 @@
+//go:build unix && !aix && !solaris
+
+package readmerunner
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// consoleWidth asks the terminal f is attached to for its width.  It reports
+// false when f isn't a terminal.
+func consoleWidth(f *os.File) (int, bool) {
+	var size struct {
+		rows, cols, xpixel, ypixel uint16
+	}
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), uintptr(syscall.TIOCGWINSZ), uintptr(unsafe.Pointer(&size)))
+	if errno != 0 || size.cols == 0 {
+		return 0, false
+	}
+	return int(size.cols), true
+}
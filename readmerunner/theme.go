@@ -0,0 +1,139 @@
+package readmerunner
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// Theme controls how headers and prompts are rendered in run mode.
+type Theme string
+
+const (
+	// ThemeMarkdown prints headers as written, e.g. "## Section".
+	ThemeMarkdown Theme = "markdown"
+	// ThemePlain prints only the header text.
+	ThemePlain Theme = "plain"
+	// ThemeBoxed draws a box around the header text and prints prompts in
+	// bold.
+	ThemeBoxed Theme = "boxed"
+	// ThemeUnderlined prints the header text underlined, with "=" for top
+	// level headers, which are also uppercased, and "-" for the others, and
+	// prompts in bold.
+	ThemeUnderlined Theme = "underlined"
+)
+
+// ParseTheme returns the Theme named by s.  An empty string selects the
+// default markdown theme.
+func ParseTheme(s string) (Theme, error) {
+	switch Theme(strings.ToLower(strings.TrimSpace(s))) {
+	case ThemeMarkdown, "":
+		return ThemeMarkdown, nil
+	case ThemePlain:
+		return ThemePlain, nil
+	case ThemeBoxed:
+		return ThemeBoxed, nil
+	case ThemeUnderlined:
+		return ThemeUnderlined, nil
+	default:
+		return "", fmt.Errorf("unknown theme %q (expected markdown, plain, boxed, or underlined)", s)
+	}
+}
+
+// themePromptColors holds the colors of the prompts in the themes that
+// style them, so that they stand out from the framed or underlined headers.
+var themePromptColors = map[Theme]string{
+	ThemeBoxed:      "1",
+	ThemeUnderlined: "1",
+}
+
+// promptColor returns the color of the prompts in the given theme: the
+// Prompt color in use, e.g. set by a theme file, or else the theme's own.
+func promptColor(theme Theme) string {
+	if colors.Prompt != "" {
+		return colors.Prompt
+	}
+	return themePromptColors[theme]
+}
+
+// renderHeader returns the lines used to display a header line in the given
+// theme.
+func renderHeader(header string, theme Theme) []string {
+	text, level := getHeadingText(header)
+	switch theme {
+	case ThemePlain:
+		return []string{text}
+	case ThemeBoxed:
+		bar := strings.Repeat("─", utf8.RuneCountInString(text)+2)
+		return []string{
+			"┌" + bar + "┐",
+			"│ " + text + " │",
+			"└" + bar + "┘",
+		}
+	case ThemeUnderlined:
+		rule := "-"
+		if level == 1 {
+			text = strings.ToUpper(text)
+			rule = "="
+		}
+		return []string{text, strings.Repeat(rule, utf8.RuneCountInString(text))}
+	default:
+		header, _ = splitHeadingID(header)
+		return []string{header}
+	}
+}
+
+// renderCode returns the lines of a code block as displayed.  The added and
+// removed lines of a diff are colored, by default green and red, and its hunk
+// headers cyan.  The lines of other blocks use the code color, if any.
+func renderCode(lines []string) []string {
+	if len(lines) < 2 {
+		return lines
+	}
+	rendered := append([]string{}, lines...)
+	switch strings.ToLower(parseFence(lines[0]).Language) {
+	case "diff", "patch":
+	default:
+		copy(rendered[1:len(lines)-1], colorLines(colors.Code, lines[1:len(lines)-1]))
+		return rendered
+	}
+	for i := 1; i < len(lines)-1; i++ {
+		line := lines[i]
+		switch {
+		case strings.HasPrefix(line, "+++"), strings.HasPrefix(line, "---"):
+			rendered[i] = colorize(colors.DiffHeader, line)
+		case strings.HasPrefix(line, "+"):
+			rendered[i] = colorize(colors.Added, line)
+		case strings.HasPrefix(line, "-"):
+			rendered[i] = colorize(colors.Removed, line)
+		case strings.HasPrefix(line, "@@"):
+			rendered[i] = colorize(colors.Hunk, line)
+		}
+	}
+	return rendered
+}
+
+// renderBlockquotes returns lines with every blockquote rendered with a
+// consistent "> " prefix.  A blockquote runs from a ">" line to the next blank
+// line, so lazy continuation lines written without the ">" are included.
+func renderBlockquotes(lines []string) []string {
+	rendered := make([]string, 0, len(lines))
+	inQuote := false
+	indent := ""
+	for _, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(trimmed, ">"):
+			inQuote = true
+			indent = line[:strings.Index(line, ">")]
+			content := strings.TrimPrefix(strings.TrimPrefix(trimmed, ">"), " ")
+			line = strings.TrimRight(indent+"> "+content, " ")
+		case trimmed == "":
+			inQuote = false
+		case inQuote:
+			line = indent + "> " + trimmed
+		}
+		rendered = append(rendered, line)
+	}
+	return rendered
+}
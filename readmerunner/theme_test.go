@@ -0,0 +1,152 @@
+package readmerunner
+
+import (
+	"io"
+	"reflect"
+	"testing"
+)
+
+func TestParseTheme(t *testing.T) {
+	tc := []struct {
+		name      string
+		input     string
+		expected  Theme
+		expectErr bool
+	}{
+		{"default", "", ThemeMarkdown, false},
+		{"markdown", "markdown", ThemeMarkdown, false},
+		{"plain", "plain", ThemePlain, false},
+		{"underlined", "underlined", ThemeUnderlined, false},
+		{"boxed", "Boxed", ThemeBoxed, false},
+		{"unknown", "fancy", "", true},
+	}
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			theme, err := ParseTheme(tt.input)
+			if (err != nil) != tt.expectErr {
+				t.Fatalf("Expected error: %v, got %v", tt.expectErr, err)
+			}
+			if theme != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, theme)
+			}
+		})
+	}
+}
+
+func TestRenderHeader(t *testing.T) {
+	tc := []struct {
+		name     string
+		theme    Theme
+		expected []string
+	}{
+		{"markdown", ThemeMarkdown, []string{"## Section One"}},
+		{"plain", ThemePlain, []string{"Section One"}},
+		{"boxed", ThemeBoxed, []string{
+			"┌─────────────┐",
+			"│ Section One │",
+			"└─────────────┘",
+		}},
+		{"underlined", ThemeUnderlined, []string{"Section One", "-----------"}},
+	}
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			got := renderHeader("## Section One", tt.theme)
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("Expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestRenderHeaderUnderlinedTitle(t *testing.T) {
+	expected := []string{"GETTING STARTED", "==============="}
+	if got := renderHeader("# Getting Started", ThemeUnderlined); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected %q, got %q", expected, got)
+	}
+}
+
+func TestRunMarkdownThemePrompts(t *testing.T) {
+	defer SetColors(DefaultColors)
+	tc := []struct {
+		name     string
+		theme    Theme
+		prompt   string
+		expected string
+	}{
+		{"markdown", ThemeMarkdown, "", "\n> Press Enter to continue to [Two] (or type 'exit'): "},
+		{"plain", ThemePlain, "", "\n> Press Enter to continue to [Two] (or type 'exit'): "},
+		{"boxed", ThemeBoxed, "", "\n\033[1m> Press Enter to continue to [Two] (or type 'exit'):\033[0m "},
+		{"underlined", ThemeUnderlined, "", "\n\033[1m> Press Enter to continue to [Two] (or type 'exit'):\033[0m "},
+		{"prompt color", ThemeMarkdown, "36", "\n\033[36m> Press Enter to continue to [Two] (or type 'exit'):\033[0m "},
+		{"prompt color over theme", ThemeBoxed, "36", "\n\033[36m> Press Enter to continue to [Two] (or type 'exit'):\033[0m "},
+	}
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			c := DefaultColors
+			c.Prompt = tt.prompt
+			SetColors(c)
+			var prompts []string
+			prompt := func(msg string) string {
+				prompts = append(prompts, msg)
+				return ""
+			}
+			if _, err := RunMarkdownWithOptions([]byte("# One\n# Two\n"), Options{Theme: tt.theme}, io.Discard, prompt); err != nil {
+				t.Fatalf("RunMarkdownWithOptions returned error: %v", err)
+			}
+			if len(prompts) == 0 || prompts[0] != tt.expected {
+				t.Errorf("Expected the prompt %q, got %q", tt.expected, prompts)
+			}
+		})
+	}
+}
+
+func TestRenderCode(t *testing.T) {
+	tc := []struct {
+		name     string
+		lines    []string
+		expected []string
+	}{
+		{"bash", []string{"```bash", "-x", "```"}, []string{"```bash", "-x", "```"}},
+		{"diff", []string{"```diff", "--- a/f", "+++ b/f", "@@ -1 +1 @@", "-old", "+new", " same", "```"}, []string{
+			"```diff",
+			"\033[1m--- a/f\033[0m",
+			"\033[1m+++ b/f\033[0m",
+			"\033[36m@@ -1 +1 @@\033[0m",
+			"\033[31m-old\033[0m",
+			"\033[32m+new\033[0m",
+			" same",
+			"```",
+		}},
+	}
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			got := renderCode(tt.lines)
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("Expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestRenderBlockquotes(t *testing.T) {
+	tc := []struct {
+		name     string
+		lines    []string
+		expected []string
+	}{
+		{"plain text", []string{"text", "more"}, []string{"text", "more"}},
+		{"two lines", []string{"> first", "> second"}, []string{"> first", "> second"}},
+		{"missing space", []string{">first", ">second"}, []string{"> first", "> second"}},
+		{"lazy continuation", []string{"> first", "second", "", "after"}, []string{"> first", "> second", "", "after"}},
+		{"empty quote line", []string{"> first", ">", "> second"}, []string{"> first", ">", "> second"}},
+		{"indented", []string{"  > first", "second"}, []string{"  > first", "  > second"}},
+	}
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			got := renderBlockquotes(tt.lines)
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("Expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
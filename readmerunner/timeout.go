@@ -0,0 +1,83 @@
+package readmerunner
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// ErrPromptTimeout is returned when a prompt without a default goes
+// unanswered for longer than Options.PromptTimeout.
+var ErrPromptTimeout = errors.New("no answer")
+
+// timedPrompt wraps a prompt function so that a prompt left unanswered for
+// longer than a timeout gets an empty answer, i.e. its default.  The prompt
+// function keeps waiting in the background, and an answer that comes after
+// the timeout is ignored rather than taken for the next prompt, which may be
+// asking something else entirely, e.g. whether to run a code block.
+type timedPrompt struct {
+	promptFunc func(string) string
+	w          io.Writer
+	// late is printed when an answer comes after its prompt timed out.
+	late string
+	// pending receives the answer to a prompt that timed out.
+	pending chan string
+	// timedOut reports whether the last prompt timed out.
+	timedOut bool
+}
+
+// ask shows msg and returns the answer, or "" if there is none within the
+// timeout, in which case note is printed.
+func (p *timedPrompt) ask(msg string, timeout time.Duration, note string) string {
+	deadline := time.After(timeout)
+	if p.pending != nil {
+		// The prompt function is still waiting for the answer to a prompt
+		// that timed out, so that answer has to come first.
+		fmt.Fprint(p.w, msg)
+		select {
+		case <-p.pending:
+			p.pending = nil
+			fmt.Fprintln(p.w, "\n"+p.late)
+		case <-deadline:
+			p.timedOut = true
+			fmt.Fprintln(p.w, "\n"+note)
+			return ""
+		}
+	}
+	p.pending = make(chan string, 1)
+	go func(ch chan string) {
+		ch <- p.promptFunc(msg)
+	}(p.pending)
+	select {
+	case answer := <-p.pending:
+		p.pending = nil
+		p.timedOut = false
+		return answer
+	case <-deadline:
+		p.timedOut = true
+		fmt.Fprintln(p.w, "\n"+note)
+		return ""
+	}
+}
+
+// timePrompts sets up the timeouts of Options.PromptTimeout and
+// Options.AutoAdvance around the session's prompt function.
+func (s *session) timePrompts() {
+	if s.opts.PromptTimeout <= 0 && s.opts.AutoAdvance <= 0 {
+		return
+	}
+	s.prompts = &timedPrompt{promptFunc: s.promptFunc, w: s.w, late: s.messages().LateAnswer}
+	if timeout := s.opts.PromptTimeout; timeout > 0 {
+		note := fill(s.messages().PromptTimeout, "duration", timeout.String())
+		s.promptFunc = func(msg string) string {
+			return s.prompts.ask(msg, timeout, note)
+		}
+	}
+}
+
+// promptTimedOut reports whether the last prompt went unanswered for longer
+// than its timeout.
+func (s *session) promptTimedOut() bool {
+	return s.prompts != nil && s.prompts.timedOut
+}
@@ -0,0 +1,109 @@
+package readmerunner
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunMarkdownPromptTimeout(t *testing.T) {
+	slowPrompt := func(string) string {
+		time.Sleep(500 * time.Millisecond)
+		return "typed"
+	}
+	tc := []struct {
+		name     string
+		md       string
+		expected string
+		err      string
+	}{
+		{
+			name:     "Uses Default",
+			md:       "[prompt]:# (NAME \"Name?\" world)\n",
+			expected: "world",
+		},
+		{
+			name: "No Default",
+			md:   "[prompt]:# (NAME \"Name?\")\n",
+			err:  "no answer for NAME within 50ms and it has no default",
+		},
+	}
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			result, err := RunMarkdownWithOptions([]byte(tt.md), Options{PromptTimeout: 50 * time.Millisecond}, &buf, slowPrompt)
+			if tt.err != "" {
+				if err == nil || err.Error() != tt.err {
+					t.Fatalf("Expected error %q, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("RunMarkdownWithOptions returned error: %v", err)
+			}
+			if !strings.Contains(buf.String(), "> No answer after 50ms, using the default") {
+				t.Errorf("Expected timeout message, got %q", buf.String())
+			}
+			if got := result.Answers["NAME"]; got != tt.expected {
+				t.Errorf("Expected NAME=%q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestTimedPromptLateAnswer(t *testing.T) {
+	answers := make(chan string)
+	var prompts []string
+	var buf bytes.Buffer
+	p := &timedPrompt{
+		promptFunc: func(msg string) string {
+			prompts = append(prompts, msg)
+			return <-answers
+		},
+		w:    &buf,
+		late: "ignored",
+	}
+	if got := p.ask("first? ", 20*time.Millisecond, "timed out"); got != "" || !p.timedOut {
+		t.Fatalf("Expected first prompt to time out, got %q", got)
+	}
+	go func() {
+		answers <- "r"
+		answers <- "answer"
+	}()
+	if got := p.ask("second? ", time.Second, "timed out"); got != "answer" || p.timedOut {
+		t.Errorf("Expected the late answer to be ignored, got %q", got)
+	}
+	if !strings.Contains(buf.String(), "second? \nignored\n") {
+		t.Errorf("Expected a note about the ignored answer, got %q", buf.String())
+	}
+	if len(prompts) != 2 || prompts[1] != "second? " {
+		t.Errorf("Expected the second prompt to be asked again, got %q", prompts)
+	}
+}
+
+func TestRunMarkdownAutoAdvance(t *testing.T) {
+	// Nobody answers until the test is over.
+	unblock := make(chan struct{})
+	defer close(unblock)
+	idlePrompt := func(string) string {
+		<-unblock
+		return ""
+	}
+	mdContent := []byte("# One\nFirst.\n# Two\nSecond.\n# Three\nThird.\n")
+	var buf bytes.Buffer
+	started := time.Now()
+	if _, err := RunMarkdownWithOptions(mdContent, Options{AutoAdvance: 50 * time.Millisecond}, &buf, idlePrompt); err != nil {
+		t.Fatalf("RunMarkdownWithOptions returned error: %v", err)
+	}
+	if took := time.Since(started); took < 100*time.Millisecond {
+		t.Errorf("Expected the run to wait at each section, took %v", took)
+	}
+	output := buf.String()
+	if strings.Count(output, "> Continuing after 50ms") != 2 {
+		t.Errorf("Expected two auto-advances, got %q", output)
+	}
+	if !strings.Contains(output, "# Three\nThird.") {
+		t.Errorf("Expected the run to reach the last section, got %q", output)
+	}
+}
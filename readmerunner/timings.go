@@ -0,0 +1,47 @@
+package readmerunner
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Timing records how long a code block took to run.
+type Timing struct {
+	// Section is the text of the header the code block is under.
+	Section string
+	// Command is the first line of the code block.
+	Command string
+	// Duration is the wall-clock time the block took to run.
+	Duration time.Duration
+}
+
+// formatDuration formats d in seconds with one decimal place, e.g. "1.3s".
+func formatDuration(d time.Duration) string {
+	return fmt.Sprintf("%.1fs", d.Seconds())
+}
+
+// ringBell rings the terminal bell after a code block that took at least
+// Options.Bell to run, so that a user who switched away knows it's done.
+func (s *session) ringBell(took time.Duration) {
+	if s.opts.Bell > 0 && took >= s.opts.Bell {
+		fmt.Fprint(s.w, "\a")
+	}
+}
+
+// printTimings writes the recorded timings, slowest first, when timings were
+// requested.
+func (s *session) printTimings() {
+	if !s.opts.Timings || len(s.result.Timings) == 0 {
+		return
+	}
+	timings := append([]Timing{}, s.result.Timings...)
+	sort.SliceStable(timings, func(i, j int) bool {
+		return timings[i].Duration > timings[j].Duration
+	})
+	fmt.Fprintln(s.w, "\n"+s.messages().Timings)
+	for _, t := range timings {
+		duration := fmt.Sprintf("%8s", formatDuration(t.Duration))
+		fmt.Fprintln(s.w, fill(s.messages().Timing, "duration", duration, "section", t.Section, "command", t.Command))
+	}
+}
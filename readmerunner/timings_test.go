@@ -0,0 +1,79 @@
+package readmerunner
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFormatDuration(t *testing.T) {
+	tc := []struct {
+		duration time.Duration
+		expected string
+	}{
+		{0, "0.0s"},
+		{1300 * time.Millisecond, "1.3s"},
+		{90 * time.Second, "90.0s"},
+	}
+	for _, tt := range tc {
+		t.Run(tt.expected, func(t *testing.T) {
+			if got := formatDuration(tt.duration); got != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestRunMarkdownTimings(t *testing.T) {
+	mdContent := []byte("# Fast\n```bash\necho fast\n```\n# Slow\n```bash\nsleep 0.2\n```\n")
+
+	var buf bytes.Buffer
+	result, err := RunMarkdownWithOptions(mdContent, Options{Auto: true, Timings: true}, &buf, fakePrompt(nil))
+	if err != nil {
+		t.Fatalf("RunMarkdownWithOptions returned error: %v", err)
+	}
+	if len(result.Timings) != 2 {
+		t.Fatalf("Expected 2 timings, got %v", result.Timings)
+	}
+	if result.Timings[0].Section != "Fast" || result.Timings[0].Command != "echo fast" {
+		t.Errorf("Unexpected timing %+v", result.Timings[0])
+	}
+	if result.Timings[1].Duration < 200*time.Millisecond {
+		t.Errorf("Expected slow block to take at least 200ms, got %v", result.Timings[1].Duration)
+	}
+
+	output := buf.String()
+	if strings.Count(output, "> (took ") != 2 {
+		t.Errorf("Expected a timing line per block, got %q", output)
+	}
+	summary := output[strings.Index(output, "> Timings:"):]
+	if strings.Index(summary, "Slow: sleep 0.2") > strings.Index(summary, "Fast: echo fast") {
+		t.Errorf("Expected slowest block first, got %q", summary)
+	}
+}
+
+func TestRunMarkdownBell(t *testing.T) {
+	tc := []struct {
+		name     string
+		code     string
+		bell     time.Duration
+		expected int
+	}{
+		{"Slow Block", "sleep 0.2", 100 * time.Millisecond, 1},
+		{"Fast Block", "echo fast", time.Minute, 0},
+		{"No Bell", "sleep 0.2", 0, 0},
+	}
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			mdContent := []byte("# Wait\n```bash\n" + tt.code + "\n```\n")
+			var buf bytes.Buffer
+			if _, err := RunMarkdownWithOptions(mdContent, Options{Auto: true, Bell: tt.bell}, &buf, fakePrompt(nil)); err != nil {
+				t.Fatalf("RunMarkdownWithOptions returned error: %v", err)
+			}
+			if got := strings.Count(buf.String(), "\a"); got != tt.expected {
+				t.Errorf("Expected %d bells, got %d in %q", tt.expected, got, buf.String())
+			}
+		})
+	}
+}
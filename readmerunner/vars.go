@@ -0,0 +1,31 @@
+package readmerunner
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+)
+
+// secretRe matches variable names whose values shouldn't be printed.
+var secretRe = regexp.MustCompile(`(?i)secret|token|passw(or)?d|credential|api_?key|private`)
+
+// printVars writes the prompt answers collected during the run as KEY=VALUE
+// lines when requested, redacting the values of variables that look secret.
+func (s *session) printVars() {
+	if !s.opts.PrintVars {
+		return
+	}
+	names := make([]string, 0, len(s.result.Answers))
+	for name := range s.result.Answers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fmt.Fprintln(s.w, "\n"+s.messages().Variables)
+	for _, name := range names {
+		value := quoteValue(s.result.Answers[name])
+		if secretRe.MatchString(name) {
+			value = "********"
+		}
+		fmt.Fprintf(s.w, "%s=%s\n", name, value)
+	}
+}
@@ -0,0 +1,30 @@
+package readmerunner
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestRunMarkdownPrintVars(t *testing.T) {
+	mdContent := []byte(`# Setup
+[prompt]:# (vars_name "Name?")
+[prompt]:# (vars_api_token "Token?")
+[prompt]:# (vars_color "Color?" [red blue] red)
+`)
+	responses := []string{"Jane Doe", "abc123", ""}
+
+	var buf bytes.Buffer
+	_, err := RunMarkdownWithOptions(mdContent, Options{PrintVars: true}, &buf, fakePrompt(responses))
+	if err != nil {
+		t.Fatalf("RunMarkdownWithOptions returned error: %v", err)
+	}
+	output := buf.String()
+	want := "\n> Variables:\nvars_api_token=********\nvars_color=red\nvars_name=\"Jane Doe\"\n\n> README complete!\n"
+	if !strings.HasSuffix(output, want) {
+		t.Errorf("Expected variables before the complete message, got %q", output)
+	}
+	if strings.Contains(output, "=abc123") {
+		t.Errorf("Expected secret to be redacted, got %q", output)
+	}
+}
@@ -0,0 +1,109 @@
+package readmerunner
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// whenRe matches a condition directive such as "[when]:# (runtime == docker)".
+var whenRe = regexp.MustCompile(`^\[when\]:#\s*\(\s*(\w+)\s*(==|!=)\s*(.*?)\s*\)$`)
+
+// parseWhen splits a "[when]:#" directive into the variable, the "==" or "!="
+// operator and the value it is compared with.  Values may be quoted, e.g.
+// (name == "Jane Doe").
+func parseWhen(directive string) (name, op, value string, err error) {
+	matches := whenRe.FindStringSubmatch(directive)
+	if matches == nil {
+		return "", "", "", fmt.Errorf("invalid when directive: %s", directive)
+	}
+	value = matches[3]
+	if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+		value = value[1 : len(value)-1]
+	}
+	return matches[1], matches[2], value, nil
+}
+
+// evalWhen evaluates a "[when]:#" directive against the variables returned by
+// lookup.
+func evalWhen(directive string, lookup func(name string) string) (bool, error) {
+	name, op, value, err := parseWhen(directive)
+	if err != nil {
+		return false, err
+	}
+	equal := lookup(name) == value
+	if op == "!=" {
+		return !equal, nil
+	}
+	return equal, nil
+}
+
+// lookupVar returns the value of a prompt answer, falling back to the
+// environment for variables that weren't prompted for in this run.
+func (s *session) lookupVar(name string) string {
+	if value, ok := s.result.Answers[name]; ok {
+		return value
+	}
+	return os.Getenv(name)
+}
+
+// sectionShown reports whether the "[when]:#" condition and the
+// "[requires]:#" precondition of sec hold.
+func (s *session) sectionShown(sec Section) (bool, error) {
+	if sec.When != "" {
+		if ok, err := evalWhen(sec.When, s.lookupVar); err != nil || !ok {
+			return false, err
+		}
+	}
+	return s.requirementMet(sec)
+}
+
+// requiresRe matches a precondition directive such as
+// "[requires]:# (command -v docker)".
+var requiresRe = regexp.MustCompile(`^\[requires\]:#\s*\((.*)\)$`)
+
+// checkRequires runs the command of a "[requires]:#" directive silently in the
+// verify shell, or the runner supplied for verify blocks, and reports whether
+// it succeeded.
+func (s *session) checkRequires(directive string) (bool, error) {
+	matches := requiresRe.FindStringSubmatch(directive)
+	if matches == nil || strings.TrimSpace(matches[1]) == "" {
+		return false, fmt.Errorf("invalid requires directive: %s", directive)
+	}
+	code := "{ " + matches[1] + "\n} >/dev/null 2>&1"
+	var status int
+	var err error
+	if supplied, ok := s.suppliedRunner("verify"); ok {
+		_, status, err = runWithStatus(supplied, code)
+	} else if runner, ok := GetRunner("verify").(*VerifyRunner); ok {
+		_, status, err = runner.RunOutput(code)
+	} else {
+		return false, fmt.Errorf("no shell available to check %q", matches[1])
+	}
+	if err != nil {
+		return false, err
+	}
+	return status == 0, nil
+}
+
+// requirementMet reports whether the "[requires]:#" precondition of sec holds.
+// The command runs once per header section, and a note is written when the
+// section is skipped.
+func (s *session) requirementMet(sec Section) (bool, error) {
+	if sec.Requires == "" {
+		return true, nil
+	}
+	if met, ok := s.requires[sec.Requires]; ok {
+		return met, nil
+	}
+	met, err := s.checkRequires(sec.Requires)
+	if err != nil {
+		return false, err
+	}
+	s.requires[sec.Requires] = met
+	if !met {
+		fmt.Fprintln(s.w, "\n"+fill(s.messages().SkippingSection, "command", strings.TrimSpace(strings.TrimPrefix(sec.Requires, "[requires]:#"))))
+	}
+	return met, nil
+}
@@ -0,0 +1,111 @@
+package readmerunner
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestEvalWhen(t *testing.T) {
+	vars := map[string]string{"runtime": "docker", "name": "Jane Doe"}
+	lookup := func(name string) string { return vars[name] }
+	tc := []struct {
+		name      string
+		directive string
+		expected  bool
+		expectErr bool
+	}{
+		{"equal", "[when]:# (runtime == docker)", true, false},
+		{"not equal", "[when]:# (runtime == podman)", false, false},
+		{"negated", "[when]:# (runtime != podman)", true, false},
+		{"quoted", `[when]:# (name == "Jane Doe")`, true, false},
+		{"unset", "[when]:# (missing == )", true, false},
+		{"invalid", "[when]:# (runtime)", false, true},
+	}
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := evalWhen(tt.directive, lookup)
+			if (err != nil) != tt.expectErr {
+				t.Fatalf("Expected error: %v, got %v", tt.expectErr, err)
+			}
+			if got != tt.expected {
+				t.Errorf("Expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestRunMarkdownWhen(t *testing.T) {
+	mdContent := []byte(`# Setup
+[prompt]:# (when_runtime "Which runtime?" [docker podman] docker)
+## Docker
+[when]:# (when_runtime == docker)
+Using Docker.
+` + "```bash\necho docker\n```" + `
+## Podman
+[when]:# (when_runtime == podman)
+Using Podman.
+` + "```bash\necho podman\n```" + `
+## Done
+`)
+	tc := []struct {
+		answer  string
+		shown   string
+		skipped string
+	}{
+		{"docker", "Using Docker.", "Podman"},
+		{"podman", "Using Podman.", "Docker"},
+	}
+	for _, tt := range tc {
+		t.Run(tt.answer, func(t *testing.T) {
+			var buf bytes.Buffer
+			_, err := RunMarkdownWithOptions(mdContent, Options{Auto: true, Answers: map[string]string{"when_runtime": tt.answer}}, &buf, fakePrompt(nil))
+			if err != nil {
+				t.Fatalf("RunMarkdownWithOptions returned error: %v", err)
+			}
+			output := buf.String()
+			if !strings.Contains(output, tt.shown) || !strings.Contains(output, "Output: "+tt.answer) {
+				t.Errorf("Expected %s section to run, got %q", tt.answer, output)
+			}
+			if strings.Contains(output, "## "+tt.skipped) || strings.Contains(output, "echo "+strings.ToLower(tt.skipped)) {
+				t.Errorf("Expected %s section to be skipped, got %q", tt.skipped, output)
+			}
+			if strings.Contains(output, "[when]:#") {
+				t.Errorf("Expected when directives to be hidden, got %q", output)
+			}
+		})
+	}
+}
+
+func TestRunMarkdownRequires(t *testing.T) {
+	mdContent := []byte(`# Intro
+## Missing Tool
+[requires]:# (command -v no-such-tool-for-readmerunner)
+Needs the tool.
+` + "```bash\necho needs tool\n```" + `
+More about the tool.
+## Shell
+[requires]:# (command -v sh)
+Has a shell.
+`)
+	var buf bytes.Buffer
+	result, err := RunMarkdownWithOptions(mdContent, Options{Auto: true}, &buf, fakePrompt(nil))
+	if err != nil {
+		t.Fatalf("RunMarkdownWithOptions returned error: %v", err)
+	}
+	output := buf.String()
+	for _, skipped := range []string{"Missing Tool", "Needs the tool.", "needs tool", "More about the tool."} {
+		if strings.Contains(output, skipped) {
+			t.Errorf("Expected %q to be skipped, got %q", skipped, output)
+		}
+	}
+	if strings.Count(output, "> Skipping section: (command -v no-such-tool-for-readmerunner) failed") != 1 {
+		t.Errorf("Expected a single skip note, got %q", output)
+	}
+	if !strings.Contains(output, "Has a shell.") {
+		t.Errorf("Expected section with a met requirement to be shown, got %q", output)
+	}
+	if result.BlocksRun != 0 {
+		t.Errorf("Expected no blocks to run, got %d", result.BlocksRun)
+	}
+}